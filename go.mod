@@ -10,7 +10,6 @@ require (
 	github.com/go-chi/chi/v5 v5.2.3
 	github.com/urfave/cli/v3 v3.6.1
 	golang.org/x/mod v0.31.0
-	golang.org/x/net v0.48.0
 	golang.org/x/sys v0.39.0
 	golang.org/x/time v0.14.0
 )
@@ -5,12 +5,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"os/user"
 	"path/filepath"
+	"sprout/internal/discord/backup"
 	"sprout/internal/discord/chat"
 	"sprout/internal/platform/auth"
 	"sprout/internal/platform/database"
+	"sprout/internal/platform/download"
+	"sprout/internal/platform/download/extractors"
+	"sprout/internal/platform/linkrot"
+	"sprout/internal/platform/retention"
 	"sprout/pkg/compressor"
 	"sprout/pkg/workqueue"
 	"sprout/pkg/x"
@@ -59,9 +65,12 @@ type App struct {
 	TempDir       string // (e.g., StorageDir/tmp)
 	ReleaseSource ReleaseSource
 
-	RedditQueue  *workqueue.Queue
-	RedGifsQueue *workqueue.Queue
-	YoutubeQueue *workqueue.Queue
+	ExtractorQueues map[string]*workqueue.Queue // by extractors.QueuePolicy name
+	ReplayQueue     *workqueue.Queue            // one webhook message per job
+
+	hostQueuesMu   sync.Mutex
+	hostQueues     map[string]*workqueue.Queue     // by queue name and host, see extractors.QueueHost
+	queueOverrides map[string]database.QueuePolicy // of the admin, host queues pick them up when used
 
 	AuthManager *auth.Manager
 
@@ -69,6 +78,12 @@ type App struct {
 
 	Chat *chat.ChatManager
 
+	Backup   *backup.Manager
+	Replayer *backup.Replayer
+
+	Retention *retention.Enforcer
+	LinkRot   *linkrot.Monitor
+
 	Client              *bot.Client
 	DiscordEventLimiter chan struct{}   // limit concurrent event processing
 	DiscordWG           *sync.WaitGroup // wait group for active Discord work
@@ -162,6 +177,16 @@ func (a *App) Init(ctx context.Context, cmd *cli.Command) (context.Context, erro
 	mmVer := strings.TrimPrefix(semver.MajorMinor(a.Version), "v")
 	a.UserAgent = fmt.Sprintf("Mozilla/5.0 (compatible; %s/%s; +https://halsey.regfile.net)", a.Name, mmVer)
 
+	// X extraction API, read once so changing it requires a restart
+	extractors.SetXitterAPI(cfg.XitterAPIURL)
+	// yt-dlp allowlist, also updated live by the admin settings
+	extractors.SetYtDLPHosts(cfg.YtDLPHosts)
+	// per domain proxies and cookies, also updated live by the admin settings
+	download.SetRoutes(OutboundRoutes(cfg.Outbound))
+	if len(cfg.Outbound) > 0 {
+		a.Log.Debugf("Outbound routes:\n%s", download.FormatRoutes(OutboundRoutes(cfg.Outbound))) // passwords redacted
+	}
+
 	// set log level
 	if initLogLevel != "debug" {
 		if err := a.Log.SetLevel(cfg.LogLevel); err != nil {
@@ -187,9 +212,15 @@ func (a *App) Init(ctx context.Context, cmd *cli.Command) (context.Context, erro
 	a.Compressor = compressor.New(ctx)
 
 	// queues
-	a.RedditQueue = workqueue.New(a.Log, 5*time.Second, 2*time.Second, 30*time.Second)
-	a.RedGifsQueue = workqueue.New(a.Log, 5*time.Second, 2*time.Second, 30*time.Second)
-	a.YoutubeQueue = workqueue.New(a.Log, 5*time.Second, 2*time.Second, 30*time.Second)
+	a.ExtractorQueues = make(map[string]*workqueue.Queue)
+	a.hostQueues = make(map[string]*workqueue.Queue)
+	a.queueOverrides = cfg.QueuePolicies
+	for _, p := range extractors.Queues() {
+		// admin overrides, also updated live by the admin settings
+		p = QueuePolicy(p, cfg.QueuePolicies)
+		a.ExtractorQueues[p.Name] = workqueue.New(a.Log, p.Interval, p.Jitter, p.Backoff)
+	}
+	a.ReplayQueue = workqueue.New(a.Log, time.Second, 500*time.Millisecond, 30*time.Second)
 
 	// auth manager
 	a.AuthManager = auth.New(nil, nil)
@@ -197,6 +228,16 @@ func (a *App) Init(ctx context.Context, cmd *cli.Command) (context.Context, erro
 	// chat manager
 	a.Chat = chat.NewChatManager(a.DB, a.Log)
 
+	// backup manager
+	a.Backup = backup.NewManager(a.DB, a.Log, a.StorageDir, a.TempDir, a.UserAgent)
+	a.Replayer = backup.NewReplayer(a.DB, a.Log, a.StorageDir, a.ReplayQueue)
+
+	// retention enforcer, started by the service
+	a.Retention = retention.NewEnforcer(a.DB, a.Log)
+
+	// link rot monitor, started by the service
+	a.LinkRot = linkrot.NewMonitor(a.DB, a.Log, a.UserAgent, a.ExtractorQueue)
+
 	return ctx, nil
 }
 
@@ -220,6 +261,78 @@ func (a *App) Close() {
 	})
 }
 
+// ExtractorQueue returns the queue extraction and downloads of a link resolved by ex run in.
+func (a *App) ExtractorQueue(ex extractors.Extractor, rawURL string) *workqueue.Queue {
+	p := ex.Info().Queue
+	qh, ok := ex.(extractors.QueueHost)
+	if !ok {
+		return a.ExtractorQueues[p.Name]
+	}
+	host, interval, ok := qh.QueueHost(rawURL)
+	if !ok {
+		return a.ExtractorQueues[p.Name]
+	}
+
+	// created on first use, the policy follows admin overrides and host interval changes
+	a.hostQueuesMu.Lock()
+	defer a.hostQueuesMu.Unlock()
+	p = QueuePolicy(p, a.queueOverrides)
+	p.Interval = max(p.Interval, interval)
+	key := p.Name + ":" + host
+	q, ok := a.hostQueues[key]
+	if !ok {
+		q = workqueue.New(a.Log, p.Interval, p.Jitter, p.Backoff)
+		a.hostQueues[key] = q
+	} else if s := q.Stats(); s.Interval != p.Interval || s.Jitter != p.Jitter || s.Backoff != p.Backoff {
+		q.SetPolicy(p.Interval, p.Jitter, p.Backoff)
+	}
+	return q
+}
+
+// HostQueues returns a snapshot of the per host extractor queues created so far, keyed
+// <queue name>:<host>.
+func (a *App) HostQueues() map[string]*workqueue.Queue {
+	a.hostQueuesMu.Lock()
+	defer a.hostQueuesMu.Unlock()
+	return maps.Clone(a.hostQueues)
+}
+
+// SetQueuePolicies applies admin overrides to the running extractor queues, queues without
+// one go back to their default policy. Queues whose policy didn't change are left alone.
+func (a *App) SetQueuePolicies(overrides map[string]database.QueuePolicy) {
+	a.hostQueuesMu.Lock()
+	a.queueOverrides = overrides
+	a.hostQueuesMu.Unlock()
+	for _, p := range extractors.Queues() {
+		p = QueuePolicy(p, overrides)
+		q := a.ExtractorQueues[p.Name]
+		if s := q.Stats(); s.Interval != p.Interval || s.Jitter != p.Jitter || s.Backoff != p.Backoff {
+			a.Log.Infof("Queue %s policy set to %v interval, %v jitter, %v backoff", p.Name, p.Interval, p.Jitter, p.Backoff)
+			q.SetPolicy(p.Interval, p.Jitter, p.Backoff)
+		}
+	}
+}
+
+// QueuePolicy returns the default policy of a queue with its admin override applied, if any.
+func QueuePolicy(p extractors.QueuePolicy, overrides map[string]database.QueuePolicy) extractors.QueuePolicy {
+	o, ok := overrides[p.Name]
+	if !ok {
+		return p
+	}
+	seconds := func(s float64) time.Duration { return time.Duration(s * float64(time.Second)) }
+	p.Interval, p.Jitter, p.Backoff = seconds(o.Interval), seconds(o.Jitter), seconds(o.Backoff)
+	return p
+}
+
+// OutboundRoutes converts the outbound routes of the configuration for the download package.
+func OutboundRoutes(routes map[string]database.OutboundRoute) map[string]download.Route {
+	rs := make(map[string]download.Route, len(routes))
+	for domain, r := range routes {
+		rs[domain] = download.Route(r)
+	}
+	return rs
+}
+
 func (a *App) AddCleanup(f func() error) {
 	a.cleanup = append(a.cleanup, f)
 }
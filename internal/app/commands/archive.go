@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sprout/internal/app"
+	"sprout/internal/discord/backup"
+	"sprout/internal/platform/database"
+
+	"github.com/disgoorg/disgo"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/urfave/cli/v3"
+)
+
+var Archive = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:  "archive",
+		Usage: "message archive commands",
+		Commands: []*cli.Command{
+			{
+				Name:        "export",
+				Description: "Render the archive of a guild into a static site that can be opened offline in any browser",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "guild",
+						Usage:    "guild ID to export",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "out",
+						Usage:    "output directory, created if missing",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					guildID, err := snowflake.Parse(cmd.String("guild"))
+					if err != nil {
+						return fmt.Errorf("invalid guild ID: %w", err)
+					}
+					out, err := filepath.Abs(cmd.String("out"))
+					if err != nil {
+						return fmt.Errorf("invalid output directory: %w", err)
+					}
+
+					fmt.Println("Exporting...")
+					stats, err := backup.ExportSite(a.DB, a.StorageDir, guildID, out)
+					if err != nil {
+						return fmt.Errorf("failed to export archive: %w", err)
+					}
+					fmt.Printf("Exported %d messages in %d channels (%d pages, %d assets)\n", stats.Messages, stats.Channels, stats.Pages, stats.Assets)
+					fmt.Printf("Open %s in a browser to view it.\n", filepath.Join(out, "index.html"))
+					return nil
+				},
+			},
+			{
+				Name:        "import",
+				Description: "Import DiscordChatExporter JSON exports or a Discord data package into the archive. Channels are matched by ID, channels the bot never saw are skipped",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "from",
+						Usage:    "export file, or a directory or zip of exports / data package",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:  "partial",
+						Usage: "exports are filtered or otherwise incomplete, don't let the backup skip their range",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					src, err := filepath.Abs(cmd.String("from"))
+					if err != nil {
+						return fmt.Errorf("invalid path: %w", err)
+					}
+
+					fmt.Println("Importing...")
+					stats, err := backup.Import(a.DB, src, cmd.Bool("partial"))
+					if stats != nil {
+						fmt.Printf("%s: imported %d messages in %d channels, %d were already archived\n", stats.Format, stats.Messages, stats.Channels, stats.Existing)
+						for _, id := range stats.SkippedChannels {
+							fmt.Printf("Skipped unknown channel %s\n", id)
+						}
+					}
+					if err != nil {
+						return fmt.Errorf("failed to import: %w", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "replay",
+				Description: "Recreate the archive of a channel in another channel through a webhook, posting as the original authors. Run it again to resume a stopped replay",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "channel",
+						Usage:    "archived channel ID to replay, may be deleted",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "to",
+						Usage:    "destination channel ID, the bot needs the Manage Webhooks permission there",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					sourceID, err := snowflake.Parse(cmd.String("channel"))
+					if err != nil {
+						return fmt.Errorf("invalid channel ID: %w", err)
+					}
+					destID, err := snowflake.Parse(cmd.String("to"))
+					if err != nil {
+						return fmt.Errorf("invalid destination channel ID: %w", err)
+					}
+					cfg, err := database.ViewConfig(a.DB)
+					if err != nil {
+						return fmt.Errorf("failed to view config: %w", err)
+					}
+					if cfg.BotToken == "" {
+						return fmt.Errorf("bot token not set, run setup first")
+					}
+
+					// rest only, no gateway connection
+					client, err := disgo.New(cfg.BotToken)
+					if err != nil {
+						return fmt.Errorf("failed to create client: %w", err)
+					}
+					defer client.Close(context.Background())
+
+					// upload limit of the destination guild, if known
+					var destGuild database.Guild
+					if ch, err := database.ViewChannel(a.DB, destID); err == nil {
+						if g, err := database.ViewGuild(a.DB, ch.GuildID); err == nil {
+							destGuild = *g
+						}
+					}
+
+					done := make(chan error, 1)
+					var state database.Replay
+					n, err := a.Replayer.Replay(client.Rest, sourceID, destID, destGuild, func(s database.Replay, err error) {
+						state = s
+						done <- err
+					})
+					if err != nil {
+						return fmt.Errorf("failed to start replay: %w", err)
+					}
+					if n == 0 {
+						fmt.Println("Nothing left to replay.")
+						return nil
+					}
+					fmt.Printf("Replaying %d messages. Progress is saved per message, if this gets interrupted run it again to resume.\n", n)
+
+					if err := <-done; err != nil {
+						return fmt.Errorf("replay stopped after %d messages, run this again to resume: %w", state.Replayed, err)
+					}
+					fmt.Printf("Replayed %d messages.\n", state.Replayed)
+					return nil
+				},
+			},
+		},
+	}
+})
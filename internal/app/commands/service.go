@@ -166,6 +166,8 @@ var Service = register(func(a *app.App) *cli.Command {
 							done := make(chan struct{})
 							go func() {
 								a.Chat.Close()
+								a.Backup.Close()
+								a.ReplayQueue.Close() // replays stop after the current message and resume later
 								a.DiscordWG.Wait()
 								close(done)
 							}()
@@ -188,6 +190,14 @@ var Service = register(func(a *app.App) *cli.Command {
 						}
 					}
 
+					// evict what the retention policies no longer allow
+					a.Retention.Start()
+					a.AddCleanup(a.Retention.Close)
+
+					// re-check the sources of stored assets
+					a.LinkRot.Start()
+					a.AddCleanup(a.LinkRot.Close)
+
 					// start http server
 					if err := a.Server.Listen(); err != nil { // blocks until server stops or shutdown signal received
 						return fmt.Errorf("server stopped with error: %w", err)
@@ -224,8 +234,12 @@ func createClient(a *app.App, token string, registerCommands bool) error {
 			OnGuildMemberJoin:               func(event *events.GuildMemberJoin) { listeners.OnGuildMemberJoin(a, event) },
 			OnGuildMemberLeave:              func(event *events.GuildMemberLeave) { listeners.OnGuildMemberLeave(a, event) },
 			OnGuildMessageCreate:            func(event *events.GuildMessageCreate) { listeners.OnGuildMessageCreate(a, event) },
+			OnGuildMessageUpdate:            func(event *events.GuildMessageUpdate) { listeners.OnGuildMessageUpdate(a, event) },
+			OnGuildMessageDelete:            func(event *events.GuildMessageDelete) { listeners.OnGuildMessageDelete(a, event) },
 			OnGuildChannelCreate:            func(event *events.GuildChannelCreate) { listeners.OnGuildChannelCreate(a, event) },
 			OnGuildChannelDelete:            func(event *events.GuildChannelDelete) { listeners.OnGuildChannelDelete(a, event) },
+			OnThreadCreate:                  func(event *events.ThreadCreate) { listeners.OnThreadCreate(a, event) },
+			OnThreadDelete:                  func(event *events.ThreadDelete) { listeners.OnThreadDelete(a, event) },
 			OnApplicationCommandInteraction: func(event *events.ApplicationCommandInteractionCreate) { listeners.OnCommandInteraction(a, event) },
 			OnComponentInteraction:          func(event *events.ComponentInteractionCreate) { listeners.OnComponentInteraction(a, event) },
 		}),
@@ -0,0 +1,606 @@
+// Package backup archives guild channel history into the Archive DBI.
+package backup
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sprout/internal/discord/attachments"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/download"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Data-Corruption/lmdb-go/lmdb"
+	"github.com/Data-Corruption/lmdb-go/wrap"
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const (
+	ScheduleInterval = time.Minute            // how often guilds are checked for a due run
+	PageSize         = 100                    // max messages discord returns per request
+	PageDelay        = 250 * time.Millisecond // rate limit courtesy between pages
+
+	MaxAttachmentSize = 100 * 1024 * 1024 // larger media attachments are archived without a mirror
+)
+
+// channel types that have a message history worth archiving
+var archivableTypes = []discord.ChannelType{
+	discord.ChannelTypeGuildText,
+	discord.ChannelTypeGuildNews,
+	discord.ChannelTypeGuildVoice,
+	discord.ChannelTypeGuildNewsThread,
+	discord.ChannelTypeGuildPublicThread,
+	discord.ChannelTypeGuildPrivateThread,
+}
+
+// messageSource is the subset of the rest client used for walking channel history.
+type messageSource interface {
+	GetMessages(channelID snowflake.ID, around snowflake.ID, before snowflake.ID, after snowflake.ID, limit int, opts ...rest.RequestOpt) ([]discord.Message, error)
+}
+
+// Notifier posts a message to the bot channel of a guild, see response.MessageBotChannel.
+type Notifier func(guildID snowflake.ID, messageCreate discord.MessageCreate) (*discord.Message, error)
+
+type Manager struct {
+	mu         sync.Mutex
+	client     *bot.Client
+	notify     Notifier // nil until set, progress messages are skipped
+	started    bool
+	db         *wrap.DB
+	log        *xlog.Logger
+	storageDir string // bundles are written to storageDir/backups
+	tempDir    string // attachment downloads land here before moving into the asset store
+	userAgent  string
+	bundleMu   sync.Mutex // serializes bundle builds so a purge rebuild is never overwritten by a stale one
+	ctx        context.Context
+	cancel     context.CancelFunc
+	closeWG    *sync.WaitGroup // wait group for active work
+}
+
+func NewManager(db *wrap.DB, log *xlog.Logger, storageDir, tempDir, userAgent string) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		db:         db,
+		log:        log,
+		storageDir: storageDir,
+		tempDir:    tempDir,
+		userAgent:  userAgent,
+		ctx:        ctx,
+		cancel:     cancel,
+		closeWG:    &sync.WaitGroup{},
+	}
+}
+
+func (m *Manager) SetClient(client *bot.Client) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.client = client
+}
+
+func (m *Manager) SetNotifier(notify Notifier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notify = notify
+}
+
+// Start begins the scheduler, guilds are checked immediately and then every ScheduleInterval.
+// Safe to call multiple times (guildsReady can fire again after a reconnect).
+func (m *Manager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started || m.client == nil {
+		return
+	}
+	m.started = true
+
+	m.closeWG.Add(1)
+	go func() {
+		defer m.closeWG.Done()
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-timer.C:
+				m.schedule()
+				timer.Reset(ScheduleInterval)
+			}
+		}
+	}()
+}
+
+// Close stops the scheduler, a page in progress is finished before returning.
+// An interrupted run keeps its RunID and is resumed on the next start.
+func (m *Manager) Close() error {
+	m.cancel()
+	m.closeWG.Wait()
+	return nil
+}
+
+// PurgeUser redacts the archived messages of a user who just opted out and rebuilds the
+// existing bundles without them. Runs in the background.
+func (m *Manager) PurgeUser(userID snowflake.ID) {
+	m.closeWG.Add(1)
+	go func() {
+		defer m.closeWG.Done()
+		n, err := database.RedactArchivedMessages(m.db, userID)
+		if err != nil {
+			m.log.Errorf("backup: failed to redact messages of user %s: %v", userID, err)
+			return
+		}
+		m.log.Infof("backup: redacted %d archived messages of user %s", n, userID)
+
+		guilds, err := database.ViewAllGuildsWithChannels(m.db)
+		if err != nil {
+			m.log.Errorf("backup: failed to get guilds: %v", err)
+			return
+		}
+		for _, guild := range guilds {
+			if m.ctx.Err() != nil {
+				return // the archive is already redacted, the next pass rebuilds
+			}
+			if _, err := os.Stat(BundlePath(m.storageDir, guild.ID)); err != nil {
+				continue // nothing built to purge
+			}
+			if err := m.buildBundle(guild); err != nil {
+				m.log.Errorf("backup: failed to rebuild bundle for guild %s: %v", guild.ID, err)
+			}
+		}
+	}()
+}
+
+// ArchiveEdit records an edited message of an archived channel, the previously stored version is
+// kept as a revision. A message that isn't archived yet is stored along with the cached old version
+// when the cache had it, the next pass would only see the new one.
+func (m *Manager) ArchiveEdit(guildID snowflake.ID, old, msg *discord.Message) error {
+	if ok, err := m.IsArchived(guildID, msg.ChannelID); err != nil || !ok {
+		return err
+	}
+	msgs := []discord.Message{*msg}
+	if old != nil && old.ID != 0 {
+		if _, err := database.ViewArchivedMessage(m.db, msg.ID); lmdb.IsNotFound(err) {
+			msgs = []discord.Message{*old, *msg}
+		}
+	}
+	return database.ArchiveMessages(m.db, msg.ChannelID, m.toArchived(guildID, msgs), func(b *database.ChannelBackup) error {
+		return nil
+	})
+}
+
+// ArchiveDelete marks a message of an archived channel as deleted. A message that isn't archived yet
+// is stored from the cache when possible, its attachments are not mirrored as the CDN drops them.
+func (m *Manager) ArchiveDelete(guildID, channelID, messageID snowflake.ID, cached *discord.Message) error {
+	if ok, err := m.IsArchived(guildID, channelID); err != nil || !ok {
+		return err
+	}
+	now := time.Now()
+	found, err := database.MarkArchivedMessageDeleted(m.db, messageID, now)
+	if err != nil || found || cached == nil || cached.ID == 0 {
+		return err
+	}
+	archived := ToArchivedMessage(guildID, cached)
+	archived.Deleted = &now
+	return database.ArchiveMessages(m.db, channelID, []database.ArchivedMessage{archived}, func(b *database.ChannelBackup) error {
+		return nil
+	})
+}
+
+// IsArchived reports whether the channel is backed up.
+func (m *Manager) IsArchived(guildID, channelID snowflake.ID) (bool, error) {
+	guild, err := database.ViewGuild(m.db, guildID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get guild: %w", err)
+	}
+	if !guild.Backup.Enabled {
+		return false, nil
+	}
+	channel, err := database.ViewChannel(m.db, channelID)
+	if err != nil {
+		if lmdb.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get channel: %w", err)
+	}
+	return shouldArchive(*guild, database.ChannelWithID{ID: channelID, Channel: *channel}), nil
+}
+
+// NextRun returns when the next daily run of a guild is due after its last run.
+func NextRun(b database.GuildBackup) time.Time {
+	if b.LastRun.IsZero() {
+		return time.Time{}
+	}
+	last := b.LastRun.UTC()
+	next := time.Date(last.Year(), last.Month(), last.Day(), b.Hour, 0, 0, 0, time.UTC)
+	if !next.After(last) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// isDue reports whether a run should start (or resume) for the guild.
+func isDue(b database.GuildBackup, now time.Time) bool {
+	if !b.Enabled {
+		return false
+	}
+	if b.RunID != "" {
+		return true // interrupted by a crash or restart
+	}
+	return !now.Before(NextRun(b))
+}
+
+// schedule runs every due guild, one at a time.
+func (m *Manager) schedule() {
+	m.mu.Lock()
+	client := m.client
+	m.mu.Unlock()
+
+	guilds, err := database.ViewAllGuildsWithChannels(m.db)
+	if err != nil {
+		m.log.Errorf("backup: failed to get guilds: %v", err)
+		return
+	}
+	for _, guild := range guilds {
+		if m.ctx.Err() != nil {
+			return
+		}
+		if !isDue(guild.Guild.Backup, time.Now()) {
+			continue
+		}
+		m.run(client.Rest, guild)
+	}
+}
+
+// run backs up every enabled channel of the guild under a claimed RunID, keeping the progress in
+// the guild record and the bot channel. If interrupted the RunID stays set so the next check resumes
+// it, the channel cursors make the already archived part cheap to skip.
+func (m *Manager) run(src archiveSource, guild database.GuildWithID) {
+	var lastMessages map[snowflake.ID]snowflake.ID
+	guild.Channels, lastMessages = m.discoverThreads(src, guild)
+	var channels []database.ChannelWithID
+	for _, channel := range guild.Channels {
+		if !shouldArchive(guild.Guild, channel) {
+			continue
+		}
+		if last, ok := lastMessages[channel.ID]; ok && threadUpToDate(channel.Channel, last) {
+			continue
+		}
+		channels = append(channels, channel)
+	}
+
+	// claim
+	var runID string
+	var progress database.BackupProgress
+	resumed := false
+	if _, err := database.UpsertGuild(m.db, guild.ID, func(g *database.Guild) error {
+		if g.Backup.RunID == "" {
+			g.Backup.RunID = strings.ToLower(rand.Text()[:10])
+			g.Backup.Progress = database.BackupProgress{Started: time.Now()}
+		} else {
+			resumed = true
+			g.Backup.Progress.ChannelsDone = 0 // every channel is walked again
+		}
+		g.Backup.Progress.ChannelsTotal = len(channels)
+		runID, progress = g.Backup.RunID, g.Backup.Progress
+		return nil
+	}); err != nil {
+		m.log.Errorf("backup: failed to claim run for guild %s: %v", guild.ID, err)
+		return
+	}
+	if resumed {
+		m.log.Infof("backup: resuming run %s for guild %s (%s)", runID, guild.Guild.Name, guild.ID)
+	} else {
+		m.log.Infof("backup: starting run %s for guild %s (%s)", runID, guild.Guild.Name, guild.ID)
+	}
+	progress = m.report(guild.ID, runID, progress, false)
+
+	for _, channel := range channels {
+		if m.ctx.Err() != nil {
+			return
+		}
+		n, err := m.backupChannel(src, guild.ID, channel.ID)
+		if m.ctx.Err() != nil {
+			return
+		}
+		progress.ChannelsDone++
+		progress.Messages += n
+		if err != nil {
+			// likely missing access, keep going with the other channels
+			m.log.Errorf("backup: channel %s (%s): %v", channel.Channel.Name, channel.ID, err)
+			progress.Errors++
+		} else {
+			m.log.Debugf("backup: channel %s (%s) archived %d messages", channel.Channel.Name, channel.ID, n)
+		}
+		progress = m.report(guild.ID, runID, progress, false)
+	}
+
+	if err := m.buildBundle(guild); err != nil {
+		m.log.Errorf("backup: failed to build bundle for guild %s: %v", guild.ID, err)
+		progress.Errors++
+	}
+	progress = m.report(guild.ID, runID, progress, true)
+	if _, err := database.UpsertGuild(m.db, guild.ID, func(g *database.Guild) error {
+		g.Backup.RunID = ""
+		g.Backup.LastRun = time.Now()
+		return nil
+	}); err != nil {
+		m.log.Errorf("backup: failed to finish run for guild %s: %v", guild.ID, err)
+	}
+	m.log.Infof("backup: finished run %s for guild %s (%s), archived %d messages, %d errors", runID, guild.Guild.Name, guild.ID, progress.Messages, progress.Errors)
+}
+
+// report saves the progress of a run and posts or edits the progress message in the bot channel.
+// Returns the progress with the message set.
+func (m *Manager) report(guildID snowflake.ID, runID string, progress database.BackupProgress, done bool) database.BackupProgress {
+	m.mu.Lock()
+	client, notify := m.client, m.notify
+	m.mu.Unlock()
+
+	if notify != nil {
+		content := ProgressContent(runID, progress, done)
+		edited := false
+		if progress.MessageID != 0 {
+			if _, err := client.Rest.UpdateMessage(progress.ChannelID, progress.MessageID, discord.NewMessageUpdateBuilder().SetContent(content).Build()); err != nil {
+				m.log.Debugf("backup: failed to edit progress message, posting a new one: %v", err)
+			} else {
+				edited = true
+			}
+		}
+		if !edited {
+			if msg, err := notify(guildID, discord.NewMessageCreateBuilder().SetContent(content).Build()); err != nil {
+				m.log.Warnf("backup: failed to post progress for guild %s: %v", guildID, err)
+			} else {
+				progress.ChannelID, progress.MessageID = msg.ChannelID, msg.ID
+			}
+		}
+	}
+
+	if _, err := database.UpsertGuild(m.db, guildID, func(g *database.Guild) error {
+		g.Backup.Progress = progress
+		return nil
+	}); err != nil {
+		m.log.Errorf("backup: failed to save progress for guild %s: %v", guildID, err)
+	}
+	return progress
+}
+
+// ProgressContent formats the progress message of a run.
+func ProgressContent(runID string, p database.BackupProgress, done bool) string {
+	state := "in progress"
+	if done {
+		state = "finished"
+	}
+	return fmt.Sprintf("**Backup %s** `%s`\nChannels: %d/%d • Messages: %d • Errors: %d\nStarted <t:%d:R>",
+		state, runID, p.ChannelsDone, p.ChannelsTotal, p.Messages, p.Errors, p.Started.Unix())
+}
+
+func shouldArchive(guild database.Guild, channel database.ChannelWithID) bool {
+	return channel.Channel.Backup.Enabled &&
+		!channel.Channel.Deleted &&
+		channel.ID != guild.BotChannelID &&
+		slices.Contains(archivableTypes, channel.Channel.Type)
+}
+
+// backupChannel walks the channel history forward from Head and backward from Tail,
+// committing each page along with the moved cursor. Returns the number of archived messages.
+func (m *Manager) backupChannel(src messageSource, guildID, channelID snowflake.ID) (int, error) {
+	channel, err := database.ViewChannel(m.db, channelID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get channel: %w", err)
+	}
+	cursors := channel.Backup
+
+	// first run, both walks start at now
+	if cursors.Ceil == 0 {
+		ceil := snowflake.New(time.Now())
+		if err := database.ArchiveMessages(m.db, channelID, nil, func(b *database.ChannelBackup) error {
+			b.Ceil, b.Head, b.Tail = ceil, ceil, ceil
+			return nil
+		}); err != nil {
+			return 0, fmt.Errorf("failed to init cursors: %w", err)
+		}
+		cursors.Ceil, cursors.Head, cursors.Tail = ceil, ceil, ceil
+	}
+
+	total := 0
+
+	// forward, new messages since the last pass
+	for {
+		msgs, err := src.GetMessages(channelID, 0, 0, cursors.Head, PageSize, rest.WithCtx(m.ctx))
+		if err != nil {
+			return total, fmt.Errorf("failed to get messages after %s: %w", cursors.Head, err)
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		head := cursors.Head
+		for _, msg := range msgs {
+			head = max(head, msg.ID)
+		}
+		if err := database.ArchiveMessages(m.db, channelID, m.toArchived(guildID, msgs), func(b *database.ChannelBackup) error {
+			b.Head = head
+			return nil
+		}); err != nil {
+			return total, err
+		}
+		cursors.Head = head
+		total += len(msgs)
+		if len(msgs) < PageSize || !m.sleep() {
+			break
+		}
+	}
+
+	// backward, history before the first run
+	for !cursors.Complete {
+		if skipImported(&cursors) {
+			if err := database.ArchiveMessages(m.db, channelID, nil, func(b *database.ChannelBackup) error {
+				skipImported(b)
+				return nil
+			}); err != nil {
+				return total, err
+			}
+			continue
+		}
+		msgs, err := src.GetMessages(channelID, 0, cursors.Tail, 0, PageSize, rest.WithCtx(m.ctx))
+		if err != nil {
+			return total, fmt.Errorf("failed to get messages before %s: %w", cursors.Tail, err)
+		}
+		tail := cursors.Tail
+		for _, msg := range msgs {
+			tail = min(tail, msg.ID)
+		}
+		complete := len(msgs) < PageSize
+		if err := database.ArchiveMessages(m.db, channelID, m.toArchived(guildID, msgs), func(b *database.ChannelBackup) error {
+			b.Tail = tail
+			b.Complete = complete
+			return nil
+		}); err != nil {
+			return total, err
+		}
+		cursors.Tail, cursors.Complete = tail, complete
+		total += len(msgs)
+		if !complete && !m.sleep() {
+			break
+		}
+	}
+
+	return total, nil
+}
+
+// skipImported moves Tail to the end of a pending imported range once the backward walk
+// reached it, everything in between is already archived. Returns true if Tail moved.
+func skipImported(b *database.ChannelBackup) bool {
+	if b.ImportHead == 0 || b.Tail > b.ImportHead || b.Tail <= b.ImportTail {
+		return false
+	}
+	b.Tail, b.Complete = b.ImportTail, b.ImportComplete
+	b.ImportHead, b.ImportTail, b.ImportComplete = 0, 0, false
+	return true
+}
+
+// sleep waits PageDelay, returns false if the manager was closed in the meantime.
+func (m *Manager) sleep() bool {
+	select {
+	case <-m.ctx.Done():
+		return false
+	case <-time.After(PageDelay):
+		return true
+	}
+}
+
+// toArchived converts a page of messages, mirroring their media attachments into the asset store.
+// Attachments of opted out users are not downloaded, their messages are redacted when archived anyway.
+func (m *Manager) toArchived(guildID snowflake.ID, msgs []discord.Message) []database.ArchivedMessage {
+	out := make([]database.ArchivedMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		archived := ToArchivedMessage(guildID, &msg)
+		if len(msg.Attachments) > 0 && !m.optedOut(msg.Author.ID) {
+			for i, att := range msg.Attachments {
+				if m.ctx.Err() != nil {
+					break
+				}
+				if attachments.IsMedia(att) {
+					archived.Attachments[i].Asset = m.mirrorAttachment(guildID, att)
+				}
+			}
+		}
+		out = append(out, archived)
+	}
+	return out
+}
+
+func (m *Manager) optedOut(userID snowflake.ID) bool {
+	user, err := database.ViewUser(m.db, userID)
+	return err == nil && user.BackupOptOut
+}
+
+// mirrorAttachment downloads a media attachment into the asset store and returns the asset name.
+// CDN urls carry expiring signature params, so assets are keyed by the url without its query,
+// an attachment that was already mirrored (e.g. the message was edited) is not downloaded again.
+// Failures are logged and return "", the message is still archived with the CDN url.
+func (m *Manager) mirrorAttachment(guildID snowflake.ID, att discord.Attachment) string {
+	key := AttachmentKey(att.URL)
+	if asset, err := database.ViewAsset(m.db, key); err == nil && asset.Path != "" {
+		if _, err := os.Stat(asset.Path); err == nil {
+			return filepath.Base(asset.Path)
+		}
+	}
+	if att.Size > MaxAttachmentSize {
+		m.log.Debugf("backup: attachment %s is too large to mirror (%d bytes)", att.ID, att.Size)
+		return ""
+	}
+
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(att.Filename)), ".")
+	if ext == "" {
+		ext = "bin"
+	}
+	file, err := download.DownloadWithPlan(download.DownloadPlan{
+		URL:       att.URL,
+		Ext:       ext,
+		OutputExt: ext,
+		Strategy:  download.StrategyDirect, // exact bytes, no remuxing
+	}, m.tempDir, m.userAgent, 0)
+	if err != nil {
+		m.log.Warnf("backup: failed to download attachment %s: %v", att.ID, err)
+		return ""
+	}
+	assetName, err := database.StoreAsset(m.db, m.storageDir, guildID, key, file.Path, file.SHA256)
+	if err != nil {
+		os.Remove(file.Path)
+		m.log.Errorf("backup: failed to store attachment %s: %v", att.ID, err)
+		return ""
+	}
+	return assetName
+}
+
+// AttachmentKey strips the query and fragment from a CDN url, mirrored attachments are stored
+// under it.
+func AttachmentKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return u.String()
+}
+
+// ToArchivedMessage converts a discord message into its stored form.
+func ToArchivedMessage(guildID snowflake.ID, msg *discord.Message) database.ArchivedMessage {
+	archived := database.ArchivedMessage{
+		ID:          msg.ID,
+		GuildID:     guildID,
+		ChannelID:   msg.ChannelID,
+		AuthorID:    msg.Author.ID,
+		Author:      msg.Author.Username,
+		Content:     msg.Content,
+		Attachments: make([]database.ArchivedAttachment, 0, len(msg.Attachments)),
+		Created:     msg.CreatedAt,
+		Edited:      msg.EditedTimestamp,
+	}
+	if msg.MessageReference != nil && msg.MessageReference.MessageID != nil {
+		archived.ReplyTo = *msg.MessageReference.MessageID
+	}
+	for _, att := range msg.Attachments {
+		contentType := ""
+		if att.ContentType != nil {
+			contentType = *att.ContentType
+		}
+		archived.Attachments = append(archived.Attachments, database.ArchivedAttachment{
+			Filename:    att.Filename,
+			URL:         att.URL,
+			ContentType: contentType,
+			Size:        att.Size,
+		})
+	}
+	return archived
+}
@@ -0,0 +1,405 @@
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sprout/internal/platform/database"
+	"sprout/pkg/aeszip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// fakeSource serves a fixed channel history the same way the discord API does.
+type fakeSource struct {
+	ids         []snowflake.ID // ascending
+	attachments map[snowflake.ID][]discord.Attachment
+	calls       int
+}
+
+func (f *fakeSource) GetMessages(channelID, around, before, after snowflake.ID, limit int, opts ...rest.RequestOpt) ([]discord.Message, error) {
+	f.calls++
+	var page []snowflake.ID
+	switch {
+	case after != 0: // oldest messages after the ID
+		for _, id := range f.ids {
+			if id > after && len(page) < limit {
+				page = append(page, id)
+			}
+		}
+	case before != 0: // newest messages before the ID
+		for i := len(f.ids) - 1; i >= 0; i-- {
+			if f.ids[i] < before && len(page) < limit {
+				page = append(page, f.ids[i])
+			}
+		}
+	}
+	slices.Sort(page)
+	slices.Reverse(page) // discord returns newest first
+	msgs := make([]discord.Message, 0, len(page))
+	for _, id := range page {
+		msgs = append(msgs, discord.Message{ID: id, ChannelID: channelID, Content: id.String(), CreatedAt: id.Time(), Attachments: f.attachments[id]})
+	}
+	return msgs, nil
+}
+
+func (f *fakeSource) GetActiveGuildThreads(guildID snowflake.ID, opts ...rest.RequestOpt) (*discord.GuildActiveThreads, error) {
+	return &discord.GuildActiveThreads{}, nil
+}
+
+func (f *fakeSource) GetPublicArchivedThreads(channelID snowflake.ID, before time.Time, limit int, opts ...rest.RequestOpt) (*discord.GetThreads, error) {
+	return &discord.GetThreads{}, nil
+}
+
+func (f *fakeSource) GetPrivateArchivedThreads(channelID snowflake.ID, before time.Time, limit int, opts ...rest.RequestOpt) (*discord.GetThreads, error) {
+	return &discord.GetThreads{}, nil
+}
+
+func (f *fakeSource) add(t time.Time, n int) {
+	for i := range n {
+		f.ids = append(f.ids, snowflake.New(t.Add(time.Duration(i)*time.Second)))
+	}
+}
+
+func TestBackupChannel(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	guildID := snowflake.New(time.Now().Add(-1000 * time.Hour))
+	channelID := snowflake.New(time.Now().Add(-999 * time.Hour))
+	if _, err := database.UpsertChannel(db, channelID, func(c *database.Channel) error {
+		c.GuildID = guildID
+		c.Type = discord.ChannelTypeGuildText
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &Manager{db: db, log: logger, ctx: ctx, cancel: cancel, closeWG: &sync.WaitGroup{}}
+
+	// history before the first run
+	src := &fakeSource{}
+	src.add(time.Now().Add(-100*time.Hour), 250)
+
+	t.Run("First Run", func(t *testing.T) {
+		n, err := m.backupChannel(src, guildID, channelID)
+		if err != nil {
+			t.Fatalf("backupChannel() failed: %v", err)
+		}
+		if n != 250 {
+			t.Errorf("Expected 250 archived messages, got %d", n)
+		}
+		ch, err := database.ViewChannel(db, channelID)
+		if err != nil {
+			t.Fatalf("Failed to view channel: %v", err)
+		}
+		if !ch.Backup.Complete {
+			t.Errorf("Expected backward walk to be complete")
+		}
+		if ch.Backup.Tail != src.ids[0] {
+			t.Errorf("Expected Tail %s, got %s", src.ids[0], ch.Backup.Tail)
+		}
+		if ch.Backup.Ceil == 0 || ch.Backup.Head != ch.Backup.Ceil {
+			t.Errorf("Expected Head to equal Ceil, got Head %s Ceil %s", ch.Backup.Head, ch.Backup.Ceil)
+		}
+	})
+
+	// new messages after the first run
+	src.add(time.Now().Add(time.Minute), 120)
+
+	t.Run("Forward Walk", func(t *testing.T) {
+		calls := src.calls
+		n, err := m.backupChannel(src, guildID, channelID)
+		if err != nil {
+			t.Fatalf("backupChannel() failed: %v", err)
+		}
+		if n != 120 {
+			t.Errorf("Expected 120 archived messages, got %d", n)
+		}
+		if src.calls-calls != 2 {
+			t.Errorf("Expected 2 requests, got %d", src.calls-calls)
+		}
+		ch, err := database.ViewChannel(db, channelID)
+		if err != nil {
+			t.Fatalf("Failed to view channel: %v", err)
+		}
+		if last := src.ids[len(src.ids)-1]; ch.Backup.Head != last {
+			t.Errorf("Expected Head %s, got %s", last, ch.Backup.Head)
+		}
+	})
+
+	t.Run("Archived Content", func(t *testing.T) {
+		for _, id := range []snowflake.ID{src.ids[0], src.ids[200], src.ids[len(src.ids)-1]} {
+			msg, err := database.ViewArchivedMessage(db, id)
+			if err != nil {
+				t.Fatalf("Failed to view archived message %s: %v", id, err)
+			}
+			if msg.Content != id.String() || msg.GuildID != guildID || msg.ChannelID != channelID {
+				t.Errorf("Unexpected archived message: %+v", msg)
+			}
+		}
+	})
+
+	t.Run("Bundle", func(t *testing.T) {
+		m.storageDir = tmpDir
+		if _, err := database.UpsertGuild(db, guildID, func(g *database.Guild) error {
+			g.Name = "test"
+			g.Backup.Password = "hunter2"
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to create guild: %v", err)
+		}
+		guilds, err := database.ViewAllGuildsWithChannels(db)
+		if err != nil || len(guilds) != 1 {
+			t.Fatalf("Failed to view guilds: %v", err)
+		}
+		if err := m.buildBundle(guilds[0]); err != nil {
+			t.Fatalf("buildBundle() failed: %v", err)
+		}
+		zr, err := zip.OpenReader(BundlePath(tmpDir, guildID))
+		if err != nil {
+			t.Fatalf("Failed to open bundle: %v", err)
+		}
+		defer zr.Close()
+		var names []string
+		for _, f := range zr.File {
+			if f.Method != aeszip.MethodAES {
+				t.Errorf("Entry %s is not encrypted", f.Name)
+			}
+			names = append(names, f.Name)
+		}
+		want := []string{"guild.json", "messages/" + channelID.String() + ".json"}
+		if !slices.Equal(names, want) {
+			t.Errorf("Expected entries %v, got %v", want, names)
+		}
+	})
+	t.Run("Attachments", func(t *testing.T) {
+		hits := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits++
+			w.Write([]byte("\x89PNG fake image"))
+		}))
+		defer srv.Close()
+		m.tempDir = tmpDir
+
+		// the same attachment seen twice with different CDN signatures
+		src.add(time.Now().Add(10*time.Minute), 2)
+		newIDs := src.ids[len(src.ids)-2:]
+		src.attachments = map[snowflake.ID][]discord.Attachment{
+			newIDs[0]: {{Filename: "cat.PNG", URL: srv.URL + "/attachments/1/2/cat.PNG?ex=1"}},
+			newIDs[1]: {{Filename: "cat.PNG", URL: srv.URL + "/attachments/1/2/cat.PNG?ex=2"}, {Filename: "notes.txt", URL: srv.URL + "/notes.txt"}},
+		}
+		if _, err := m.backupChannel(src, guildID, channelID); err != nil {
+			t.Fatalf("backupChannel() failed: %v", err)
+		}
+		if hits != 1 {
+			t.Errorf("Expected 1 download, got %d", hits)
+		}
+		var names []string
+		for _, id := range newIDs {
+			msg, err := database.ViewArchivedMessage(db, id)
+			if err != nil {
+				t.Fatalf("Failed to view archived message %s: %v", id, err)
+			}
+			names = append(names, msg.Attachments[0].Asset)
+		}
+		if names[0] == "" || names[0] != names[1] || filepath.Ext(names[0]) != ".png" {
+			t.Fatalf("Expected both messages to reference the same asset, got %v", names)
+		}
+		if _, err := os.Stat(database.ToAssetPath(filepath.Join(tmpDir, "assets"), names[0])); err != nil {
+			t.Errorf("Expected asset on disk: %v", err)
+		}
+		if msg, _ := database.ViewArchivedMessage(db, newIDs[1]); msg.Attachments[1].Asset != "" {
+			t.Errorf("Expected non-media attachment to not be mirrored")
+		}
+	})
+}
+
+func TestIsDue(t *testing.T) {
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		backup database.GuildBackup
+		now    time.Time
+		want   bool
+	}{
+		{"Disabled", database.GuildBackup{}, day, false},
+		{"Never Run", database.GuildBackup{Enabled: true}, day, true},
+		{"Interrupted", database.GuildBackup{Enabled: true, RunID: "x", LastRun: day}, day.Add(time.Hour), true},
+		{"Before Hour", database.GuildBackup{Enabled: true, Hour: 3, LastRun: day.Add(3 * time.Hour)}, day.Add(26 * time.Hour), false},
+		{"At Hour", database.GuildBackup{Enabled: true, Hour: 3, LastRun: day.Add(3 * time.Hour)}, day.Add(27 * time.Hour), true},
+		{"Later Same Day", database.GuildBackup{Enabled: true, Hour: 20, LastRun: day.Add(3 * time.Hour)}, day.Add(20 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDue(tt.backup, tt.now); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	guildID := snowflake.New(time.Now().Add(-1000 * time.Hour))
+	channelID := snowflake.New(time.Now().Add(-999 * time.Hour))
+	if _, err := database.UpsertChannel(db, channelID, func(c *database.Channel) error {
+		c.GuildID = guildID
+		c.Type = discord.ChannelTypeGuildText
+		c.Backup.Enabled = true
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+	// left behind by a crash
+	started := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if _, err := database.UpsertGuild(db, guildID, func(g *database.Guild) error {
+		g.Backup.Enabled = true
+		g.Backup.RunID = "interrupted"
+		g.Backup.Progress = database.BackupProgress{Started: started, ChannelsDone: 1, Messages: 40, Errors: 1}
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to create guild: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &Manager{db: db, log: logger, storageDir: tmpDir, ctx: ctx, cancel: cancel, closeWG: &sync.WaitGroup{}}
+	src := &fakeSource{}
+	src.add(time.Now().Add(-10*time.Hour), 30)
+
+	guilds, err := database.ViewAllGuildsWithChannels(db)
+	if err != nil || len(guilds) != 1 {
+		t.Fatalf("Failed to view guilds: %v", err)
+	}
+	m.run(src, guilds[0])
+
+	guild, err := database.ViewGuild(db, guildID)
+	if err != nil {
+		t.Fatalf("Failed to view guild: %v", err)
+	}
+	if guild.Backup.RunID != "" || guild.Backup.LastRun.IsZero() {
+		t.Errorf("Expected run to be finished, got RunID %q LastRun %v", guild.Backup.RunID, guild.Backup.LastRun)
+	}
+	want := database.BackupProgress{Started: started, ChannelsDone: 1, ChannelsTotal: 1, Messages: 70, Errors: 1}
+	if got := guild.Backup.Progress; !got.Started.Equal(want.Started) || got.ChannelsDone != want.ChannelsDone ||
+		got.ChannelsTotal != want.ChannelsTotal || got.Messages != want.Messages || got.Errors != want.Errors {
+		t.Errorf("Expected progress %+v, got %+v", want, got)
+	}
+}
+
+func TestArchiveEditDelete(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	base := time.Now().Add(-1000 * time.Hour)
+	guildID, archivedID, skippedID := snowflake.New(base), snowflake.New(base.Add(time.Second)), snowflake.New(base.Add(2*time.Second))
+	if _, err := database.UpsertGuild(db, guildID, func(g *database.Guild) error {
+		g.Backup.Enabled = true
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to create guild: %v", err)
+	}
+	for _, id := range []snowflake.ID{archivedID, skippedID} {
+		if _, err := database.UpsertChannel(db, id, func(c *database.Channel) error {
+			c.GuildID = guildID
+			c.Type = discord.ChannelTypeGuildText
+			c.Backup.Enabled = id == archivedID
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to create channel: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &Manager{db: db, log: logger, ctx: ctx, cancel: cancel, closeWG: &sync.WaitGroup{}}
+	message := func(channelID snowflake.ID, offset time.Duration, content string) *discord.Message {
+		id := snowflake.New(base.Add(time.Hour + offset))
+		return &discord.Message{ID: id, ChannelID: channelID, Content: content, CreatedAt: id.Time()}
+	}
+
+	t.Run("Edit Before Pass", func(t *testing.T) {
+		old := message(archivedID, 0, "before")
+		edited := *old
+		edited.Content = "after"
+		if err := m.ArchiveEdit(guildID, old, &edited); err != nil {
+			t.Fatalf("ArchiveEdit() failed: %v", err)
+		}
+		got, err := database.ViewArchivedMessage(db, old.ID)
+		if err != nil {
+			t.Fatalf("Failed to view archived message: %v", err)
+		}
+		if got.Content != "after" || len(got.Revisions) != 1 || got.Revisions[0].Content != "before" {
+			t.Errorf("Expected the cached version as a revision, got %+v", got)
+		}
+	})
+
+	t.Run("Delete Cached", func(t *testing.T) {
+		cached := message(archivedID, time.Second, "gone")
+		if err := m.ArchiveDelete(guildID, archivedID, cached.ID, cached); err != nil {
+			t.Fatalf("ArchiveDelete() failed: %v", err)
+		}
+		got, err := database.ViewArchivedMessage(db, cached.ID)
+		if err != nil {
+			t.Fatalf("Failed to view archived message: %v", err)
+		}
+		if got.Content != "gone" || got.Deleted == nil {
+			t.Errorf("Expected a deleted message with its content, got %+v", got)
+		}
+	})
+
+	t.Run("Channel Not Archived", func(t *testing.T) {
+		msg := message(skippedID, 2*time.Second, "private")
+		if err := m.ArchiveEdit(guildID, nil, msg); err != nil {
+			t.Fatalf("ArchiveEdit() failed: %v", err)
+		}
+		if err := m.ArchiveDelete(guildID, skippedID, msg.ID, msg); err != nil {
+			t.Fatalf("ArchiveDelete() failed: %v", err)
+		}
+		if _, err := database.ViewArchivedMessage(db, msg.ID); err == nil {
+			t.Errorf("Expected message of a channel without backups to not be archived")
+		}
+	})
+}
@@ -0,0 +1,243 @@
+package backup
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/download/extractors"
+	"sprout/pkg/aeszip"
+	"time"
+
+	"github.com/Data-Corruption/lmdb-go/lmdb"
+	"github.com/Data-Corruption/lmdb-go/wrap"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+var urlRegex = regexp.MustCompile(`https?://[^\s<>]+`)
+
+// BundlePath returns the path of the encrypted backup bundle for a guild.
+func BundlePath(storageDir string, guildID snowflake.ID) string {
+	return filepath.Join(storageDir, "backups", guildID.String()+".zip")
+}
+
+type bundleChannel struct {
+	ID       snowflake.ID        `json:"id"`
+	Name     string              `json:"name"`
+	Type     discord.ChannelType `json:"type"`
+	ParentID snowflake.ID        `json:"parentID"`
+	Deleted  bool                `json:"deleted"`
+	File     string              `json:"file"` // path of the messages file in the bundle, empty if none
+}
+
+// bundleIndex is written to guild.json at the root of the bundle.
+type bundleIndex struct {
+	ID       snowflake.ID      `json:"id"`
+	Name     string            `json:"name"`
+	Created  time.Time         `json:"created"`
+	Channels []bundleChannel   `json:"channels"` // in discord order
+	Assets   map[string]string `json:"assets"`   // source url -> path of the mirror in the bundle
+}
+
+// buildBundle writes every archived message of the guild along with the assets they reference
+// into an encrypted zip at BundlePath. The previous bundle is replaced once the new one is complete.
+// Without a password there is no bundle, an old one is removed.
+func (m *Manager) buildBundle(guild database.GuildWithID) error {
+	m.bundleMu.Lock()
+	defer m.bundleMu.Unlock()
+
+	// GuildWithID has the password blanked
+	full, err := database.ViewGuild(m.db, guild.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get guild: %w", err)
+	}
+	dest := BundlePath(m.storageDir, guild.ID)
+	password := full.Backup.Password
+	if password == "" {
+		m.log.Warnf("backup: guild %s (%s) has no backup password, skipping bundle", guild.Guild.Name, guild.ID)
+		if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old bundle: %w", err)
+		}
+		return nil
+	}
+
+	archive, err := loadGuildArchive(m.db, m.storageDir, guild.ID)
+	if err != nil {
+		return err
+	}
+
+	index := bundleIndex{
+		ID:       guild.ID,
+		Name:     guild.Guild.Name,
+		Created:  time.Now(),
+		Channels: channelList(guild, archive.byChannel),
+		Assets:   make(map[string]string),
+	}
+
+	// assets are deduplicated by name
+	assets := make(map[string]string) // bundle path -> path on disk
+	for u, path := range archive.assets {
+		name := "assets/" + filepath.Base(path)
+		assets[name] = path
+		index.Assets[u] = name
+	}
+	for i, ch := range index.Channels {
+		if _, ok := archive.byChannel[ch.ID]; ok {
+			index.Channels[i].File = fmt.Sprintf("messages/%s.json", ch.ID)
+		}
+	}
+
+	// write to a temp file next to the destination so the swap is atomic
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return fmt.Errorf("failed to create backups dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), guild.ID.String()+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after rename
+	defer tmp.Close()
+
+	zw := aeszip.NewWriter(tmp, password)
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := zw.Deflate("guild.json", index.Created, data); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	total := 0
+	for _, ch := range index.Channels {
+		msgs := archive.byChannel[ch.ID]
+		if len(msgs) == 0 {
+			continue
+		}
+		data, err := json.Marshal(msgs)
+		if err != nil {
+			return err
+		}
+		if err := zw.Deflate(ch.File, index.Created, data); err != nil {
+			return fmt.Errorf("failed to write channel %s: %w", ch.ID, err)
+		}
+		total += len(msgs)
+	}
+
+	for name, path := range assets {
+		f, err := os.Open(path)
+		if err != nil {
+			// the asset may have been removed from disk, the rest of the bundle is still useful
+			m.log.Warnf("backup: failed to open asset %s: %v", path, err)
+			continue
+		}
+		err = addFile(zw, name, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write asset %s: %w", name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish zip: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return fmt.Errorf("failed to move bundle: %w", err)
+	}
+
+	m.log.Infof("backup: built bundle for guild %s (%s), %d messages, %d assets", guild.Guild.Name, guild.ID, total, len(assets))
+	return nil
+}
+
+// guildArchive is every archived message of a guild along with the assets they reference.
+type guildArchive struct {
+	byChannel map[snowflake.ID][]database.ArchivedMessage // oldest first
+	assets    map[string]string                           // source url -> path on disk
+}
+
+// loadGuildArchive reads the archive of a guild, resolving the anti-rot mirrors of linked urls
+// and the mirrored attachments.
+//
+// WARNING: Starts transactions. Avoid nesting transactions (deadlock risk).
+func loadGuildArchive(db *wrap.DB, storageDir string, guildID snowflake.ID) (*guildArchive, error) {
+	archive := &guildArchive{
+		byChannel: make(map[snowflake.ID][]database.ArchivedMessage),
+		assets:    make(map[string]string),
+	}
+
+	// collect messages and linked urls
+	urls := make(map[string]struct{})
+	if err := database.ViewArchivedMessages(db, func(msg *database.ArchivedMessage) error {
+		if msg.GuildID != guildID {
+			return nil
+		}
+		archive.byChannel[msg.ChannelID] = append(archive.byChannel[msg.ChannelID], *msg)
+		for _, u := range urlRegex.FindAllString(msg.Content, -1) {
+			urls[u] = struct{}{}
+		}
+		// mirrored attachments already know their asset
+		for _, att := range msg.Attachments {
+			if att.Asset != "" {
+				archive.assets[att.URL] = database.ToAssetPath(filepath.Join(storageDir, "assets"), att.Asset)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	for _, msgs := range archive.byChannel {
+		slices.SortFunc(msgs, func(a, b database.ArchivedMessage) int {
+			return cmp.Compare(a.ID, b.ID)
+		})
+	}
+
+	// resolve anti-rot mirrors
+	for u := range urls {
+		asset, err := database.ViewAsset(db, extractors.Canonical(u))
+		if err != nil {
+			if lmdb.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get asset: %w", err)
+		}
+		if asset.Path != "" {
+			archive.assets[u] = asset.Path
+		}
+	}
+	return archive, nil
+}
+
+// channelList returns the channels of the guild in discord order, then any leftovers in the
+// archive whose channel record is gone.
+func channelList(guild database.GuildWithID, byChannel map[snowflake.ID][]database.ArchivedMessage) []bundleChannel {
+	var channels []bundleChannel
+	for _, ch := range guild.Channels {
+		channels = append(channels, bundleChannel{ID: ch.ID, Name: ch.Channel.Name, Type: ch.Channel.Type, ParentID: ch.Channel.ParentID, Deleted: ch.Channel.Deleted})
+	}
+	var leftovers []snowflake.ID
+	for id := range byChannel {
+		if !slices.ContainsFunc(channels, func(c bundleChannel) bool { return c.ID == id }) {
+			leftovers = append(leftovers, id)
+		}
+	}
+	slices.Sort(leftovers)
+	for _, id := range leftovers {
+		channels = append(channels, bundleChannel{ID: id, Deleted: true})
+	}
+	return channels
+}
+
+func addFile(zw *aeszip.Writer, name string, f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return zw.Store(name, info.ModTime(), f, info.Size())
+}
@@ -0,0 +1,279 @@
+package backup
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database"
+	"strings"
+	"time"
+
+	"github.com/Data-Corruption/lmdb-go/wrap"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const SitePageSize = 250 // messages per page of an exported channel
+
+//go:embed site
+var siteFS embed.FS
+
+var siteTmpl = template.Must(template.ParseFS(siteFS, "site/site.html"))
+
+// ExportStats summarizes an export.
+type ExportStats struct {
+	Channels int
+	Pages    int
+	Messages int
+	Assets   int
+}
+
+type siteChannel struct {
+	Name     string
+	Category bool
+	Deleted  bool
+	File     string // first page, empty if nothing is archived
+	Messages int
+}
+
+type sitePage struct {
+	Number  int
+	File    string
+	Current bool
+}
+
+type siteAttachment struct {
+	Filename string
+	Src      string
+	Kind     string // image, video or file
+}
+
+type siteMessage struct {
+	ID          snowflake.ID
+	Author      string
+	Content     template.HTML
+	Created     time.Time
+	Edited      bool
+	Redacted    bool
+	ReplyTo     snowflake.ID
+	ReplyLink   string // empty if the replied to message isn't archived
+	ReplyAuthor string
+	Attachments []siteAttachment
+}
+
+// ExportSite renders the archive of a guild into a self-contained static site at outDir.
+// index.html lists the channels in discord order, each channel gets paginated pages in
+// channels/ and every referenced asset is copied into assets/ so the site works offline.
+//
+// WARNING: Starts transactions. Avoid nesting transactions (deadlock risk).
+func ExportSite(db *wrap.DB, storageDir string, guildID snowflake.ID, outDir string) (*ExportStats, error) {
+	guilds, err := database.ViewAllGuildsWithChannels(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guilds: %w", err)
+	}
+	var guild *database.GuildWithID
+	for i := range guilds {
+		if guilds[i].ID == guildID {
+			guild = &guilds[i]
+			break
+		}
+	}
+	if guild == nil {
+		return nil, fmt.Errorf("guild %s not found", guildID)
+	}
+
+	archive, err := loadGuildArchive(db, storageDir, guildID)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range []string{"channels", "assets"} {
+		if err := os.MkdirAll(filepath.Join(outDir, dir), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create output dir: %w", err)
+		}
+	}
+	stats := &ExportStats{}
+
+	// copy assets, a missing file only loses that mirror
+	assets := make(map[string]string) // source url -> path relative to a channel page
+	for u, path := range archive.assets {
+		name := filepath.Base(path)
+		dest := filepath.Join(outDir, "assets", name)
+		if _, err := os.Stat(dest); err != nil {
+			if err := copyFile(path, dest); err != nil {
+				continue
+			}
+			stats.Assets++
+		}
+		assets[u] = "../assets/" + name
+	}
+
+	// page of every message for reply links
+	pageOf := make(map[snowflake.ID]string)
+	authorOf := make(map[snowflake.ID]string)
+	for channelID, msgs := range archive.byChannel {
+		for i, msg := range msgs {
+			pageOf[msg.ID] = pageFile(channelID, i/SitePageSize+1)
+			authorOf[msg.ID] = msg.Author
+		}
+	}
+
+	channels := channelList(*guild, archive.byChannel)
+	index := make([]siteChannel, 0, len(channels))
+	for _, ch := range channels {
+		name := ch.Name
+		if name == "" {
+			name = ch.ID.String()
+		}
+		msgs := archive.byChannel[ch.ID]
+		sc := siteChannel{Name: name, Category: ch.Type == discord.ChannelTypeGuildCategory, Deleted: ch.Deleted, Messages: len(msgs)}
+		if len(msgs) > 0 {
+			sc.File = pageFile(ch.ID, 1)
+			n, err := writeChannel(outDir, guild.Guild.Name, name, ch.ID, msgs, pageOf, authorOf, assets)
+			if err != nil {
+				return nil, err
+			}
+			stats.Channels++
+			stats.Pages += n
+			stats.Messages += len(msgs)
+		}
+		// categories without messages are only headers, other empty channels are skipped
+		if sc.Category || sc.File != "" {
+			index = append(index, sc)
+		}
+	}
+
+	if err := writePage(filepath.Join(outDir, "index.html"), "index", map[string]any{
+		"Title":    guild.Guild.Name + " - Archive",
+		"Root":     "",
+		"Guild":    guild.Guild.Name,
+		"Exported": time.Now(),
+		"Channels": index,
+	}); err != nil {
+		return nil, err
+	}
+	if err := copyEmbedded("site/style.css", filepath.Join(outDir, "style.css")); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// writeChannel renders the pages of a channel, returns the number of pages written.
+func writeChannel(outDir, guildName, channelName string, channelID snowflake.ID, msgs []database.ArchivedMessage,
+	pageOf, authorOf map[snowflake.ID]string, assets map[string]string) (int, error) {
+	pageCount := (len(msgs) + SitePageSize - 1) / SitePageSize
+	for page := 1; page <= pageCount; page++ {
+		pages := make([]sitePage, 0, pageCount)
+		for n := 1; n <= pageCount; n++ {
+			pages = append(pages, sitePage{Number: n, File: pageFile(channelID, n), Current: n == page})
+		}
+
+		chunk := msgs[(page-1)*SitePageSize : min(page*SitePageSize, len(msgs))]
+		out := make([]siteMessage, 0, len(chunk))
+		for _, msg := range chunk {
+			sm := siteMessage{
+				ID:       msg.ID,
+				Author:   msg.Author,
+				Content:  linkify(msg.Content, assets),
+				Created:  msg.Created,
+				Edited:   msg.Edited != nil,
+				Redacted: msg.Redacted,
+				ReplyTo:  msg.ReplyTo,
+			}
+			if file, ok := pageOf[msg.ReplyTo]; ok && msg.ReplyTo != 0 {
+				sm.ReplyLink = fmt.Sprintf("%s#m%s", file, msg.ReplyTo)
+				sm.ReplyAuthor = authorOf[msg.ReplyTo]
+			}
+			for _, att := range msg.Attachments {
+				sa := siteAttachment{Filename: att.Filename, Src: att.URL, Kind: "file"}
+				if local, ok := assets[att.URL]; ok {
+					sa.Src = local
+					switch {
+					case strings.HasPrefix(att.ContentType, "image/"):
+						sa.Kind = "image"
+					case strings.HasPrefix(att.ContentType, "video/"):
+						sa.Kind = "video"
+					}
+				}
+				sm.Attachments = append(sm.Attachments, sa)
+			}
+			out = append(out, sm)
+		}
+
+		if err := writePage(filepath.Join(outDir, "channels", pageFile(channelID, page)), "channel", map[string]any{
+			"Title":    fmt.Sprintf("#%s - %s", channelName, guildName),
+			"Root":     "../",
+			"Guild":    guildName,
+			"Channel":  channelName,
+			"Pages":    pages,
+			"Messages": out,
+		}); err != nil {
+			return page - 1, err
+		}
+	}
+	return pageCount, nil
+}
+
+func pageFile(channelID snowflake.ID, page int) string {
+	if page == 1 {
+		return channelID.String() + ".html"
+	}
+	return fmt.Sprintf("%s-%d.html", channelID, page)
+}
+
+func writePage(path, name string, data any) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create page: %w", err)
+	}
+	defer f.Close()
+	if err := siteTmpl.ExecuteTemplate(f, name, data); err != nil {
+		return fmt.Errorf("failed to render %s: %w", filepath.Base(path), err)
+	}
+	return f.Close()
+}
+
+// linkify escapes message content and turns urls into links, pointing at the local mirror when there is one.
+func linkify(content string, assets map[string]string) template.HTML {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range urlRegex.FindAllStringIndex(content, -1) {
+		sb.WriteString(template.HTMLEscapeString(content[last:loc[0]]))
+		u := content[loc[0]:loc[1]]
+		fmt.Fprintf(&sb, `<a href="%s">%s</a>`, template.HTMLEscapeString(u), template.HTMLEscapeString(u))
+		if local, ok := assets[u]; ok {
+			fmt.Fprintf(&sb, ` <a href="%s">(mirror)</a>`, template.HTMLEscapeString(local))
+		}
+		last = loc[1]
+	}
+	sb.WriteString(template.HTMLEscapeString(content[last:]))
+	return template.HTML(sb.String())
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	return out.Close()
+}
+
+func copyEmbedded(name, dest string) error {
+	data, err := siteFS.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dest, data, 0644)
+}
@@ -0,0 +1,106 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func TestExportSite(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	base := time.Now().Add(-1000 * time.Hour)
+	guildID, categoryID, channelID := snowflake.New(base), snowflake.New(base.Add(time.Second)), snowflake.New(base.Add(2*time.Second))
+	if _, err := database.UpsertGuild(db, guildID, func(g *database.Guild) error {
+		g.Name = "Test Guild"
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to create guild: %v", err)
+	}
+	for id, ch := range map[snowflake.ID]database.Channel{
+		categoryID: {GuildID: guildID, Name: "Text Channels", Type: discord.ChannelTypeGuildCategory},
+		channelID:  {GuildID: guildID, Name: "general", Type: discord.ChannelTypeGuildText, ParentID: categoryID},
+	} {
+		if _, err := database.UpsertChannel(db, id, func(c *database.Channel) error {
+			*c = ch
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to create channel: %v", err)
+		}
+	}
+
+	// a mirrored attachment
+	src := filepath.Join(tmpDir, "cat.png")
+	if err := os.WriteFile(src, []byte("\x89PNG fake image"), 0644); err != nil {
+		t.Fatalf("Failed to write asset: %v", err)
+	}
+	assetName, err := database.StoreAsset(db, tmpDir, 0, "https://cdn.discordapp.com/attachments/1/2/cat.png", src, "")
+	if err != nil {
+		t.Fatalf("StoreAsset() failed: %v", err)
+	}
+
+	msgs := make([]database.ArchivedMessage, SitePageSize+10)
+	for i := range msgs {
+		created := base.Add(time.Duration(i+10) * time.Second)
+		msgs[i] = database.ArchivedMessage{ID: snowflake.New(created), GuildID: guildID, ChannelID: channelID, Author: "alice", Content: "hello", Created: created}
+	}
+	msgs[0].Content = "<script>alert(1)</script>"
+	msgs[1].Attachments = []database.ArchivedAttachment{{Filename: "cat.png", URL: "https://cdn.discordapp.com/attachments/1/2/cat.png?ex=1", ContentType: "image/png", Asset: assetName}}
+	last := &msgs[len(msgs)-1]
+	last.ReplyTo = msgs[0].ID
+	if err := database.ArchiveMessages(db, channelID, msgs, func(b *database.ChannelBackup) error { return nil }); err != nil {
+		t.Fatalf("ArchiveMessages() failed: %v", err)
+	}
+
+	out := filepath.Join(tmpDir, "site")
+	stats, err := ExportSite(db, tmpDir, guildID, out)
+	if err != nil {
+		t.Fatalf("ExportSite() failed: %v", err)
+	}
+	if stats.Channels != 1 || stats.Pages != 2 || stats.Messages != len(msgs) || stats.Assets != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		return string(data)
+	}
+	index := read("index.html")
+	if !strings.Contains(index, "Text Channels") || !strings.Contains(index, `href="channels/`+channelID.String()+`.html"`) {
+		t.Errorf("Index is missing the channel list:\n%s", index)
+	}
+	first := read(filepath.Join("channels", channelID.String()+".html"))
+	if strings.Contains(first, "<script>") {
+		t.Errorf("Message content is not escaped")
+	}
+	if !strings.Contains(first, `src="../assets/`+assetName+`"`) {
+		t.Errorf("Attachment does not reference the local asset")
+	}
+	second := read(filepath.Join("channels", channelID.String()+"-2.html"))
+	if want := `href="` + channelID.String() + `.html#m` + msgs[0].ID.String() + `"`; !strings.Contains(second, want) {
+		t.Errorf("Expected reply link %s on the second page", want)
+	}
+	read("style.css")
+	read(filepath.Join("assets", assetName))
+}
@@ -0,0 +1,391 @@
+package backup
+
+import (
+	"archive/zip"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sprout/internal/platform/database"
+	"sprout/pkg/x"
+	"strings"
+	"time"
+
+	"github.com/Data-Corruption/lmdb-go/lmdb"
+	"github.com/Data-Corruption/lmdb-go/wrap"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const importBatchSize = 500 // messages per transaction
+
+// ImportStats summarizes an import.
+type ImportStats struct {
+	Format          string         // "DiscordChatExporter" or "data package"
+	Channels        int            // channels with imported messages
+	Messages        int            // newly archived messages
+	Existing        int            // already archived, skipped
+	SkippedChannels []snowflake.ID // no channel record, nothing imported
+}
+
+// importChannel is the parsed history of one channel.
+type importChannel struct {
+	id         snowflake.ID
+	msgs       []database.ArchivedMessage
+	continuous bool // a complete range of the channel history, the cursors can skip it
+	fromStart  bool // the range starts at the first message of the channel
+}
+
+// Import reads a DiscordChatExporter JSON export (a file, or a directory or zip of them) or a
+// Discord data package (directory or zip) into the archive. Channels are matched to existing
+// channel records by ID, unknown channels are skipped. Exports of whole channels move the backup
+// cursors past the imported range so the backup doesn't fetch it again, partial disables this for
+// filtered exports. Data packages only hold the messages of their owner and never move cursors.
+//
+// WARNING: Starts transactions. Avoid nesting transactions (deadlock risk).
+func Import(db *wrap.DB, src string, partial bool) (*ImportStats, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	var fsys fs.FS
+	var files []string // for a single export file
+	switch {
+	case info.IsDir():
+		fsys = os.DirFS(src)
+	case strings.EqualFold(filepath.Ext(src), ".zip"):
+		zr, err := zip.OpenReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zip: %w", err)
+		}
+		defer zr.Close()
+		fsys = zr
+	default:
+		fsys, files = os.DirFS(filepath.Dir(src)), []string{filepath.Base(src)}
+	}
+
+	stats := &ImportStats{}
+	var channels []importChannel
+	if _, err := fs.Stat(fsys, "messages/index.json"); err == nil && files == nil {
+		stats.Format = "data package"
+		if channels, err = parseDataPackage(fsys); err != nil {
+			return nil, err
+		}
+	} else {
+		stats.Format = "DiscordChatExporter"
+		if files == nil {
+			if files, err = fs.Glob(fsys, "*.json"); err != nil {
+				return nil, err
+			}
+			sub, _ := fs.Glob(fsys, "*/*.json") // exports are often sorted into a folder per guild
+			files = append(files, sub...)
+		}
+		if channels, err = parseChatExporter(fsys, files); err != nil {
+			return nil, err
+		}
+	}
+	if partial {
+		for i := range channels {
+			channels[i].continuous = false
+		}
+	}
+
+	for _, ic := range channels {
+		channel, err := database.ViewChannel(db, ic.id)
+		if err != nil {
+			if lmdb.IsNotFound(err) {
+				stats.SkippedChannels = append(stats.SkippedChannels, ic.id)
+				continue
+			}
+			return stats, fmt.Errorf("failed to get channel %s: %w", ic.id, err)
+		}
+		slices.SortFunc(ic.msgs, func(a, b database.ArchivedMessage) int {
+			return cmp.Compare(a.ID, b.ID)
+		})
+		ic.msgs = slices.CompactFunc(ic.msgs, func(a, b database.ArchivedMessage) bool { return a.ID == b.ID })
+		n, err := importMessages(db, channel.GuildID, ic)
+		stats.Messages += n
+		stats.Existing += len(ic.msgs) - n
+		if n > 0 {
+			stats.Channels++
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to import channel %s: %w", ic.id, err)
+		}
+	}
+	return stats, nil
+}
+
+// importMessages archives the sorted messages of a channel in batches, the cursors are moved
+// along with the last one.
+func importMessages(db *wrap.DB, guildID snowflake.ID, ic importChannel) (int, error) {
+	if len(ic.msgs) == 0 {
+		return 0, nil
+	}
+	for i := range ic.msgs {
+		ic.msgs[i].GuildID, ic.msgs[i].ChannelID = guildID, ic.id
+	}
+	oldest, newest := ic.msgs[0].ID, ic.msgs[len(ic.msgs)-1].ID
+
+	total := 0
+	for start := 0; start < len(ic.msgs); start += importBatchSize {
+		batch := ic.msgs[start:min(start+importBatchSize, len(ic.msgs))]
+		last := start+importBatchSize >= len(ic.msgs)
+		n, err := database.ImportMessages(db, ic.id, batch, func(b *database.ChannelBackup) error {
+			if last && ic.continuous {
+				applyImport(b, oldest, newest, ic.fromStart)
+			}
+			return nil
+		})
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// applyImport moves the cursors of a channel past an imported range of its history. A channel that
+// was never backed up continues from the import, otherwise the range is remembered until the
+// backward walk reaches it, merged with an earlier overlapping import.
+func applyImport(b *database.ChannelBackup, oldest, newest snowflake.ID, fromStart bool) {
+	if b.Ceil == 0 {
+		b.Ceil, b.Head, b.Tail, b.Complete = newest, newest, oldest, fromStart
+		return
+	}
+	if b.Complete || oldest >= b.Tail {
+		return // nothing the walk still needs
+	}
+	if b.ImportHead != 0 && oldest <= b.ImportHead && newest >= b.ImportTail {
+		fromStart = x.Ternary(oldest < b.ImportTail, fromStart, b.ImportComplete)
+		oldest, newest = min(oldest, b.ImportTail), max(newest, b.ImportHead)
+	}
+	b.ImportHead, b.ImportTail, b.ImportComplete = newest, oldest, fromStart
+	skipImported(b)
+}
+
+// --- DiscordChatExporter ---
+
+type dceExport struct {
+	Channel struct {
+		ID snowflake.ID `json:"id"`
+	} `json:"channel"`
+	DateRange struct {
+		After *string `json:"after"`
+	} `json:"dateRange"`
+	Messages []struct {
+		ID              snowflake.ID `json:"id"`
+		Type            string       `json:"type"`
+		Timestamp       time.Time    `json:"timestamp"`
+		TimestampEdited *time.Time   `json:"timestampEdited"`
+		Content         string       `json:"content"`
+		Author          struct {
+			ID   snowflake.ID `json:"id"`
+			Name string       `json:"name"`
+		} `json:"author"`
+		Attachments []struct {
+			URL           string `json:"url"`
+			FileName      string `json:"fileName"`
+			FileSizeBytes int    `json:"fileSizeBytes"`
+		} `json:"attachments"`
+		Reference *struct {
+			MessageID snowflake.ID `json:"messageId"`
+		} `json:"reference"`
+	} `json:"messages"`
+}
+
+// parseChatExporter reads DiscordChatExporter JSON exports, files of the same channel (partitions)
+// are combined. JSON files that aren't exports are ignored. Only regular messages and replies are
+// imported, system messages are rendered text in these exports.
+func parseChatExporter(fsys fs.FS, files []string) ([]importChannel, error) {
+	byID := make(map[snowflake.ID]*importChannel)
+	var order []snowflake.ID
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var export dceExport
+		if err := json.Unmarshal(data, &export); err != nil || export.Channel.ID == 0 {
+			continue
+		}
+		ic, ok := byID[export.Channel.ID]
+		if !ok {
+			ic = &importChannel{id: export.Channel.ID, continuous: true}
+			byID[export.Channel.ID] = ic
+			order = append(order, export.Channel.ID)
+		}
+		ic.fromStart = ic.fromStart || export.DateRange.After == nil
+		for _, m := range export.Messages {
+			if m.Type != "Default" && m.Type != "Reply" {
+				continue
+			}
+			msg := database.ArchivedMessage{
+				ID:          m.ID,
+				AuthorID:    m.Author.ID,
+				Author:      m.Author.Name,
+				Content:     m.Content,
+				Attachments: make([]database.ArchivedAttachment, 0, len(m.Attachments)),
+				Created:     m.Timestamp,
+				Edited:      m.TimestampEdited,
+			}
+			if m.Reference != nil {
+				msg.ReplyTo = m.Reference.MessageID
+			}
+			for _, att := range m.Attachments {
+				msg.Attachments = append(msg.Attachments, importedAttachment(att.URL, att.FileName, att.FileSizeBytes))
+			}
+			ic.msgs = append(ic.msgs, msg)
+		}
+	}
+	channels := make([]importChannel, 0, len(order))
+	for _, id := range order {
+		channels = append(channels, *byID[id])
+	}
+	return channels, nil
+}
+
+// --- Discord data package ---
+
+// timestamp layouts used by the different data package versions
+var packageTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999-07:00",
+	time.RFC3339Nano,
+}
+
+type packageMessage struct {
+	ID          json.Number `json:"ID"`
+	Timestamp   string      `json:"Timestamp"`
+	Contents    string      `json:"Contents"`
+	Attachments string      `json:"Attachments"` // space separated urls
+}
+
+// parseDataPackage reads the messages/ folder of a data package. Each channel folder (c<id>, or
+// <id> in older packages) holds a channel.json and the messages as messages.json or messages.csv.
+func parseDataPackage(fsys fs.FS) ([]importChannel, error) {
+	var owner struct {
+		ID       snowflake.ID `json:"id"`
+		Username string       `json:"username"`
+	}
+	data, err := fs.ReadFile(fsys, "account/user.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account/user.json: %w", err)
+	}
+	if err := json.Unmarshal(data, &owner); err != nil {
+		return nil, fmt.Errorf("failed to parse account/user.json: %w", err)
+	}
+
+	entries, err := fs.ReadDir(fsys, "messages")
+	if err != nil {
+		return nil, err
+	}
+	var channels []importChannel
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := path.Join("messages", entry.Name())
+		var channel struct {
+			ID snowflake.ID `json:"id"`
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, "channel.json"))
+		if err != nil || json.Unmarshal(data, &channel) != nil || channel.ID == 0 {
+			continue
+		}
+
+		var raw []packageMessage
+		if data, err := fs.ReadFile(fsys, path.Join(dir, "messages.json")); err == nil {
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return nil, fmt.Errorf("failed to parse %s/messages.json: %w", dir, err)
+			}
+		} else if raw, err = readPackageCSV(fsys, path.Join(dir, "messages.csv")); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		ic := importChannel{id: channel.ID}
+		for _, m := range raw {
+			id, err := snowflake.Parse(m.ID.String())
+			if err != nil {
+				return nil, fmt.Errorf("invalid message ID %q in %s", m.ID, dir)
+			}
+			msg := database.ArchivedMessage{
+				ID:       id,
+				AuthorID: owner.ID,
+				Author:   owner.Username,
+				Content:  m.Contents,
+				Created:  id.Time(),
+			}
+			for _, layout := range packageTimeLayouts {
+				if t, err := time.Parse(layout, m.Timestamp); err == nil {
+					msg.Created = t
+					break
+				}
+			}
+			for _, u := range strings.Fields(m.Attachments) {
+				msg.Attachments = append(msg.Attachments, importedAttachment(u, "", 0))
+			}
+			ic.msgs = append(ic.msgs, msg)
+		}
+		channels = append(channels, ic)
+	}
+	return channels, nil
+}
+
+// readPackageCSV reads the messages.csv of older data packages (ID,Timestamp,Contents,Attachments).
+func readPackageCSV(fsys fs.FS, name string) ([]packageMessage, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	var out []packageMessage
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		if first && record[0] == "ID" {
+			continue // header
+		}
+		m := packageMessage{ID: json.Number(record[0])}
+		if len(record) > 1 {
+			m.Timestamp = record[1]
+		}
+		if len(record) > 2 {
+			m.Contents = record[2]
+		}
+		if len(record) > 3 {
+			m.Attachments = record[3]
+		}
+		out = append(out, m)
+	}
+}
+
+// importedAttachment builds an attachment from an export, guessing what the export leaves out.
+func importedAttachment(rawURL, filename string, size int) database.ArchivedAttachment {
+	if filename == "" {
+		filename = path.Base(AttachmentKey(rawURL))
+	}
+	return database.ArchivedAttachment{
+		Filename:    filename,
+		URL:         rawURL,
+		ContentType: mime.TypeByExtension(strings.ToLower(path.Ext(filename))),
+		Size:        size,
+	}
+}
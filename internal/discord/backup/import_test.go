@@ -0,0 +1,256 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
+
+// chatExport renders a DiscordChatExporter JSON export of the given messages.
+func chatExport(t *testing.T, channelID snowflake.ID, ids []snowflake.ID, after *string) string {
+	t.Helper()
+	type message struct {
+		ID          string            `json:"id"`
+		Type        string            `json:"type"`
+		Timestamp   time.Time         `json:"timestamp"`
+		Content     string            `json:"content"`
+		Author      map[string]string `json:"author"`
+		Attachments []map[string]any  `json:"attachments"`
+	}
+	export := map[string]any{
+		"guild":     map[string]string{"id": "1", "name": "Test Guild"},
+		"channel":   map[string]string{"id": channelID.String(), "name": "general"},
+		"dateRange": map[string]any{"after": after, "before": nil},
+	}
+	msgs := []message{}
+	for i, id := range ids {
+		msgs = append(msgs, message{
+			ID:        id.String(),
+			Type:      "Default",
+			Timestamp: id.Time(),
+			Content:   fmt.Sprintf("imported %d", i),
+			Author:    map[string]string{"id": "42", "name": "alice"},
+			Attachments: []map[string]any{
+				{"url": "https://cdn.discordapp.com/attachments/1/2/cat.png", "fileName": "cat.png", "fileSizeBytes": 10},
+			},
+		})
+	}
+	msgs = append(msgs, message{ID: snowflake.New(time.Now()).String(), Type: "ChannelPinnedMessage", Author: map[string]string{"id": "42"}})
+	export["messages"] = msgs
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("Failed to marshal export: %v", err)
+	}
+	return string(data)
+}
+
+func TestImport(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	base := time.Now().Add(-1000 * time.Hour)
+	guildID := snowflake.New(base)
+	freshID, liveID, unknownID := snowflake.New(base.Add(time.Second)), snowflake.New(base.Add(2*time.Second)), snowflake.New(base.Add(3*time.Second))
+	for _, id := range []snowflake.ID{freshID, liveID} {
+		if _, err := database.UpsertChannel(db, id, func(c *database.Channel) error {
+			c.GuildID = guildID
+			c.Type = discord.ChannelTypeGuildText
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to create channel: %v", err)
+		}
+	}
+
+	t.Run("Chat Exporter", func(t *testing.T) {
+		src := &fakeSource{}
+		src.add(base.Add(time.Hour), 30)
+		dir := filepath.Join(tmpDir, "dce")
+		writeFile(t, filepath.Join(dir, "Guild - general.json"), chatExport(t, freshID, src.ids, nil))
+		writeFile(t, filepath.Join(dir, "guild", "unknown.json"), chatExport(t, unknownID, src.ids[:1], nil))
+		writeFile(t, filepath.Join(dir, "notes.json"), `{"not": "an export"}`)
+
+		stats, err := Import(db, dir, false)
+		if err != nil {
+			t.Fatalf("Import() failed: %v", err)
+		}
+		if stats.Format != "DiscordChatExporter" || stats.Channels != 1 || stats.Messages != 30 || len(stats.SkippedChannels) != 1 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+		msg, err := database.ViewArchivedMessage(db, src.ids[5])
+		if err != nil {
+			t.Fatalf("Failed to view imported message: %v", err)
+		}
+		if msg.GuildID != guildID || msg.Author != "alice" || msg.Content != "imported 5" || len(msg.Attachments) != 1 || msg.Attachments[0].ContentType != "image/png" {
+			t.Errorf("Unexpected imported message: %+v", msg)
+		}
+
+		// never backed up, the walks continue from the import
+		ch, err := database.ViewChannel(db, freshID)
+		if err != nil {
+			t.Fatalf("Failed to view channel: %v", err)
+		}
+		if ch.Backup.Tail != src.ids[0] || ch.Backup.Head != src.ids[29] || !ch.Backup.Complete {
+			t.Errorf("Expected cursors over the import, got %+v", ch.Backup)
+		}
+
+		// importing again changes nothing
+		stats, err = Import(db, filepath.Join(dir, "Guild - general.json"), false)
+		if err != nil {
+			t.Fatalf("Import() failed: %v", err)
+		}
+		if stats.Messages != 0 || stats.Existing != 30 {
+			t.Errorf("Expected everything to be archived already, got %+v", stats)
+		}
+	})
+
+	t.Run("Backward Walk Skips Import", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		m := &Manager{db: db, log: logger, ctx: ctx, cancel: cancel, closeWG: &sync.WaitGroup{}}
+
+		// history: 300 old messages that were exported, then 150 the export doesn't have
+		src := &fakeSource{}
+		src.add(base.Add(10*time.Hour), 300)
+		src.add(base.Add(20*time.Hour), 150)
+		ceil := snowflake.New(time.Now())
+		if err := database.ArchiveMessages(db, liveID, nil, func(b *database.ChannelBackup) error {
+			b.Ceil, b.Head, b.Tail = ceil, ceil, ceil
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to init cursors: %v", err)
+		}
+
+		path := filepath.Join(tmpDir, "live.json")
+		writeFile(t, path, chatExport(t, liveID, src.ids[:300], nil))
+		if _, err := Import(db, path, false); err != nil {
+			t.Fatalf("Import() failed: %v", err)
+		}
+
+		n, err := m.backupChannel(src, guildID, liveID)
+		if err != nil {
+			t.Fatalf("backupChannel() failed: %v", err)
+		}
+		if n > 150+PageSize {
+			t.Errorf("Expected at most one page of overlap with the import, archived %d", n)
+		}
+		ch, err := database.ViewChannel(db, liveID)
+		if err != nil {
+			t.Fatalf("Failed to view channel: %v", err)
+		}
+		if !ch.Backup.Complete || ch.Backup.Tail != src.ids[0] || ch.Backup.ImportHead != 0 {
+			t.Errorf("Expected the walk to jump to the start of the import, got %+v", ch.Backup)
+		}
+	})
+
+	t.Run("Data Package", func(t *testing.T) {
+		ownerID := snowflake.New(base.Add(4 * time.Second))
+		jsonIDs := []snowflake.ID{snowflake.New(base.Add(30 * time.Hour)), snowflake.New(base.Add(31 * time.Hour))}
+		csvID := snowflake.New(base.Add(32 * time.Hour))
+		dir := filepath.Join(tmpDir, "package")
+		writeFile(t, filepath.Join(dir, "account", "user.json"), fmt.Sprintf(`{"id": "%s", "username": "bob"}`, ownerID))
+		writeFile(t, filepath.Join(dir, "messages", "index.json"), fmt.Sprintf(`{"%s": "general"}`, freshID))
+		writeFile(t, filepath.Join(dir, "messages", "c"+freshID.String(), "channel.json"), fmt.Sprintf(`{"id": "%s", "type": 0}`, freshID))
+		writeFile(t, filepath.Join(dir, "messages", "c"+freshID.String(), "messages.json"), fmt.Sprintf(
+			`[{"ID": %s, "Timestamp": "2023-04-01 12:00:00", "Contents": "hi", "Attachments": ""}, {"ID": %s, "Timestamp": "2023-04-01 12:01:00", "Contents": "", "Attachments": "https://cdn.discordapp.com/attachments/1/2/clip.mp4?ex=1"}]`,
+			jsonIDs[0], jsonIDs[1]))
+		writeFile(t, filepath.Join(dir, "messages", liveID.String(), "channel.json"), fmt.Sprintf(`{"id": "%s", "type": 0}`, liveID))
+		writeFile(t, filepath.Join(dir, "messages", liveID.String(), "messages.csv"), fmt.Sprintf(
+			"ID,Timestamp,Contents,Attachments\n%s,2020-01-01 00:00:00.000000+00:00,\"multi\nline, with comma\",\n", csvID))
+
+		before, err := database.ViewChannel(db, freshID)
+		if err != nil {
+			t.Fatalf("Failed to view channel: %v", err)
+		}
+		stats, err := Import(db, dir, false)
+		if err != nil {
+			t.Fatalf("Import() failed: %v", err)
+		}
+		if stats.Format != "data package" || stats.Channels != 2 || stats.Messages != 3 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+		msg, err := database.ViewArchivedMessage(db, jsonIDs[1])
+		if err != nil {
+			t.Fatalf("Failed to view imported message: %v", err)
+		}
+		if msg.AuthorID != ownerID || msg.Author != "bob" || len(msg.Attachments) != 1 || msg.Attachments[0].Filename != "clip.mp4" {
+			t.Errorf("Unexpected imported message: %+v", msg)
+		}
+		msg, err = database.ViewArchivedMessage(db, csvID)
+		if err != nil {
+			t.Fatalf("Failed to view imported message: %v", err)
+		}
+		if !strings.Contains(msg.Content, "with comma") || msg.Created.Year() != 2020 {
+			t.Errorf("Unexpected imported csv message: %+v", msg)
+		}
+
+		// only the owner's messages, the cursors stay put
+		after, err := database.ViewChannel(db, freshID)
+		if err != nil {
+			t.Fatalf("Failed to view channel: %v", err)
+		}
+		if after.Backup != before.Backup {
+			t.Errorf("Expected data package import to leave the cursors alone, got %+v", after.Backup)
+		}
+	})
+}
+
+func TestApplyImport(t *testing.T) {
+	id := func(n int) snowflake.ID { return snowflake.ID(n) }
+	tests := []struct {
+		name           string
+		backup         database.ChannelBackup
+		oldest, newest snowflake.ID
+		fromStart      bool
+		want           database.ChannelBackup
+	}{
+		{"Never Backed Up", database.ChannelBackup{}, id(10), id(20), false,
+			database.ChannelBackup{Ceil: id(20), Head: id(20), Tail: id(10)}},
+		{"Reaches Tail", database.ChannelBackup{Ceil: id(50), Head: id(60), Tail: id(15)}, id(10), id(20), true,
+			database.ChannelBackup{Ceil: id(50), Head: id(60), Tail: id(10), Complete: true}},
+		{"Before Tail", database.ChannelBackup{Ceil: id(50), Head: id(60), Tail: id(40)}, id(10), id(20), true,
+			database.ChannelBackup{Ceil: id(50), Head: id(60), Tail: id(40), ImportHead: id(20), ImportTail: id(10), ImportComplete: true}},
+		{"Merge Overlapping", database.ChannelBackup{Ceil: id(50), Head: id(60), Tail: id(40), ImportHead: id(20), ImportTail: id(10), ImportComplete: true}, id(15), id(30), false,
+			database.ChannelBackup{Ceil: id(50), Head: id(60), Tail: id(40), ImportHead: id(30), ImportTail: id(10), ImportComplete: true}},
+		{"Already Complete", database.ChannelBackup{Ceil: id(50), Head: id(60), Tail: id(5), Complete: true}, id(10), id(20), true,
+			database.ChannelBackup{Ceil: id(50), Head: id(60), Tail: id(5), Complete: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.backup
+			applyImport(&b, tt.oldest, tt.newest, tt.fromStart)
+			if b != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, b)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package backup
+
+import (
+	"cmp"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sprout/internal/platform/database"
+	"sprout/pkg/workqueue"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Data-Corruption/lmdb-go/wrap"
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const (
+	ReplayWebhookName = "Halsey Replay"
+	maxReplayFiles    = 10   // attachments per webhook message
+	maxReplayContent  = 2000 // characters per webhook message
+	maxWebhookName    = 80
+)
+
+// discord rejects webhook usernames containing these
+var reservedNameRegex = regexp.MustCompile(`(?i)discord|clyde`)
+
+// ErrReplayRunning is returned when the same replay is already queued.
+var ErrReplayRunning = errors.New("replay already running")
+
+// ReplayClient is the subset of the rest client used for replaying.
+type ReplayClient interface {
+	CreateWebhook(channelID snowflake.ID, webhookCreate discord.WebhookCreate, opts ...rest.RequestOpt) (*discord.IncomingWebhook, error)
+	CreateWebhookMessage(webhookID snowflake.ID, webhookToken string, messageCreate discord.WebhookMessageCreate, params rest.CreateWebhookMessageParams, opts ...rest.RequestOpt) (*discord.Message, error)
+}
+
+// ReplayDoneFunc is called from the queue when a replay finished or stopped.
+// The state is resumable unless err is nil.
+type ReplayDoneFunc func(state database.Replay, err error)
+
+// Replayer recreates archived channels in other channels through a webhook, posting one
+// message per queue job so the queue interval acts as the rate limit. Progress is stored
+// after every message, a stopped replay continues after the last posted message.
+type Replayer struct {
+	db         *wrap.DB
+	log        *xlog.Logger
+	storageDir string
+	queue      *workqueue.Queue
+
+	mu      sync.Mutex
+	running map[string]struct{} // source:destination
+}
+
+func NewReplayer(db *wrap.DB, log *xlog.Logger, storageDir string, queue *workqueue.Queue) *Replayer {
+	return &Replayer{
+		db:         db,
+		log:        log,
+		storageDir: storageDir,
+		queue:      queue,
+		running:    make(map[string]struct{}),
+	}
+}
+
+// replay is a single replay in progress.
+type replay struct {
+	r               *Replayer
+	attempt         string // keeps job ids unique when resuming right after a failure
+	client          ReplayClient
+	sourceID        snowflake.ID
+	destID          snowflake.ID
+	uploadSizeLimit int64
+	pending         []database.ArchivedMessage
+	state           database.Replay
+	onDone          ReplayDoneFunc
+}
+
+// Replay starts or resumes replaying the archive of sourceID into destID, returning the number
+// of messages left to post. Redacted and deleted messages are skipped. destGuild is used for
+// the upload size limit. onDone may be nil, it is only called if messages were queued.
+//
+// WARNING: Starts transactions. Avoid nesting transactions (deadlock risk).
+func (r *Replayer) Replay(client ReplayClient, sourceID, destID snowflake.ID, destGuild database.Guild, onDone ReplayDoneFunc) (int, error) {
+	if sourceID == destID {
+		return 0, fmt.Errorf("source and destination are the same channel")
+	}
+	key := sourceID.String() + ":" + destID.String()
+	r.mu.Lock()
+	if _, ok := r.running[key]; ok {
+		r.mu.Unlock()
+		return 0, ErrReplayRunning
+	}
+	r.running[key] = struct{}{}
+	r.mu.Unlock()
+	started := false
+	defer func() {
+		if !started {
+			r.release(key)
+		}
+	}()
+
+	// claim the state, the webhook is reused on resume
+	var state database.Replay
+	if _, err := database.UpsertReplay(r.db, sourceID, destID, func(rp *database.Replay) error {
+		if rp.Started.IsZero() {
+			rp.Started = time.Now()
+		}
+		rp.Finished = time.Time{}
+		rp.Error = ""
+		state = *rp
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("failed to load replay state: %w", err)
+	}
+
+	// collect what's left
+	var pending []database.ArchivedMessage
+	if err := database.ViewArchivedMessages(r.db, func(msg *database.ArchivedMessage) error {
+		if msg.ChannelID == sourceID && msg.ID > state.Cursor && !msg.Redacted && msg.Deleted == nil {
+			pending = append(pending, *msg)
+		}
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("failed to read archive: %w", err)
+	}
+	slices.SortFunc(pending, func(a, b database.ArchivedMessage) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	rp := &replay{
+		r:               r,
+		attempt:         strings.ToLower(rand.Text()[:10]),
+		client:          client,
+		sourceID:        sourceID,
+		destID:          destID,
+		uploadSizeLimit: destGuild.UploadLimit(),
+		pending:         pending,
+		state:           state,
+		onDone:          onDone,
+	}
+	if len(pending) == 0 {
+		started = true
+		rp.onDone = nil
+		rp.finish(nil)
+		return 0, nil
+	}
+	if err := rp.ensureWebhook(); err != nil {
+		return 0, err
+	}
+	if !rp.enqueue() {
+		return 0, fmt.Errorf("replay queue is closed")
+	}
+	started = true
+	return len(pending), nil
+}
+
+func (r *Replayer) release(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.running, key)
+}
+
+func (rp *replay) ensureWebhook() error {
+	if rp.state.WebhookID != 0 {
+		return nil
+	}
+	webhook, err := rp.client.CreateWebhook(rp.destID, discord.WebhookCreate{Name: ReplayWebhookName})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook (missing Manage Webhooks permission?): %w", err)
+	}
+	rp.state.WebhookID, rp.state.WebhookToken = webhook.ID(), webhook.Token
+	return rp.save()
+}
+
+func (rp *replay) save() error {
+	_, err := database.UpsertReplay(rp.r.db, rp.sourceID, rp.destID, func(s *database.Replay) error {
+		*s = rp.state
+		return nil
+	})
+	return err
+}
+
+// enqueue queues the next pending message, returns false if the queue is closed.
+func (rp *replay) enqueue() bool {
+	msg := rp.pending[0]
+	id := fmt.Sprintf("replay:%s:%s:%s:%s", rp.sourceID, rp.destID, rp.attempt, msg.ID)
+	return rp.r.queue.Enqueue(id, false, func() error {
+		if err := rp.post(msg); err != nil {
+			var restErr *rest.Error
+			if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound {
+				rp.state.WebhookID, rp.state.WebhookToken = 0, "" // deleted, recreated on resume
+			}
+			rp.finish(fmt.Errorf("failed to post message %s: %w", msg.ID, err))
+			return err
+		}
+		rp.state.Cursor = msg.ID
+		rp.state.Parts = 0
+		rp.state.Replayed++
+		if err := rp.save(); err != nil {
+			rp.finish(fmt.Errorf("failed to save replay state: %w", err))
+			return err
+		}
+
+		rp.pending = rp.pending[1:]
+		if len(rp.pending) == 0 {
+			rp.finish(nil)
+		} else if !rp.enqueue() {
+			rp.finish(fmt.Errorf("replay queue closed"))
+		}
+		return nil
+	})
+}
+
+// finish records the outcome and releases the replay.
+func (rp *replay) finish(err error) {
+	if err != nil {
+		rp.state.Error = err.Error()
+		rp.r.log.Warnf("replay: %s into %s stopped after %d messages: %v", rp.sourceID, rp.destID, rp.state.Replayed, err)
+	} else {
+		rp.state.Finished = time.Now()
+		rp.r.log.Infof("replay: %s into %s finished, %d messages", rp.sourceID, rp.destID, rp.state.Replayed)
+	}
+	if saveErr := rp.save(); saveErr != nil {
+		rp.r.log.Errorf("replay: failed to save state of %s into %s: %v", rp.sourceID, rp.destID, saveErr)
+	}
+	rp.r.release(rp.sourceID.String() + ":" + rp.destID.String())
+	if rp.onDone != nil {
+		rp.onDone(rp.state, err)
+	}
+}
+
+// post recreates a message as the original author. Mirrored attachments are re-uploaded,
+// the rest are linked. Content longer than a webhook message allows (nitro messages) and links
+// that don't fit go into further messages. Each webhook message is checkpointed, a resume skips
+// the ones already posted.
+func (rp *replay) post(msg database.ArchivedMessage) error {
+	create := discord.WebhookMessageCreate{
+		Username:        webhookName(msg.Author),
+		AllowedMentions: &discord.AllowedMentions{}, // no pings from history
+	}
+	if user, err := database.ViewUser(rp.r.db, msg.AuthorID); err == nil {
+		if user.Username != "" && msg.Author == "" {
+			create.Username = webhookName(user.Username)
+		}
+		if user.AvatarURL != nil {
+			create.AvatarURL = *user.AvatarURL
+		}
+	}
+
+	var links []string
+	for _, att := range msg.Attachments {
+		if att.Asset != "" && len(create.Files) < maxReplayFiles {
+			path := database.ToAssetPath(filepath.Join(rp.r.storageDir, "assets"), att.Asset)
+			if info, err := os.Stat(path); err == nil && info.Size() <= rp.uploadSizeLimit {
+				f, err := os.Open(path)
+				if err == nil {
+					defer f.Close()
+					create.Files = append(create.Files, discord.NewFile(att.Filename, "", f))
+					continue
+				}
+			}
+		}
+		links = append(links, att.URL)
+	}
+
+	contents := splitContent(msg.Content, maxReplayContent)
+	extra := strings.Join(links, "\n")
+	if n := len(contents); n > 0 && extra != "" && utf8.RuneCountInString(contents[n-1])+1+utf8.RuneCountInString(extra) <= maxReplayContent {
+		contents[n-1] += "\n" + extra
+		extra = ""
+	}
+	contents = append(contents, splitContent(extra, maxReplayContent)...)
+	if len(contents) == 0 {
+		if len(create.Files) == 0 {
+			return nil // nothing left to show (e.g. embeds only)
+		}
+		contents = []string{""}
+	}
+
+	// the files go with the first message
+	parts := make([]discord.WebhookMessageCreate, len(contents))
+	for i, content := range contents {
+		parts[i] = create
+		parts[i].Content = content
+		if i > 0 {
+			parts[i].Files = nil
+		}
+	}
+	for _, part := range parts[min(rp.state.Parts, len(parts)):] {
+		if _, err := rp.client.CreateWebhookMessage(rp.state.WebhookID, rp.state.WebhookToken, part, rest.CreateWebhookMessageParams{Wait: true}); err != nil {
+			return err
+		}
+		rp.state.Parts++
+		if err := rp.save(); err != nil {
+			return fmt.Errorf("failed to save replay state: %w", err)
+		}
+	}
+	return nil
+}
+
+// splitContent cuts s into parts of at most limit characters, discord counts runes rather than bytes.
+func splitContent(s string, limit int) []string {
+	var parts []string
+	for s != "" {
+		end, n := 0, 0
+		for end < len(s) && n < limit {
+			_, size := utf8.DecodeRuneInString(s[end:])
+			end += size
+			n++
+		}
+		parts = append(parts, s[:end])
+		s = s[end:]
+	}
+	return parts
+}
+
+// webhookName makes a username discord accepts for webhook messages.
+func webhookName(name string) string {
+	name = reservedNameRegex.ReplaceAllStringFunc(name, func(s string) string {
+		return s[:1] + "\u200b" + s[1:] // zero width space
+	})
+	if r := []rune(name); len(r) > maxWebhookName {
+		name = string(r[:maxWebhookName])
+	}
+	if strings.TrimSpace(name) == "" {
+		return "unknown"
+	}
+	return name
+}
@@ -0,0 +1,265 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database"
+	"sprout/pkg/workqueue"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// fakeWebhooks records webhook messages, failing once before the message at failAt.
+type fakeWebhooks struct {
+	mu       sync.Mutex
+	webhooks int
+	posts    []discord.WebhookMessageCreate
+	files    []string
+	failAt   int
+}
+
+func (f *fakeWebhooks) CreateWebhook(channelID snowflake.ID, webhookCreate discord.WebhookCreate, opts ...rest.RequestOpt) (*discord.IncomingWebhook, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.webhooks++
+	var webhook discord.IncomingWebhook
+	if err := json.Unmarshal([]byte(`{"id":"1234","token":"secret","channel_id":"`+channelID.String()+`"}`), &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (f *fakeWebhooks) CreateWebhookMessage(webhookID snowflake.ID, webhookToken string, messageCreate discord.WebhookMessageCreate, params rest.CreateWebhookMessageParams, opts ...rest.RequestOpt) (*discord.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failAt > 0 && len(f.posts) == f.failAt {
+		f.failAt = 0
+		return nil, errors.New("discord is down")
+	}
+	for _, file := range messageCreate.Files {
+		f.files = append(f.files, file.Name)
+	}
+	f.posts = append(f.posts, messageCreate)
+	return &discord.Message{}, nil
+}
+
+func TestReplay(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	base := time.Now().Add(-1000 * time.Hour)
+	sourceID, destID, alice := snowflake.New(base), snowflake.New(base.Add(time.Second)), snowflake.New(base.Add(2*time.Second))
+	if _, err := database.UpsertChannel(db, sourceID, func(c *database.Channel) error { return nil }); err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+	avatar := "https://cdn.discordapp.com/avatars/alice.png"
+	if _, err := database.UpsertUser(db, alice, func(u *database.User) error {
+		u.Username = "alice"
+		u.AvatarURL = &avatar
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// a mirrored attachment
+	src := filepath.Join(tmpDir, "cat.png")
+	if err := os.WriteFile(src, []byte("\x89PNG fake image"), 0644); err != nil {
+		t.Fatalf("Failed to write asset: %v", err)
+	}
+	assetName, err := database.StoreAsset(db, tmpDir, 0, "https://cdn.discordapp.com/attachments/1/2/cat.png", src, "")
+	if err != nil {
+		t.Fatalf("StoreAsset() failed: %v", err)
+	}
+
+	deleted := base
+	msgs := make([]database.ArchivedMessage, 5)
+	for i := range msgs {
+		created := base.Add(time.Duration(i+10) * time.Second)
+		msgs[i] = database.ArchivedMessage{ID: snowflake.New(created), ChannelID: sourceID, AuthorID: alice, Author: "alice", Content: "hello", Created: created}
+	}
+	msgs[1].Attachments = []database.ArchivedAttachment{
+		{Filename: "cat.png", URL: "https://cdn.discordapp.com/attachments/1/2/cat.png", Asset: assetName},
+		{Filename: "gone.zip", URL: "https://cdn.discordapp.com/attachments/1/3/gone.zip"},
+	}
+	msgs[2].Redacted = true
+	msgs[3].Deleted = &deleted
+	if err := database.ArchiveMessages(db, sourceID, msgs, func(b *database.ChannelBackup) error { return nil }); err != nil {
+		t.Fatalf("ArchiveMessages() failed: %v", err)
+	}
+
+	queue := workqueue.New(logger, 0, 0, time.Millisecond)
+	defer queue.Close()
+	r := NewReplayer(db, logger, tmpDir, queue)
+	client := &fakeWebhooks{failAt: 1}
+
+	start := func() (int, database.Replay, error) {
+		t.Helper()
+		done := make(chan struct{})
+		var state database.Replay
+		var doneErr error
+		n, err := r.Replay(client, sourceID, destID, database.Guild{}, func(s database.Replay, err error) {
+			state, doneErr = s, err
+			close(done)
+		})
+		if err != nil {
+			t.Fatalf("Replay() failed: %v", err)
+		}
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Replay did not finish")
+		}
+		return n, state, doneErr
+	}
+
+	// first attempt stops on the second message
+	n, state, err := start()
+	if n != 3 || err == nil || state.Replayed != 1 || state.Cursor != msgs[0].ID || state.Error == "" {
+		t.Fatalf("Expected the replay to stop after one of 3 messages, got n=%d err=%v state=%+v", n, err, state)
+	}
+
+	// resume continues after the cursor
+	n, state, err = start()
+	if n != 2 || err != nil || state.Replayed != 3 || state.Finished.IsZero() || state.Error != "" {
+		t.Fatalf("Expected the resumed replay to finish, got n=%d err=%v state=%+v", n, err, state)
+	}
+	if client.webhooks != 1 {
+		t.Errorf("Expected the webhook to be reused, created %d", client.webhooks)
+	}
+	if len(client.posts) != 3 {
+		t.Fatalf("Expected 3 posts, got %d", len(client.posts))
+	}
+	post := client.posts[1]
+	if post.Username != "alice" || post.AvatarURL != avatar {
+		t.Errorf("Expected the original author, got %q %q", post.Username, post.AvatarURL)
+	}
+	if len(client.files) != 1 || client.files[0] != "cat.png" {
+		t.Errorf("Expected the mirrored asset to be uploaded, got %v", client.files)
+	}
+	if want := "hello\nhttps://cdn.discordapp.com/attachments/1/3/gone.zip"; post.Content != want {
+		t.Errorf("Expected unmirrored attachments as links, got %q", post.Content)
+	}
+
+	// nothing left
+	n, err = r.Replay(client, sourceID, destID, database.Guild{}, nil)
+	if err != nil || n != 0 {
+		t.Errorf("Expected nothing left to replay, got n=%d err=%v", n, err)
+	}
+}
+
+func TestReplaySplitMessage(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	// too long to fit the link, it goes into a second message. the second one is longer than a
+	// webhook message allows, in multibyte characters
+	base := time.Now().Add(-1000 * time.Hour)
+	sourceID, destID := snowflake.New(base), snowflake.New(base.Add(time.Second))
+	if _, err := database.UpsertChannel(db, sourceID, func(c *database.Channel) error { return nil }); err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+	msg := database.ArchivedMessage{
+		ID: snowflake.New(base.Add(10 * time.Second)), ChannelID: sourceID, Author: "alice",
+		Content:     strings.Repeat("a", maxReplayContent-10),
+		Attachments: []database.ArchivedAttachment{{Filename: "gone.zip", URL: "https://cdn.discordapp.com/attachments/1/3/gone.zip"}},
+		Created:     base.Add(10 * time.Second),
+	}
+	long := database.ArchivedMessage{
+		ID: snowflake.New(base.Add(20 * time.Second)), ChannelID: sourceID, Author: "alice",
+		Content: strings.Repeat("é", 2*maxReplayContent),
+		Created: base.Add(20 * time.Second),
+	}
+	if err := database.ArchiveMessages(db, sourceID, []database.ArchivedMessage{msg, long}, func(b *database.ChannelBackup) error { return nil }); err != nil {
+		t.Fatalf("ArchiveMessages() failed: %v", err)
+	}
+
+	queue := workqueue.New(logger, 0, 0, time.Millisecond)
+	defer queue.Close()
+	r := NewReplayer(db, logger, tmpDir, queue)
+	client := &fakeWebhooks{failAt: 1}
+
+	start := func() (database.Replay, error) {
+		t.Helper()
+		done := make(chan struct{})
+		var state database.Replay
+		var doneErr error
+		if _, err := r.Replay(client, sourceID, destID, database.Guild{}, func(s database.Replay, err error) {
+			state, doneErr = s, err
+			close(done)
+		}); err != nil {
+			t.Fatalf("Replay() failed: %v", err)
+		}
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Replay did not finish")
+		}
+		return state, doneErr
+	}
+
+	// the link fails after the content was posted
+	state, err := start()
+	if err == nil || state.Parts != 1 || state.Cursor != 0 {
+		t.Fatalf("Expected the first part to be checkpointed, got err=%v state=%+v", err, state)
+	}
+
+	// resume only posts the link, then the long message in two
+	state, err = start()
+	if err != nil || state.Parts != 0 || state.Cursor != long.ID || state.Replayed != 2 {
+		t.Fatalf("Expected the resumed replay to finish, got err=%v state=%+v", err, state)
+	}
+	if len(client.posts) != 4 {
+		t.Fatalf("Expected 4 posts, got %d", len(client.posts))
+	}
+	if client.posts[0].Content != msg.Content || client.posts[1].Content != msg.Attachments[0].URL {
+		t.Errorf("Expected the content then the link, got %q and %q", client.posts[0].Content[:10], client.posts[1].Content)
+	}
+	for _, post := range client.posts[2:] {
+		if post.Content != strings.Repeat("é", maxReplayContent) {
+			t.Errorf("Expected half of the long message, got %d characters", utf8.RuneCountInString(post.Content))
+		}
+	}
+}
+
+func TestWebhookName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"alice", "alice"},
+		{"DiscordFan", "D\u200biscordFan"},
+		{"   ", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := webhookName(tt.name); got != tt.want {
+			t.Errorf("webhookName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
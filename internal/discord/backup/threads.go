@@ -0,0 +1,165 @@
+package backup
+
+import (
+	"slices"
+	"sprout/internal/platform/database"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const ThreadPageSize = 100 // max archived threads discord returns per request
+
+// channel types whose threads are archived, forum and media channels only have threads
+var threadParentTypes = []discord.ChannelType{
+	discord.ChannelTypeGuildText,
+	discord.ChannelTypeGuildNews,
+	discord.ChannelTypeGuildForum,
+	discord.ChannelTypeGuildMedia,
+}
+
+// threadSource is the subset of the rest client used for listing threads. The channel cache only
+// knows active threads, archived ones have to be listed per parent channel.
+type threadSource interface {
+	GetActiveGuildThreads(guildID snowflake.ID, opts ...rest.RequestOpt) (*discord.GuildActiveThreads, error)
+	GetPublicArchivedThreads(channelID snowflake.ID, before time.Time, limit int, opts ...rest.RequestOpt) (*discord.GetThreads, error)
+	GetPrivateArchivedThreads(channelID snowflake.ID, before time.Time, limit int, opts ...rest.RequestOpt) (*discord.GetThreads, error)
+}
+
+// archiveSource is everything a run needs from the rest client.
+type archiveSource interface {
+	messageSource
+	threadSource
+}
+
+// discoverThreads registers the active and archived threads of every archived parent channel as
+// channels of the guild, and marks known threads that no longer exist as deleted. Threads follow the
+// backup setting of their parent. Returns the guild channels including new threads, and the last
+// message ID of every listed thread.
+func (m *Manager) discoverThreads(src threadSource, guild database.GuildWithID) ([]database.ChannelWithID, map[snowflake.ID]snowflake.ID) {
+	parents := make(map[snowflake.ID]database.ChannelWithID)
+	for _, channel := range guild.Channels {
+		if channel.Channel.Backup.Enabled && !channel.Channel.Deleted && channel.ID != guild.Guild.BotChannelID &&
+			slices.Contains(threadParentTypes, channel.Channel.Type) {
+			parents[channel.ID] = channel
+		}
+	}
+
+	// parents whose listings all succeeded, their unlisted threads are gone
+	complete := make(map[snowflake.ID]bool) // public and private
+	completePublic := make(map[snowflake.ID]bool)
+	var found []discord.GuildThread
+	if len(parents) > 0 {
+		if active, err := src.GetActiveGuildThreads(guild.ID, rest.WithCtx(m.ctx)); err != nil {
+			m.log.Warnf("backup: failed to list active threads of guild %s: %v", guild.ID, err)
+		} else {
+			found = append(found, active.Threads...)
+			for id, parent := range parents {
+				threads, ok := m.listArchivedThreads(src.GetPublicArchivedThreads, id)
+				found = append(found, threads...)
+				completePublic[id] = ok
+				if parent.Channel.Type != discord.ChannelTypeGuildText {
+					complete[id] = ok // private threads only exist in text channels
+					continue
+				}
+				threads, privateOK := m.listArchivedThreads(src.GetPrivateArchivedThreads, id)
+				found = append(found, threads...)
+				complete[id] = ok && privateOK
+			}
+		}
+	}
+
+	lastMessages := make(map[snowflake.ID]snowflake.ID)
+	registered := make(map[snowflake.ID]database.Channel)
+	for _, thread := range found {
+		parentID := thread.ParentID()
+		if parentID == nil {
+			continue
+		}
+		if _, ok := parents[*parentID]; !ok {
+			continue
+		}
+		if _, ok := registered[thread.ID()]; ok {
+			continue // active and archived listings can overlap while a thread changes state
+		}
+		lastMessages[thread.ID()] = 0
+		if last := thread.LastMessageID(); last != nil {
+			lastMessages[thread.ID()] = *last
+		}
+		var stored database.Channel
+		if _, err := database.UpsertChannel(m.db, thread.ID(), func(c *database.Channel) error {
+			c.GuildID = guild.ID
+			c.Name = thread.Name()
+			c.Type = thread.Type()
+			c.Position = 0
+			c.ParentID = *parentID
+			c.Deleted = false
+			c.Backup.Enabled = true
+			stored = *c
+			return nil
+		}); err != nil {
+			m.log.Errorf("backup: failed to register thread %s: %v", thread.ID(), err)
+			continue
+		}
+		registered[thread.ID()] = stored
+	}
+
+	// merge into the channel list, threads that weren't listed are deleted if we can be sure
+	channels := make([]database.ChannelWithID, 0, len(guild.Channels)+len(registered))
+	for _, channel := range guild.Channels {
+		if stored, ok := registered[channel.ID]; ok {
+			channel.Channel = stored
+			delete(registered, channel.ID)
+		} else if database.IsThread(channel.Channel.Type) {
+			_, enabled := parents[channel.Channel.ParentID]
+			gone := !channel.Channel.Deleted && (complete[channel.Channel.ParentID] ||
+				(completePublic[channel.Channel.ParentID] && channel.Channel.Type != discord.ChannelTypeGuildPrivateThread))
+			if gone || channel.Channel.Backup.Enabled != enabled {
+				if _, err := database.UpsertChannel(m.db, channel.ID, func(c *database.Channel) error {
+					c.Deleted = c.Deleted || gone
+					c.Backup.Enabled = enabled
+					return nil
+				}); err != nil {
+					m.log.Errorf("backup: failed to update thread %s: %v", channel.ID, err)
+				}
+				channel.Channel.Deleted = channel.Channel.Deleted || gone
+				channel.Channel.Backup.Enabled = enabled
+			}
+		}
+		channels = append(channels, channel)
+	}
+	for id, stored := range registered {
+		channels = append(channels, database.ChannelWithID{ID: id, Channel: stored})
+	}
+	return channels, lastMessages
+}
+
+// listArchivedThreads pages through the archived threads of a channel, newest archived first.
+// Returns false if a request failed, usually missing permissions for private threads.
+func (m *Manager) listArchivedThreads(list func(snowflake.ID, time.Time, int, ...rest.RequestOpt) (*discord.GetThreads, error), channelID snowflake.ID) ([]discord.GuildThread, bool) {
+	var out []discord.GuildThread
+	var before time.Time
+	for {
+		page, err := list(channelID, before, ThreadPageSize, rest.WithCtx(m.ctx))
+		if err != nil {
+			m.log.Debugf("backup: failed to list archived threads of channel %s: %v", channelID, err)
+			return out, false
+		}
+		out = append(out, page.Threads...)
+		if !page.HasMore || len(page.Threads) == 0 {
+			return out, true
+		}
+		before = page.Threads[len(page.Threads)-1].ThreadMetadata.ArchiveTimestamp
+		if !m.sleep() {
+			return out, false
+		}
+	}
+}
+
+// threadUpToDate reports whether a listed thread has nothing new since it was fully archived,
+// most archived threads never change again so this saves a request per thread and run.
+func threadUpToDate(channel database.Channel, lastMessageID snowflake.ID) bool {
+	return channel.Backup.Complete && channel.Backup.Ceil != 0 && channel.Backup.Head >= lastMessageID
+}
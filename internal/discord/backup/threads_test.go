@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sprout/internal/platform/database"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// fakeThreads lists threads the way the discord API does, private listings are forbidden.
+type fakeThreads struct {
+	active   []discord.GuildThread
+	archived map[snowflake.ID][][]discord.GuildThread // pages per channel
+	befores  []time.Time
+}
+
+func (f *fakeThreads) GetActiveGuildThreads(guildID snowflake.ID, opts ...rest.RequestOpt) (*discord.GuildActiveThreads, error) {
+	return &discord.GuildActiveThreads{Threads: f.active}, nil
+}
+
+func (f *fakeThreads) GetPublicArchivedThreads(channelID snowflake.ID, before time.Time, limit int, opts ...rest.RequestOpt) (*discord.GetThreads, error) {
+	pages := f.archived[channelID]
+	page := 0
+	if !before.IsZero() {
+		f.befores = append(f.befores, before)
+		page = 1
+	}
+	if page >= len(pages) {
+		return &discord.GetThreads{}, nil
+	}
+	return &discord.GetThreads{Threads: pages[page], HasMore: page < len(pages)-1}, nil
+}
+
+func (f *fakeThreads) GetPrivateArchivedThreads(channelID snowflake.ID, before time.Time, limit int, opts ...rest.RequestOpt) (*discord.GetThreads, error) {
+	return nil, errors.New("403 Forbidden: Missing Access")
+}
+
+func newThread(t *testing.T, id, parentID, lastMessageID snowflake.ID, typ discord.ChannelType, archived time.Time) discord.GuildThread {
+	t.Helper()
+	var thread discord.GuildThread
+	data := fmt.Sprintf(`{"id":"%s","type":%d,"guild_id":"1","name":"thread %s","parent_id":"%s","last_message_id":"%s","thread_metadata":{"archived":true,"archive_timestamp":"%s"}}`,
+		id, typ, id, parentID, lastMessageID, archived.Format(time.RFC3339))
+	if err := thread.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatalf("Failed to build thread: %v", err)
+	}
+	return thread
+}
+
+func TestDiscoverThreads(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	base := time.Now().Add(-1000 * time.Hour)
+	id := func(n int) snowflake.ID { return snowflake.New(base.Add(time.Duration(n) * time.Second)) }
+	guildID, textID, forumID, disabledID := id(0), id(1), id(2), id(3)
+	activeID, pageOneID, pageTwoID, postID := id(10), id(11), id(12), id(13)
+	staleID, privateID, orphanID := id(20), id(21), id(22)
+
+	if _, err := database.UpsertGuild(db, guildID, func(g *database.Guild) error { return nil }); err != nil {
+		t.Fatalf("Failed to create guild: %v", err)
+	}
+	channels := []struct {
+		id       snowflake.ID
+		typ      discord.ChannelType
+		parentID snowflake.ID
+		enabled  bool
+	}{
+		{textID, discord.ChannelTypeGuildText, 0, true},
+		{forumID, discord.ChannelTypeGuildForum, 0, true},
+		{disabledID, discord.ChannelTypeGuildText, 0, false},
+		{staleID, discord.ChannelTypeGuildPublicThread, textID, true},    // deleted since the last run
+		{privateID, discord.ChannelTypeGuildPrivateThread, textID, true}, // can't be listed
+		{orphanID, discord.ChannelTypeGuildPublicThread, disabledID, true},
+		{pageTwoID, discord.ChannelTypeGuildPublicThread, textID, false}, // registered by the gateway
+	}
+	for _, c := range channels {
+		if _, err := database.UpsertChannel(db, c.id, func(ch *database.Channel) error {
+			ch.GuildID = guildID
+			ch.Type = c.typ
+			ch.ParentID = c.parentID
+			ch.Backup.Enabled = c.enabled
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to create channel: %v", err)
+		}
+	}
+
+	archivedAt := base.Add(500 * time.Hour).Truncate(time.Second)
+	src := &fakeThreads{
+		active: []discord.GuildThread{newThread(t, activeID, textID, id(30), discord.ChannelTypeGuildPublicThread, archivedAt)},
+		archived: map[snowflake.ID][][]discord.GuildThread{
+			textID: {
+				{newThread(t, pageOneID, textID, id(31), discord.ChannelTypeGuildPublicThread, archivedAt)},
+				{newThread(t, pageTwoID, textID, id(32), discord.ChannelTypeGuildPublicThread, archivedAt.Add(-time.Hour))},
+			},
+			forumID:    {{newThread(t, postID, forumID, id(33), discord.ChannelTypeGuildPublicThread, archivedAt)}},
+			disabledID: {{newThread(t, id(40), disabledID, id(34), discord.ChannelTypeGuildPublicThread, archivedAt)}},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &Manager{db: db, log: logger, ctx: ctx, cancel: cancel, closeWG: &sync.WaitGroup{}}
+	guilds, err := database.ViewAllGuildsWithChannels(db)
+	if err != nil || len(guilds) != 1 {
+		t.Fatalf("Failed to view guilds: %v", err)
+	}
+	merged, lastMessages := m.discoverThreads(src, guilds[0])
+
+	if len(src.befores) != 1 || !src.befores[0].Equal(archivedAt) {
+		t.Errorf("Expected the second page to be requested before %v, got %v", archivedAt, src.befores)
+	}
+	if len(merged) != len(channels)+3 {
+		t.Errorf("Expected %d channels after discovery, got %d", len(channels)+3, len(merged))
+	}
+	if len(lastMessages) != 4 || lastMessages[pageTwoID] != id(32) {
+		t.Errorf("Expected the last messages of 4 listed threads, got %v", lastMessages)
+	}
+
+	for _, tt := range []struct {
+		name             string
+		id, parentID     snowflake.ID
+		enabled, deleted bool
+	}{
+		{"Active", activeID, textID, true, false},
+		{"Archived", pageOneID, textID, true, false},
+		{"Second Page", pageTwoID, textID, true, false},
+		{"Forum Post", postID, forumID, true, false},
+		{"Stale", staleID, textID, true, true},
+		{"Private Unlisted", privateID, textID, true, false},
+		{"Disabled Parent", orphanID, disabledID, false, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, err := database.ViewChannel(db, tt.id)
+			if err != nil {
+				t.Fatalf("Failed to view thread: %v", err)
+			}
+			if ch.ParentID != tt.parentID || ch.GuildID != guildID || ch.Backup.Enabled != tt.enabled || ch.Deleted != tt.deleted {
+				t.Errorf("Expected parent %s enabled %v deleted %v, got %+v", tt.parentID, tt.enabled, tt.deleted, ch)
+			}
+		})
+	}
+	if _, err := database.ViewChannel(db, id(40)); err == nil {
+		t.Errorf("Expected threads of disabled channels to be ignored")
+	}
+}
+
+func TestThreadUpToDate(t *testing.T) {
+	tests := []struct {
+		name   string
+		backup database.ChannelBackup
+		last   snowflake.ID
+		want   bool
+	}{
+		{"Never Backed Up", database.ChannelBackup{}, 0, false},
+		{"Complete", database.ChannelBackup{Ceil: 50, Head: 60, Tail: 10, Complete: true}, 60, true},
+		{"Empty Thread", database.ChannelBackup{Ceil: 50, Head: 50, Tail: 50, Complete: true}, 0, true},
+		{"New Messages", database.ChannelBackup{Ceil: 50, Head: 60, Tail: 10, Complete: true}, 70, false},
+		{"History Left", database.ChannelBackup{Ceil: 50, Head: 60, Tail: 30}, 60, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := threadUpToDate(database.Channel{Backup: tt.backup}, tt.last); got != tt.want {
+				t.Errorf("threadUpToDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package commands
 
 import (
 	"fmt"
-	"path/filepath"
 	"sprout/internal/app"
 	"sprout/internal/discord/externallinks"
 	"sprout/internal/platform/database"
@@ -64,18 +63,16 @@ var Download = register(BotCommand{
 		if err != nil {
 			return createFollowupMessage(a, event.Token(), "Failed to create session: "+err.Error(), true)
 		}
-		urlBase := fmt.Sprintf("%s/download/a?a=%s&h=", a.BaseURL, token)
 
 		var msg strings.Builder
 		fmt.Fprintf(&msg, "The following download links are valid for %s\n\n", a.AuthManager.TTL().String())
 
 		for _, result := range results {
-			hash := strings.TrimSuffix(filepath.Base(result.Asset.Path), filepath.Ext(result.Asset.Path))
 			u := result.Link.Url
 			if len(u) > 64 {
 				u = u[:61] + "..."
 			}
-			fmt.Fprintf(&msg, "[Download](<%s>) `%s`\n", urlBase+hash, u)
+			fmt.Fprintf(&msg, "[Download](<%s>) `%s`\n", externallinks.DownloadURL(a, token, externallinks.AssetHash(result.Asset)), u)
 		}
 
 		return createFollowupMessage(a, event.Token(), msg.String(), true)
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"sprout/internal/app"
 	"sprout/internal/discord/attachments"
+	"sprout/internal/discord/backup"
 	"sprout/internal/discord/emojis"
+	"sprout/internal/discord/externallinks"
 	"sprout/internal/discord/response"
 	"sprout/internal/platform/database"
 
@@ -88,6 +90,18 @@ var Favorite = register(BotCommand{
 			return createFollowupMessage(a, event.Token(), "Internal error", true)
 		}
 
+		// keep the mirrors of the message, retention never evicts favorites
+		if _, err := database.SetAssetsFavorite(a.DB, favoriteAssetKeys(&message)); err != nil {
+			a.Log.Error("Failed to mark favorite assets: ", err)
+		}
+
+		// links that are dead by now get their mirror under the favorite, compressing takes a while
+		a.DiscordWG.Add(1)
+		go func() {
+			defer a.DiscordWG.Done()
+			replyDeadLinks(a, guild, &message, favChannel.ID(), favMsgOut.ID)
+		}()
+
 		// react to original message
 		favEmoji, ok := emojis.GetRandFavEmoji(a)
 		if !ok {
@@ -102,6 +116,37 @@ var Favorite = register(BotCommand{
 	},
 })
 
+// favoriteAssetKeys returns the keys the mirrors of a message's links and attachments are stored under.
+func favoriteAssetKeys(message *discord.Message) []string {
+	var keys []string
+	for _, link := range append(externallinks.ExtractLinks(message), externallinks.ExtractLinksFromButtons(message)...) {
+		keys = append(keys, link.Url)
+	}
+	for _, att := range message.Attachments {
+		keys = append(keys, backup.AttachmentKey(att.URL))
+	}
+	return keys
+}
+
+// replyDeadLinks replies to the favorite of a message with the mirrors of its links whose source is gone.
+func replyDeadLinks(a *app.App, guild *database.Guild, message *discord.Message, favChannelID, favMsgID snowflake.ID) {
+	for _, link := range externallinks.ExtractLinks(message) {
+		asset, err := database.ViewAsset(a.DB, link.Url)
+		if err != nil {
+			if !lmdb.IsNotFound(err) {
+				a.Log.Error("Failed to get asset: ", err)
+			}
+			continue
+		}
+		if !asset.Dead() {
+			continue
+		}
+		if err := externallinks.ReplyWithMirror(a, guild, favChannelID, favMsgID, link.Url, asset); err != nil {
+			a.Log.Errorf("Failed to reply with mirror of %s: %v", link.Url, err)
+		}
+	}
+}
+
 func buildFavoriteMessage(a *app.App, message discord.Message) discord.MessageCreate {
 	var content string
 	if message.Content != "" {
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sprout/internal/app"
+	"sprout/internal/discord/backup"
+	"sprout/internal/discord/response"
+	"sprout/internal/platform/database"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+var Replay = register(BotCommand{
+	IsGlobal:     false,
+	RequireAdmin: true,
+	FilterBots:   true,
+	Data: discord.SlashCommandCreate{
+		Name:        "replay",
+		Description: "Recreate an archived channel in another channel, run it again to resume",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "source",
+				Description: "ID or mention of the archived channel, may be deleted or in another server",
+				Required:    true,
+			},
+			discord.ApplicationCommandOptionChannel{
+				Name:         "destination",
+				Description:  "Channel to post into, needs the Manage Webhooks permission",
+				Required:     true,
+				ChannelTypes: []discord.ChannelType{discord.ChannelTypeGuildText, discord.ChannelTypeGuildNews},
+			},
+		},
+	},
+	Handler: func(a *app.App, event *events.ApplicationCommandInteractionCreate) error {
+		if err := event.DeferCreateMessage(true); err != nil {
+			return err
+		}
+
+		data := event.SlashCommandInteractionData()
+		raw := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(data.String("source")), "<#"), ">")
+		sourceID, err := snowflake.Parse(raw)
+		if err != nil {
+			return createFollowupMessage(a, event.Token(), "Invalid source channel, use its ID or mention", true)
+		}
+		destID := data.Channel("destination").ID
+		guildID := *event.GuildID()
+
+		guild, err := database.ViewGuild(a.DB, guildID)
+		if err != nil {
+			a.Log.Error("Failed to get guild: ", err)
+			return createFollowupMessage(a, event.Token(), "Internal error", true)
+		}
+
+		// the interaction token expires long before big replays finish, report to the bot channel
+		n, err := a.Replayer.Replay(a.Client.Rest, sourceID, destID, *guild, func(state database.Replay, err error) {
+			content := fmt.Sprintf("Replay of `%s` into <#%s> finished, %d messages.", sourceID, destID, state.Replayed)
+			if err != nil {
+				content = fmt.Sprintf("Replay of `%s` into <#%s> stopped after %d messages: %s\nRun `/replay` again to resume.", sourceID, destID, state.Replayed, err)
+			}
+			if _, err := response.MessageBotChannel(a, guildID, discord.NewMessageCreateBuilder().SetContent(content).Build()); err != nil {
+				a.Log.Warnf("Failed to report replay result: %v", err)
+			}
+		})
+		if errors.Is(err, backup.ErrReplayRunning) {
+			return createFollowupMessage(a, event.Token(), "This replay is already running.", true)
+		}
+		if err != nil {
+			return createFollowupMessage(a, event.Token(), fmt.Sprintf("Failed to start replay: %s", err), true)
+		}
+		if n == 0 {
+			return createFollowupMessage(a, event.Token(), "Nothing left to replay from that channel.", true)
+		}
+		return createFollowupMessage(a, event.Token(), fmt.Sprintf("Replaying %d messages into <#%s>, the result will be posted in the bot channel.", n, destID), true)
+	},
+})
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"fmt"
+	"sprout/internal/app"
+	"sprout/internal/platform/database"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const (
+	searchLimit      = 10
+	searchSnippetLen = 120
+	searchDateLayout = "2006-01-02"
+)
+
+var Search = register(BotCommand{
+	IsGlobal:     false,
+	RequireAdmin: false,
+	FilterBots:   true,
+	Data: discord.SlashCommandCreate{
+		Name:        "search",
+		Description: "Search the message archive of this server, including deleted channels",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "query",
+				Description: "Words to search for, all must match",
+				Required:    true,
+			},
+			discord.ApplicationCommandOptionUser{
+				Name:        "author",
+				Description: "Only messages from this user",
+			},
+			discord.ApplicationCommandOptionChannel{
+				Name:        "channel",
+				Description: "Only messages in this channel",
+			},
+			discord.ApplicationCommandOptionString{
+				Name:        "after",
+				Description: "Only messages on or after this date (YYYY-MM-DD)",
+			},
+			discord.ApplicationCommandOptionString{
+				Name:        "before",
+				Description: "Only messages on or before this date (YYYY-MM-DD)",
+			},
+		},
+	},
+	Handler: func(a *app.App, event *events.ApplicationCommandInteractionCreate) error {
+		if err := event.DeferCreateMessage(true); err != nil {
+			return err
+		}
+
+		// same access as downloading the backups
+		user, err := database.ViewUser(a.DB, event.User().ID)
+		if err != nil {
+			a.Log.Error("Failed to get user: ", err)
+			return createFollowupMessage(a, event.Token(), "Internal error", true)
+		}
+		if !(user.IsAdmin || user.BackupAccess) {
+			return createFollowupMessage(a, event.Token(), "You need backup access to search the archive. Ask an admin.", true)
+		}
+
+		// parse options
+		data := event.SlashCommandInteractionData()
+		query := database.SearchQuery{
+			Text:     data.String("query"),
+			GuildIDs: []snowflake.ID{*event.GuildID()},
+			Limit:    searchLimit,
+		}
+		if author, ok := data.OptUser("author"); ok {
+			query.AuthorID = author.ID
+		}
+		if channel, ok := data.OptChannel("channel"); ok {
+			query.ChannelID = channel.ID
+		}
+		if after, ok := data.OptString("after"); ok {
+			if query.After, err = time.Parse(searchDateLayout, after); err != nil {
+				return createFollowupMessage(a, event.Token(), "Invalid `after` date, use YYYY-MM-DD", true)
+			}
+		}
+		if before, ok := data.OptString("before"); ok {
+			if query.Before, err = time.Parse(searchDateLayout, before); err != nil {
+				return createFollowupMessage(a, event.Token(), "Invalid `before` date, use YYYY-MM-DD", true)
+			}
+			query.Before = query.Before.Add(24*time.Hour - time.Nanosecond) // inclusive
+		}
+
+		result, err := database.Search(a.DB, query)
+		if err != nil {
+			return createFollowupMessage(a, event.Token(), fmt.Sprintf("Search failed: %s", err), true)
+		}
+		if result.Total == 0 {
+			return createFollowupMessage(a, event.Token(), "No archived messages found.", true)
+		}
+
+		// build result list, each entry links back to the message like favorites do
+		var sb strings.Builder
+		shown := 0
+		for _, msg := range result.Messages {
+			channel := fmt.Sprintf("<#%s>", msg.ChannelID)
+			if ch, err := database.ViewChannel(a.DB, msg.ChannelID); err == nil && ch.Deleted {
+				channel = fmt.Sprintf("#%s (deleted)", ch.Name)
+			}
+			entry := fmt.Sprintf("\n%s [jump](https://discord.com/channels/%s/%s/%s) `%s` • <t:%d:f>\n> %s\n",
+				channel, msg.GuildID, msg.ChannelID, msg.ID, msg.Author, msg.Created.Unix(), snippet(msg.Content))
+			if sb.Len()+len(entry) > 1900 { // leave room for the header
+				break
+			}
+			sb.WriteString(entry)
+			shown++
+		}
+		header := fmt.Sprintf("**%d** result(s), showing the newest %d\n", result.Total, shown)
+		return createFollowupMessage(a, event.Token(), header+sb.String(), true)
+	},
+})
+
+// snippet flattens and truncates message content for result lists.
+func snippet(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if r := []rune(content); len(r) > searchSnippetLen {
+		content = string(r[:searchSnippetLen]) + "…"
+	}
+	return content
+}
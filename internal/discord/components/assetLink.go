@@ -0,0 +1,31 @@
+package components
+
+import (
+	"fmt"
+	"sprout/internal/app"
+	"sprout/internal/discord/externallinks"
+	"sprout/pkg/xcrypto"
+
+	"github.com/disgoorg/disgo/events"
+)
+
+// AssetLink answers with a download link of an asset for the user who clicked, the links carry
+// a session of that user so they're never posted publicly.
+var AssetLink = register(BotComponent{
+	ID: "asset_link",
+	Handler: func(a *app.App, event *events.ComponentInteractionCreate, idParts []string) error {
+		// parse interaction ID parts
+		if len(idParts) != 1 || !xcrypto.IsSHA256LowerHex(idParts[0]) {
+			event.CreateMessage(buildMsg("An error occurred."))
+			return fmt.Errorf("asset_link interaction without asset hash: %s", event.Data.CustomID())
+		}
+
+		token, err := a.AuthManager.NewParamSession(a.DB, event.User().ID)
+		if err != nil {
+			event.CreateMessage(buildMsg("Failed to create session."))
+			return fmt.Errorf("failed to create session: %w", err)
+		}
+		msg := fmt.Sprintf("[Download](<%s>), valid for %s", externallinks.DownloadURL(a, token, idParts[0]), a.AuthManager.TTL().String())
+		return event.CreateMessage(buildMsg(msg))
+	},
+})
@@ -6,12 +6,20 @@ import (
 	"sprout/internal/discord/externallinks"
 	"sprout/internal/platform/database"
 	"sprout/internal/platform/download"
+	"sprout/internal/platform/download/extractors"
 	"sprout/pkg/x"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const (
+	confirmedDownloadTimeout = 30 * time.Minute
+	progressEditInterval     = 5 * time.Second // between progress edits of the status message
 )
 
 var Download = register(BotComponent{
@@ -35,49 +43,160 @@ var Download = register(BotComponent{
 		}
 		confirm := x.Ternary(idParts[0] == "confirm", true, false)
 
-		// delete message containing the component
-		if err := a.Client.Rest.DeleteMessage(event.Message.ChannelID, event.Message.ID); err != nil {
-			a.Log.Errorf("Error deleting message containing component: %s", err)
-		}
-
 		if !confirm {
-			return nil
+			// delete message containing the component
+			if err := a.Client.Rest.DeleteMessage(event.Message.ChannelID, event.Message.ID); err != nil {
+				a.Log.Errorf("Error deleting message containing component: %s", err)
+			}
+			return event.Respond(discord.InteractionResponseTypeDeferredUpdateMessage, nil)
 		}
 
-		// TODO: download the big yt video
-
 		// link if first field
 		fields := strings.Fields(event.Message.Content)
 		if len(fields) < 2 {
 			event.CreateMessage(buildMsg("An error occurred."))
 			return fmt.Errorf("download interaction without content copy message ID: %s", event.Data.CustomID())
 		}
-		link := fields[0]
-		if download.ParseDomain(link) != download.DomainYouTube {
+		link := extractors.Canonical(fields[0])
+		ex := extractors.Find(link)
+		if ex == nil {
 			event.CreateMessage(buildMsg("An error occurred."))
 			return fmt.Errorf("download interaction without content copy message ID: %s", event.Data.CustomID())
 		}
 
-		// download
-		var path string
-		wg := &sync.WaitGroup{}
-		wg.Add(1)
-		a.YoutubeQueue.Enqueue(link, false, func() error {
-			path, err = download.YtDLP(a.Context, link, a.TempDir, 30*time.Minute)
-			wg.Done()
-			return err
-		})
-		wg.Wait()
-		if err != nil {
-			return fmt.Errorf("failed to download: %w", err)
-		}
-
-		// add asset
-		if err := externallinks.AddAsset(a, link, path); err != nil {
-			a.Log.Error("Failed to add asset: ", err)
-			return err
+		// the prompt becomes the status message of the download
+		if err := event.UpdateMessage(discord.NewMessageUpdateBuilder().
+			SetContentf("⏳ %s is queued, confirmed by `%s`", link, event.User().Username).
+			ClearComponents().
+			Build()); err != nil {
+			return fmt.Errorf("failed to update prompt: %w", err)
 		}
 
+		// the download can take a while, don't hold the event slot
+		a.DiscordWG.Add(1)
+		go func() {
+			defer a.DiscordWG.Done()
+			d := &confirmedDownload{
+				a:         a,
+				guildID:   *event.GuildID(),
+				channelID: event.Message.ChannelID,
+				messageID: event.Message.ID,
+				link:      link,
+				ex:        ex,
+			}
+			d.run()
+		}()
 		return nil
 	},
 })
+
+// confirmedDownload is a download of long media an admin confirmed, reported in the status message.
+type confirmedDownload struct {
+	a                             *app.App
+	guildID, channelID, messageID snowflake.ID
+	link                          string
+	ex                            extractors.Extractor
+
+	mu       sync.Mutex
+	lastEdit time.Time
+}
+
+func (d *confirmedDownload) run() {
+	a := d.a
+	d.status(true, "⏳ Extracting %s", d.link)
+
+	// extract, the length was already confirmed
+	var result extractors.Result
+	var errMsg string
+	var err error
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	if !a.ExtractorQueue(d.ex, d.link).Enqueue(d.link, false, func() error {
+		defer wg.Done()
+		result, errMsg, err = d.ex.Extract(a.Context, d.link, a.UserAgent)
+		return err
+	}) {
+		d.status(true, "✖ %s is already being downloaded", d.link)
+		return
+	}
+	wg.Wait()
+	if err != nil {
+		a.Log.Errorf("Failed to extract %s: %v", d.link, err)
+		d.status(true, "✖ Failed to extract %s: %s", d.link, x.Ternary(errMsg != "", errMsg, "unknown error"))
+		return
+	}
+	if result.Kind != extractors.ResultMedia {
+		d.status(true, "✖ %s has no media to download", d.link)
+		return
+	}
+
+	// download
+	d.status(true, "⬇ Downloading %s", d.link)
+	files, err := externallinks.Download(a, d.ex, d.link, result.Media, confirmedDownloadTimeout, d.progress)
+	if err != nil {
+		a.Log.Errorf("Failed to download %s: %v", d.link, err)
+		d.status(true, "✖ Failed to download %s", d.link)
+		return
+	}
+
+	// add asset
+	d.status(true, "⏳ Storing %s", d.link)
+	if err := externallinks.Store(a, d.guildID, d.link, files, result.NSFW); err != nil {
+		a.Log.Error("Failed to add asset: ", err)
+		d.status(true, "✖ Failed to store %s", d.link)
+		return
+	}
+	asset, err := database.ViewAsset(a.DB, d.link)
+	if err != nil {
+		a.Log.Error("Failed to get asset: ", err)
+		d.status(true, "✖ Failed to store %s", d.link)
+		return
+	}
+
+	// links are per user, so the button hands them out instead of posting one here
+	if _, err := a.Client.Rest.UpdateMessage(d.channelID, d.messageID, discord.NewMessageUpdateBuilder().
+		SetContentf("✔ Stored %s (%s)", d.link, formatSize(asset.Size)).
+		AddActionRow(discord.NewSecondaryButton("Get download link", "asset_link."+externallinks.AssetHash(asset))).
+		Build()); err != nil {
+		a.Log.Error("Failed to update download status: ", err)
+	}
+}
+
+// progress reports yt-dlp progress, at most every progressEditInterval.
+func (d *confirmedDownload) progress(p download.Progress) {
+	if p.Total > 0 {
+		d.status(false, "⬇ Downloading %s: %d%% (%s of %s)", d.link, p.Downloaded*100/p.Total, formatSize(p.Downloaded), formatSize(p.Total))
+	} else {
+		d.status(false, "⬇ Downloading %s: %s", d.link, formatSize(p.Downloaded))
+	}
+}
+
+// status edits the status message, progress updates are dropped if the last edit was too recent.
+func (d *confirmedDownload) status(force bool, format string, args ...any) {
+	d.mu.Lock()
+	if !force && time.Since(d.lastEdit) < progressEditInterval {
+		d.mu.Unlock()
+		return
+	}
+	d.lastEdit = time.Now()
+	d.mu.Unlock()
+	if _, err := d.a.Client.Rest.UpdateMessage(d.channelID, d.messageID, discord.NewMessageUpdateBuilder().
+		SetContentf(format, args...).
+		Build()); err != nil {
+		d.a.Log.Error("Failed to update download status: ", err)
+	}
+}
+
+// formatSize formats a byte count for display, e.g. "1.5 GB".
+func formatSize(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size, i := float64(bytes), 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
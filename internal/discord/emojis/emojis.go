@@ -3,7 +3,7 @@ package emojis
 import (
 	"math/rand"
 	"sprout/internal/app"
-	"sprout/internal/platform/download"
+	"sprout/internal/platform/download/extractors"
 	"strings"
 	"sync"
 
@@ -14,10 +14,7 @@ const (
 	SpinnerPrefix = "spinner"
 	FavPrefix     = "fav"
 
-	// social media prefixes
-	RedditPrefix  = "reddit"
-	YtPrefix      = "youtube"
-	RedGifsPrefix = "18_plus"
+	// social media prefix of links without an extractor, the rest come from extractors.Info
 	UnknownPrefix = "unknown"
 )
 
@@ -58,17 +55,15 @@ func GetRandFavEmoji(a *app.App) (discord.Emoji, bool) {
 	return favoriteEmojis[rand.Intn(len(favoriteEmojis))], true
 }
 
-func GetSocialMediaEmoji(a *app.App, domain download.Domain) (discord.Emoji, bool) {
-	switch domain {
-	case download.DomainReddit:
-		return get(a, RedditPrefix)
-	case download.DomainYouTube, download.DomainYoutubeShorts:
-		return get(a, YtPrefix)
-	case download.DomainRedGifs:
-		return get(a, RedGifsPrefix)
-	default:
-		return get(a, UnknownPrefix)
+// GetSocialMediaEmoji returns the emoji of a link resolved by the given extractor, ex may be nil.
+// Falls back to the unknown emoji if the app has none for the extractor.
+func GetSocialMediaEmoji(a *app.App, ex extractors.Extractor, rawURL string) (discord.Emoji, bool) {
+	if ex != nil {
+		if emoji, ok := get(a, extractors.Emoji(ex, rawURL)); ok {
+			return emoji, true
+		}
 	}
+	return get(a, UnknownPrefix)
 }
 
 func get(a *app.App, prefix string) (discord.Emoji, bool) {
@@ -4,44 +4,42 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"slices"
 	"sprout/internal/app"
+	"sprout/internal/platform/auth"
 	"sprout/internal/platform/database"
 	"sprout/internal/platform/download"
-	"sprout/pkg/xcrypto"
+	"sprout/internal/platform/download/extractors"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
 )
 
-var AntiRotDomains = []download.Domain{
-	download.DomainReddit,
-	download.DomainYouTube,
-	download.DomainYoutubeShorts,
-	download.DomainRedGifs,
-}
-
 type Link struct {
 	Url         string
-	Domain      download.Domain
+	Extractor   extractors.Extractor // nil for button links no extractor matches
 	CrossSrcUrl string
+	NSFW        bool // marked NSFW by the post that linked it
 }
 
+// ExtractLinks returns the links of registered extractors in the message, in canonical form.
 func ExtractLinks(message *discord.Message) []Link {
-	// extract anti-rot supported links into slice.
 	fields := strings.Fields(message.Content)
 	links := make([]Link, 0)
 	for _, field := range fields {
 		if download.IsSingleValidURL(field) {
-			domain := download.ParseDomain(field)
-			if slices.Contains(AntiRotDomains, domain) {
-				links = append(links, Link{Url: field, Domain: domain})
+			url := extractors.Canonical(field)
+			if ex := extractors.Find(url); ex != nil {
+				links = append(links, Link{Url: url, Extractor: ex})
 			}
 		}
 	}
 	return links
 }
 
+// ExtractLinksFromButtons returns the links of the link buttons of auto expand output, in canonical form.
 func ExtractLinksFromButtons(message *discord.Message) []Link {
 	links := make([]Link, 0)
 	for _, c := range message.Components {
@@ -52,7 +50,8 @@ func ExtractLinksFromButtons(message *discord.Message) []Link {
 		for _, comp := range discordActionRow.Components {
 			if linkButton, ok := comp.(discord.ButtonComponent); ok {
 				if (linkButton.Style == discord.ButtonStyleLink) && ((linkButton.Emoji != nil) || (linkButton.Label == "▲")) {
-					links = append(links, Link{Url: linkButton.URL, Domain: download.ParseDomain(linkButton.URL)})
+					url := extractors.Canonical(linkButton.URL)
+					links = append(links, Link{Url: url, Extractor: extractors.Find(url)})
 				}
 			}
 		}
@@ -62,30 +61,91 @@ func ExtractLinksFromButtons(message *discord.Message) []Link {
 }
 
 // AddAsset is a helper for adding downloaded temp files to the database / assets directory.
-func AddAsset(a *app.App, url, path string) error {
-	// hash
-	hash, err := xcrypto.FileSHA256(path)
-	if err != nil {
-		return fmt.Errorf("failed to hash: %w", err)
-	}
-	assetName := fmt.Sprintf("%s%s", hash, filepath.Ext(path))
-	finalPath := database.ToAssetPath(filepath.Join(a.StorageDir, "assets"), assetName)
+// The asset is keyed by the canonical form of url.
+func AddAsset(a *app.App, guildID snowflake.ID, url string, file download.File) error {
+	_, err := database.StoreAsset(a.DB, a.StorageDir, guildID, extractors.Canonical(url), file.Path, file.SHA256)
+	return err
+}
 
-	// move
-	// create directory if it doesn't exist
-	if err := os.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+// AddGallery is AddAsset for multi-item posts, the items are stored as one gallery asset.
+func AddGallery(a *app.App, guildID snowflake.ID, url string, files []download.File) error {
+	paths, hashes := make([]string, len(files)), make([]string, len(files))
+	for i, f := range files {
+		paths[i], hashes[i] = f.Path, f.SHA256
 	}
-	if err := os.Rename(path, finalPath); err != nil {
-		return fmt.Errorf("failed to move: %w", err)
+	_, err := database.StoreGallery(a.DB, a.StorageDir, guildID, extractors.Canonical(url), paths, hashes)
+	return err
+}
+
+// AssetHash returns the hash an asset is served under by /download/a.
+func AssetHash(asset *database.Asset) string {
+	return strings.TrimSuffix(filepath.Base(asset.Path), filepath.Ext(asset.Path))
+}
+
+// DownloadURL returns the link of an asset for the holder of a param session token,
+// valid for as long as the session is.
+func DownloadURL(a *app.App, token, hash string) string {
+	return fmt.Sprintf("%s/download/a?%s=%s&h=%s", a.BaseURL, auth.ParamName, token, hash)
+}
+
+// Download fetches media resolved by ex into temp files, in the extractor's queue.
+// ytTimeout bounds yt-dlp downloads, which can be whole videos, onProgress (optional) follows them.
+// On error no files are left behind.
+func Download(a *app.App, ex extractors.Extractor, srcURL string, media []extractors.Media, ytTimeout time.Duration, onProgress func(download.Progress)) ([]download.File, error) {
+	files := make([]download.File, 0, len(media))
+	for i, m := range media {
+		// the queue only forgets an id once its job returned, after the waits on it end,
+		// so neither the extract job of srcURL nor the previous item can share it
+		id := fmt.Sprintf("%s#%d", srcURL, i)
+		var file download.File
+		var err error
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		if !a.ExtractorQueue(ex, srcURL).Enqueue(id, false, func() error {
+			defer wg.Done()
+			switch {
+			case m.YtDLP:
+				file.Path, err = download.YtDLP(a.Context, m.URL, a.TempDir, ytTimeout, onProgress)
+			case m.Ext != "":
+				var plan download.DownloadPlan
+				if plan, err = download.ParseMediaURLAs(m.URL, m.Ext); err == nil {
+					file, err = download.DownloadWithPlan(plan, a.TempDir, a.UserAgent, 10*time.Second)
+				}
+			default:
+				file, err = download.DownloadMedia(m.URL, a.TempDir, a.UserAgent, 10*time.Second)
+			}
+			return err
+		}) {
+			err = fmt.Errorf("already queued: %s", id)
+			wg.Done()
+		}
+		wg.Wait()
+		if err != nil {
+			for _, f := range files {
+				os.Remove(f.Path)
+			}
+			return nil, err
+		}
+		files = append(files, file)
 	}
+	return files, nil
+}
 
-	// upsert
-	if _, err := database.UpsertAsset(a.DB, url, func(asset *database.Asset) error {
-		asset.Path = finalPath
-		return nil
-	}); err != nil {
-		return fmt.Errorf("failed to upsert asset: %w", err)
+// Store adds downloaded media as the mirror of url, several files are stored as a gallery.
+// NSFW media is flagged so expansions outside NSFW channels are spoilered.
+func Store(a *app.App, guildID snowflake.ID, url string, files []download.File, nsfw bool) error {
+	var err error
+	if len(files) == 1 {
+		err = AddAsset(a, guildID, url, files[0])
+	} else {
+		err = AddGallery(a, guildID, url, files)
 	}
-	return nil
+	if err != nil || !nsfw {
+		return err
+	}
+	_, err = database.UpsertAsset(a.DB, extractors.Canonical(url), func(asset *database.Asset) error {
+		asset.NSFW = true
+		return nil
+	})
+	return err
 }
@@ -0,0 +1,210 @@
+package externallinks
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sprout/internal/app"
+	"sprout/internal/platform/database"
+	"sprout/pkg/compressor"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const MaxGalleryItems = 10 // per media gallery, also the attachment limit of a message
+
+// MediaFile is a compressed item ready for upload.
+type MediaFile struct {
+	Path string
+	Size int64
+}
+
+// PrepareAsset copies an asset into tempDir and compresses it for upload, galleries are unpacked
+// into their items. A gallery item that can't be posted is left out instead of failing the whole gallery.
+func PrepareAsset(a *app.App, tempDir, url string, asset *database.Asset, uploadSizeLimit int64) ([]MediaFile, error) {
+	// copy asset to temp dir
+	var inPaths []string
+	if database.IsGallery(asset.Path) {
+		var err error
+		if inPaths, err = database.ExtractGallery(asset.Path, tempDir); err != nil {
+			return nil, fmt.Errorf("failed to extract gallery: %w", err)
+		}
+	} else {
+		inPath := filepath.Join(tempDir, filepath.Base(asset.Path))
+		if err := copyFile(asset.Path, inPath); err != nil {
+			return nil, fmt.Errorf("failed to copy asset: %w", err)
+		}
+		inPaths = []string{inPath}
+	}
+
+	// compress
+	files := make([]MediaFile, 0, len(inPaths))
+	for _, inPath := range inPaths {
+		file, err := prepareMedia(a, tempDir, inPath)
+		if err == nil && file.Size > uploadSizeLimit {
+			err = fmt.Errorf("file is too big: %s (%d bytes)", file.Path, file.Size)
+		}
+		if err != nil {
+			if len(inPaths) == 1 {
+				return nil, err
+			}
+			a.Log.Warnf("Skipping gallery item of %s: %v", url, err)
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no gallery item could be prepared: %s", url)
+	}
+	return files, nil
+}
+
+// prepareMedia compresses a media file for upload, gifs and webp are kept as is.
+func prepareMedia(a *app.App, tempDir, inPath string) (MediaFile, error) {
+	// get type
+	mediaType := compressor.MediaTypeFromExt(filepath.Ext(inPath))
+	if mediaType == "" {
+		return MediaFile{}, fmt.Errorf("failed to get media type: %s", filepath.Ext(inPath))
+	}
+
+	// compress it, skip if it's a gif or webp
+	var outPath string
+	if mediaType == "gif" || mediaType == "webp" {
+		outPath = inPath
+	} else {
+		baseName := strings.TrimSuffix(filepath.Base(inPath), filepath.Ext(inPath))
+		switch mediaType {
+		case compressor.MediaTypeVideo:
+			outPath = filepath.Join(tempDir, "out"+baseName+".webm")
+			if err := a.Compressor.Video(a.Context, inPath, outPath, 5*time.Minute); err != nil {
+				return MediaFile{}, fmt.Errorf("failed to compress video: %w", err)
+			}
+		case compressor.MediaTypeImage:
+			outPath = filepath.Join(tempDir, "out"+baseName+".avif")
+			if err := a.Compressor.Image(a.Context, inPath, outPath, 30*time.Second); err != nil {
+				return MediaFile{}, fmt.Errorf("failed to compress image: %w", err)
+			}
+		default:
+			return MediaFile{}, fmt.Errorf("failed to get media type: %s", mediaType)
+		}
+	}
+
+	// check size
+	fileInfo, err := os.Stat(outPath)
+	if err != nil {
+		return MediaFile{}, fmt.Errorf("failed to get file info: %w", err)
+	}
+	if fileInfo.Size() <= 0 {
+		return MediaFile{}, fmt.Errorf("file is empty: %s", outPath)
+	}
+	return MediaFile{Path: outPath, Size: fileInfo.Size()}, nil
+}
+
+// SplitMedia groups files in order into messages of at most MaxGalleryItems files whose
+// total size stays within the upload limit. Every file must fit the limit on its own.
+func SplitMedia(files []MediaFile, uploadSizeLimit int64) [][]MediaFile {
+	var parts [][]MediaFile
+	var current []MediaFile
+	var size int64
+	for _, file := range files {
+		if len(current) == MaxGalleryItems || (len(current) > 0 && size+file.Size > uploadSizeLimit) {
+			parts = append(parts, current)
+			current, size = nil, 0
+		}
+		current = append(current, file)
+		size += file.Size
+	}
+	if len(current) > 0 {
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+// IsNSFWChannel reports whether a channel, or the parent of a thread, is age restricted.
+func IsNSFWChannel(a *app.App, channelID snowflake.ID) bool {
+	if thread, ok := a.Client.Caches.GuildThread(channelID); ok && thread.ParentID() != nil {
+		channelID = *thread.ParentID()
+	}
+	channel, ok := a.Client.Caches.GuildTextChannel(channelID)
+	return ok && channel.NSFW()
+}
+
+// DeadNote tells that the source of an asset is gone, "" while it's alive.
+func DeadNote(asset *database.Asset) string {
+	what := "is no longer available"
+	if asset.Source == database.SourceDeleted {
+		what = "was deleted"
+	}
+	switch {
+	case !asset.Dead():
+		return ""
+	case asset.SourceDied.IsZero():
+		return "The source " + what
+	default:
+		return fmt.Sprintf("The source %s, gone since <t:%d:R>", what, asset.SourceDied.Unix())
+	}
+}
+
+// ReplyWithMirror replies to a message with the mirror of a link whose source is gone, noting since when.
+func ReplyWithMirror(a *app.App, guild *database.Guild, channelID, messageID snowflake.ID, url string, asset *database.Asset) error {
+	tempDir, err := os.MkdirTemp(a.TempDir, "")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	uploadSizeLimit := guild.UploadLimit()
+	files, err := PrepareAsset(a, tempDir, url, asset, uploadSizeLimit)
+	if err != nil {
+		return err
+	}
+
+	// NSFW posts are spoilered outside NSFW channels
+	spoiler := asset.NSFW && !IsNSFWChannel(a, channelID)
+
+	for i, part := range SplitMedia(files, uploadSizeLimit) {
+		builder := discord.NewMessageCreateBuilder().SetFlags(discord.MessageFlagIsComponentsV2)
+		if i == 0 {
+			builder.SetMessageReferenceByID(messageID)
+			builder.AddComponents(discord.NewTextDisplay(fmt.Sprintf("%s, here's the mirror of <%s>", DeadNote(asset), url)))
+		}
+		items := make([]discord.MediaGalleryItem, 0, len(part))
+		for j, f := range part {
+			file, err := os.Open(f.Path)
+			if err != nil {
+				return fmt.Errorf("failed to open file: %w", err)
+			}
+			defer file.Close()
+			aName := fmt.Sprintf("%d-%s", j, filepath.Base(f.Path))
+			builder.AddFile(aName, "", file)
+			items = append(items, discord.MediaGalleryItem{Media: discord.UnfurledMediaItem{URL: "attachment://" + aName}, Spoiler: spoiler})
+		}
+		builder.AddComponents(discord.NewMediaGallery(items...))
+		if _, err := a.Client.Rest.CreateMessage(channelID, builder.Build()); err != nil {
+			return fmt.Errorf("failed to create message: %w", err)
+		}
+	}
+	return nil
+}
+
+// copyFile copies a file from src to dst.
+func copyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	_, err = io.Copy(dstFile, srcFile)
+	return err
+}
@@ -0,0 +1,26 @@
+package listeners
+
+import (
+	"slices"
+	"sprout/internal/app"
+	"sprout/internal/discord/chat"
+
+	"github.com/disgoorg/disgo/events"
+)
+
+func OnGuildMessageDelete(a *app.App, event *events.GuildMessageDelete) {
+	a.DiscordWG.Add(1) // track for graceful shutdown
+	defer a.DiscordWG.Done()
+
+	// drop from ai chat buffer so there's no responding to content that's gone, tombstones stay
+	a.Chat.UpsertChannelMessages(event.ChannelID, event.GuildID, func(buf []chat.Message) []chat.Message {
+		return slices.DeleteFunc(buf, func(m chat.Message) bool {
+			return m.ID == event.MessageID && m.Role != "system"
+		})
+	})
+
+	// message is the zero value if it wasn't cached
+	if err := a.Backup.ArchiveDelete(event.GuildID, event.ChannelID, event.MessageID, &event.Message); err != nil {
+		a.Log.Errorf("Failed to archive deletion of message %s: %v", event.MessageID, err)
+	}
+}
@@ -0,0 +1,83 @@
+package listeners
+
+import (
+	"sprout/internal/app"
+	"sprout/internal/discord/chat"
+	"sprout/internal/platform/database"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func OnGuildMessageUpdate(a *app.App, event *events.GuildMessageUpdate) {
+	// bot edits, like the progress of our own status messages, are neither archived nor chatted about
+	if event.Message.Author.Bot {
+		return
+	}
+
+	a.DiscordWG.Add(1) // track for graceful shutdown
+
+	// acquire semaphore
+	select {
+	case a.DiscordEventLimiter <- struct{}{}:
+	default:
+		a.DiscordWG.Done()
+		a.Log.Warn("Event limiter reached, dropping guild message update")
+		return
+	}
+
+	go func() {
+		defer a.DiscordWG.Done()
+		defer func() { <-a.DiscordEventLimiter }()
+
+		// skip channels nothing keeps messages of before asking for the full message
+		archived, err := a.Backup.IsArchived(event.GuildID, event.ChannelID)
+		if err != nil {
+			a.Log.Errorf("Failed to check if channel %s is archived: %v", event.ChannelID, err)
+			return
+		}
+		if !archived && !isChatChannel(a, event.GuildID, event.ChannelID) {
+			return
+		}
+
+		// the event can be partial (e.g. embed unfurls), get the full message like on create
+		message, err := a.Client.Rest.GetMessage(event.ChannelID, event.MessageID)
+		if err != nil {
+			a.Log.Error("Failed to get message: ", err)
+			return
+		}
+
+		// update ai chat buffer, keep the original time so an edit doesn't look like a new message
+		a.Chat.UpsertChannelMessages(message.ChannelID, event.GuildID, func(buf []chat.Message) []chat.Message {
+			for i := range buf {
+				if buf[i].ID == message.ID && buf[i].Role != "system" { // tombstones stay as they are
+					updated := chat.ParseUserMessage(message, a.Client)
+					updated.Created = buf[i].Created
+					buf[i] = updated
+					a.Log.Debugf("Updated message in chat: %s", message.ID)
+					break
+				}
+			}
+			return buf
+		})
+
+		var old *discord.Message
+		if event.OldMessage.ID != 0 {
+			old = &event.OldMessage
+		}
+		if err := a.Backup.ArchiveEdit(event.GuildID, old, message); err != nil {
+			a.Log.Errorf("Failed to archive edit of message %s: %v", message.ID, err)
+		}
+	}()
+}
+
+// isChatChannel reports whether the AI chat is enabled in a channel.
+func isChatChannel(a *app.App, guildID, channelID snowflake.ID) bool {
+	guild, err := database.ViewGuild(a.DB, guildID)
+	if err != nil || !guild.AiChatEnabled {
+		return false
+	}
+	channel, err := database.ViewChannel(a.DB, channelID)
+	return err == nil && channel.AiChat
+}
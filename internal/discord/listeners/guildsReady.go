@@ -64,9 +64,10 @@ func OnGuildsReady(a *app.App, event *events.GuildsReady, registerCommands bool)
 		}
 	}
 
-	// set Deleted to true for channels in DB that are not in the cache
+	// set Deleted to true for channels in DB that are not in the cache. The cache only holds active
+	// threads, archived ones are checked by the backup when it lists them.
 	if err := database.UpdateChannels(a.DB, func(id snowflake.ID, c *database.Channel) error {
-		if !slices.Contains(foundChannels, id) {
+		if !slices.Contains(foundChannels, id) && !database.IsThread(c.Type) {
 			c.Deleted = true
 		}
 		return nil
@@ -165,7 +166,8 @@ func OnGuildsReady(a *app.App, event *events.GuildsReady, registerCommands bool)
 		}
 	}
 
-	// TODO: start backup service when i build that
+	// start backup service, no-op if already running
+	a.Backup.Start()
 
 }
 
@@ -3,8 +3,11 @@ package listeners
 import (
 	"fmt"
 	"sprout/internal/app"
+	"sprout/internal/discord/response"
 
+	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
 )
 
 func OnReady(a *app.App, event *events.Ready) {
@@ -12,6 +15,10 @@ func OnReady(a *app.App, event *events.Ready) {
 	defer a.DiscordWG.Done()
 
 	a.Chat.SetClient(a.Client)
+	a.Backup.SetClient(a.Client)
+	a.Backup.SetNotifier(func(guildID snowflake.ID, messageCreate discord.MessageCreate) (*discord.Message, error) {
+		return response.MessageBotChannel(a, guildID, messageCreate)
+	})
 
 	fmt.Println("Halsey is now running. Press Ctrl+C to exit.")
 	a.Log.Info("Discord client is ready.")
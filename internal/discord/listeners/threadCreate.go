@@ -0,0 +1,25 @@
+package listeners
+
+import (
+	"sprout/internal/app"
+	"sprout/internal/platform/database"
+
+	"github.com/disgoorg/disgo/events"
+)
+
+func OnThreadCreate(a *app.App, event *events.ThreadCreate) {
+	a.DiscordWG.Add(1) // track for graceful shutdown
+	defer a.DiscordWG.Done()
+
+	// upsert thread, archived threads are discovered by the backup
+	if _, err := database.UpsertChannel(a.DB, event.ThreadID, func(c *database.Channel) error {
+		c.GuildID = event.GuildID
+		c.Name = event.Thread.Name()
+		c.Type = event.Thread.Type()
+		c.ParentID = event.ParentID
+		c.Deleted = false
+		return nil
+	}); err != nil {
+		a.Log.Errorf("failed to upsert thread %s: %s", event.ThreadID, err)
+	}
+}
@@ -0,0 +1,21 @@
+package listeners
+
+import (
+	"sprout/internal/app"
+	"sprout/internal/platform/database"
+
+	"github.com/disgoorg/disgo/events"
+)
+
+func OnThreadDelete(a *app.App, event *events.ThreadDelete) {
+	a.DiscordWG.Add(1) // track for graceful shutdown
+	defer a.DiscordWG.Done()
+
+	// set deleted to true for thread in DB
+	if _, err := database.UpsertChannel(a.DB, event.ThreadID, func(c *database.Channel) error {
+		c.Deleted = true
+		return nil
+	}); err != nil {
+		a.Log.Errorf("failed to update thread %s in database: %s", event.ThreadID, err)
+	}
+}
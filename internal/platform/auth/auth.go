@@ -248,7 +248,7 @@ func (m *Manager) Cookie(db *wrap.DB) func(http.Handler) http.Handler {
 			}
 
 			// rate limit everything that's not a valid session
-			if (session == (database.Session{})) || time.Now().After(session.Expiration) || (err != nil) {
+			if (session.UserID == 0) || time.Now().After(session.Expiration) || (err != nil) {
 				ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 				defer cancel()
 				if err := m.limit.Wait(ctx); err != nil { // could be err, timeout, or burst exceeded
@@ -261,7 +261,7 @@ func (m *Manager) Cookie(db *wrap.DB) func(http.Handler) http.Handler {
 				xhttp.Error(r.Context(), w, err)
 				return
 			}
-			if session == (database.Session{}) { // missing session
+			if session.UserID == 0 { // missing session
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
@@ -0,0 +1,512 @@
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Data-Corruption/lmdb-go/lmdb"
+	"github.com/Data-Corruption/lmdb-go/wrap"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// TxnPutArchivedMessage gzips the message and stores it in the archive DBI under its ID.
+func TxnPutArchivedMessage(txn *lmdb.Txn, dbi lmdb.DBI, msg *ArchivedMessage) error {
+	if msg.ID == 0 {
+		return fmt.Errorf("invalid message ID")
+	}
+	data, err := gzipJSON(msg)
+	if err != nil {
+		return err
+	}
+	return txn.Put(dbi, []byte(msg.ID.String()), data, 0)
+}
+
+// TxnGetArchivedMessage retrieves and decompresses a message from the archive DBI.
+// lmdb.IsNotFound(err) will be true if the message is not archived.
+func TxnGetArchivedMessage(txn *lmdb.Txn, dbi lmdb.DBI, messageID snowflake.ID) (*ArchivedMessage, error) {
+	buf, err := txn.Get(dbi, []byte(messageID.String()))
+	if err != nil {
+		return nil, err
+	}
+	var msg ArchivedMessage
+	if err := gunzipJSON(buf, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// ViewArchivedMessage retrieves a copy of the given archived message.
+// lmdb.IsNotFound(err) will be true if the message is not archived.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func ViewArchivedMessage(db *wrap.DB, messageID snowflake.ID) (*ArchivedMessage, error) {
+	if messageID == 0 {
+		return nil, fmt.Errorf("invalid message ID")
+	}
+	var msg *ArchivedMessage
+	err := db.View(func(txn *lmdb.Txn) error {
+		dbi, ok := db.GetDBis()[ArchiveDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", ArchiveDBIName)
+		}
+		var err error
+		msg, err = TxnGetArchivedMessage(txn, dbi, messageID)
+		return err
+	})
+	return msg, err
+}
+
+// ViewArchivedMessages calls fn with a copy of every archived message, in key order.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func ViewArchivedMessages(db *wrap.DB, fn func(msg *ArchivedMessage) error) error {
+	return db.View(func(txn *lmdb.Txn) error {
+		dbi, ok := db.GetDBis()[ArchiveDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", ArchiveDBIName)
+		}
+
+		cursor, err := txn.OpenCursor(dbi)
+		if err != nil {
+			return fmt.Errorf("failed to create cursor: %w", err)
+		}
+		defer cursor.Close()
+
+		for {
+			_, v, err := cursor.Get(nil, nil, lmdb.Next)
+			if lmdb.IsNotFound(err) {
+				break // no more entries
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get next entry: %w", err)
+			}
+			var msg ArchivedMessage
+			if err := gunzipJSON(v, &msg); err != nil {
+				return fmt.Errorf("failed to decode entry: %w", err)
+			}
+			if err := fn(&msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ViewArchivedMessageSizes calls fn with a copy of every archived message and its stored
+// (compressed) size in bytes, in key order.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func ViewArchivedMessageSizes(db *wrap.DB, fn func(msg *ArchivedMessage, size int) error) error {
+	return db.View(func(txn *lmdb.Txn) error {
+		dbi, ok := db.GetDBis()[ArchiveDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", ArchiveDBIName)
+		}
+
+		cursor, err := txn.OpenCursor(dbi)
+		if err != nil {
+			return fmt.Errorf("failed to create cursor: %w", err)
+		}
+		defer cursor.Close()
+
+		for {
+			k, v, err := cursor.Get(nil, nil, lmdb.Next)
+			if lmdb.IsNotFound(err) {
+				break // no more entries
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get next entry: %w", err)
+			}
+			var msg ArchivedMessage
+			if err := gunzipJSON(v, &msg); err != nil {
+				return fmt.Errorf("failed to decode entry: %w", err)
+			}
+			if err := fn(&msg, len(k)+len(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteArchivedMessages removes the given messages from the archive and the search index.
+// Returns the number of removed messages.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func DeleteArchivedMessages(db *wrap.DB, messageIDs []snowflake.ID) (int, error) {
+	count := 0
+	err := db.Update(func(txn *lmdb.Txn) error {
+		dbi, ok := db.GetDBis()[ArchiveDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", ArchiveDBIName)
+		}
+		searchDBI, ok := db.GetDBis()[SearchDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", SearchDBIName)
+		}
+		revisedDBI, ok := db.GetDBis()[RevisedDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", RevisedDBIName)
+		}
+		for _, id := range messageIDs {
+			msg, err := TxnGetArchivedMessage(txn, dbi, id)
+			if err != nil {
+				if lmdb.IsNotFound(err) {
+					continue
+				}
+				return err
+			}
+			if err := txnUnindexMessage(txn, searchDBI, msg); err != nil {
+				return err
+			}
+			if err := txn.Del(revisedDBI, revisedKey(id), nil); err != nil && !lmdb.IsNotFound(err) {
+				return fmt.Errorf("failed to unindex revised message: %w", err)
+			}
+			if err := txn.Del(dbi, []byte(id.String()), nil); err != nil {
+				return fmt.Errorf("failed to delete message: %w", err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// ArchiveMessages stores the given messages in the archive DBI and updates the backup cursors of
+// the channel in the same transaction, so the cursors never point past what is actually stored.
+// Messages from users with BackupOptOut set are stored redacted. When a message is already archived
+// its revisions and deletion mark are kept, and the stored version becomes a revision if it differs.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func ArchiveMessages(db *wrap.DB, channelID snowflake.ID, msgs []ArchivedMessage, updateFunc func(backup *ChannelBackup) error) error {
+	if channelID == 0 {
+		return fmt.Errorf("invalid channel ID")
+	}
+	return db.Update(func(txn *lmdb.Txn) error {
+		archiveDBI, ok := db.GetDBis()[ArchiveDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", ArchiveDBIName)
+		}
+		channelsDBI, ok := db.GetDBis()[ChannelsDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", ChannelsDBIName)
+		}
+
+		usersDBI, ok := db.GetDBis()[UsersDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", UsersDBIName)
+		}
+		searchDBI, ok := db.GetDBis()[SearchDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", SearchDBIName)
+		}
+		revisedDBI, ok := db.GetDBis()[RevisedDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", RevisedDBIName)
+		}
+
+		// checked inside the transaction so a concurrent opt-out + purge can't be missed
+		optedOut := make(map[snowflake.ID]bool)
+		for i := range msgs {
+			authorID := msgs[i].AuthorID
+			if _, ok := optedOut[authorID]; !ok {
+				var user User
+				err := TxnGetAndUnmarshal(txn, usersDBI, []byte(authorID.String()), &user)
+				if err != nil && !lmdb.IsNotFound(err) { // bots and past members aren't in the users DBI
+					return fmt.Errorf("failed to get user %s: %w", authorID, err)
+				}
+				optedOut[authorID] = err == nil && user.BackupOptOut
+			}
+
+			// carry over the history of a previously archived version and drop its terms
+			old, err := TxnGetArchivedMessage(txn, archiveDBI, msgs[i].ID)
+			if err != nil && !lmdb.IsNotFound(err) {
+				return fmt.Errorf("failed to get message %s: %w", msgs[i].ID, err)
+			}
+			if old != nil {
+				msgs[i].Revisions = old.Revisions
+				if !old.Redacted && isRevised(old, &msgs[i]) {
+					msgs[i].Revisions = append(msgs[i].Revisions, ArchivedRevision{Content: old.Content, Attachments: old.Attachments, Edited: old.Edited})
+				}
+				if msgs[i].Deleted == nil {
+					msgs[i].Deleted = old.Deleted
+				}
+				if err := txnUnindexMessage(txn, searchDBI, old); err != nil {
+					return err
+				}
+			}
+
+			if optedOut[authorID] {
+				redact(&msgs[i])
+			}
+
+			if err := TxnPutArchivedMessage(txn, archiveDBI, &msgs[i]); err != nil {
+				return fmt.Errorf("failed to archive message %s: %w", msgs[i].ID, err)
+			}
+			if err := txnIndexMessage(txn, searchDBI, &msgs[i]); err != nil {
+				return err
+			}
+			if err := txnIndexRevised(txn, revisedDBI, &msgs[i]); err != nil {
+				return err
+			}
+		}
+
+		key := []byte(channelID.String())
+		var channel Channel
+		if err := TxnGetAndUnmarshal(txn, channelsDBI, key, &channel); err != nil {
+			return fmt.Errorf("failed to get channel: %w", err)
+		}
+		if err := updateFunc(&channel.Backup); err != nil {
+			return err
+		}
+		return TxnMarshalAndPut(txn, channelsDBI, key, &channel)
+	})
+}
+
+// ImportMessages archives messages from an external export along with a cursor update. Messages
+// that are already archived are skipped, the live backup is more accurate than any export.
+// Returns the number of imported messages.
+//
+// WARNING: Starts transactions. Avoid nesting transactions (deadlock risk).
+func ImportMessages(db *wrap.DB, channelID snowflake.ID, msgs []ArchivedMessage, updateFunc func(backup *ChannelBackup) error) (int, error) {
+	fresh := make([]ArchivedMessage, 0, len(msgs))
+	if err := db.View(func(txn *lmdb.Txn) error {
+		dbi, ok := db.GetDBis()[ArchiveDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", ArchiveDBIName)
+		}
+		for _, msg := range msgs {
+			_, err := txn.Get(dbi, []byte(msg.ID.String()))
+			if lmdb.IsNotFound(err) {
+				fresh = append(fresh, msg)
+			} else if err != nil {
+				return fmt.Errorf("failed to get message %s: %w", msg.ID, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if err := ArchiveMessages(db, channelID, fresh, updateFunc); err != nil {
+		return 0, err
+	}
+	return len(fresh), nil
+}
+
+// RedactArchivedMessages redacts every archived message authored by the given user.
+// Returns the number of messages that were redacted.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func RedactArchivedMessages(db *wrap.DB, userID snowflake.ID) (int, error) {
+	if userID == 0 {
+		return 0, fmt.Errorf("invalid user ID")
+	}
+	count := 0
+	err := db.Update(func(txn *lmdb.Txn) error {
+		dbi, ok := db.GetDBis()[ArchiveDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", ArchiveDBIName)
+		}
+		searchDBI, ok := db.GetDBis()[SearchDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", SearchDBIName)
+		}
+		revisedDBI, ok := db.GetDBis()[RevisedDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", RevisedDBIName)
+		}
+
+		cursor, err := txn.OpenCursor(dbi)
+		if err != nil {
+			return fmt.Errorf("failed to create cursor: %w", err)
+		}
+		defer cursor.Close()
+
+		for {
+			k, v, err := cursor.Get(nil, nil, lmdb.Next)
+			if lmdb.IsNotFound(err) {
+				break // no more entries
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get next entry: %w", err)
+			}
+			var msg ArchivedMessage
+			if err := gunzipJSON(v, &msg); err != nil {
+				return fmt.Errorf("failed to decode entry: %w", err)
+			}
+			if msg.AuthorID != userID || msg.Redacted {
+				continue
+			}
+			if err := txnUnindexMessage(txn, searchDBI, &msg); err != nil {
+				return err
+			}
+			redact(&msg)
+			if err := txnIndexRevised(txn, revisedDBI, &msg); err != nil {
+				return err
+			}
+			data, err := gzipJSON(&msg)
+			if err != nil {
+				return err
+			}
+			if err := cursor.Put(k, data, lmdb.Current); err != nil {
+				return fmt.Errorf("failed to update entry: %w", err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// MarkArchivedMessageDeleted sets the deletion time of an archived message, the content is kept.
+// Returns false if the message isn't archived.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func MarkArchivedMessageDeleted(db *wrap.DB, messageID snowflake.ID, deleted time.Time) (bool, error) {
+	found := false
+	err := db.Update(func(txn *lmdb.Txn) error {
+		dbi, ok := db.GetDBis()[ArchiveDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", ArchiveDBIName)
+		}
+		revisedDBI, ok := db.GetDBis()[RevisedDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", RevisedDBIName)
+		}
+		msg, err := TxnGetArchivedMessage(txn, dbi, messageID)
+		if err != nil {
+			if lmdb.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		found = true
+		if msg.Deleted != nil {
+			return nil // bulk deletes can repeat
+		}
+		msg.Deleted = &deleted
+		if err := txnIndexRevised(txn, revisedDBI, msg); err != nil {
+			return err
+		}
+		return TxnPutArchivedMessage(txn, dbi, msg)
+	})
+	return found, err
+}
+
+// ViewRevisedMessages returns up to limit archived messages that were edited or deleted, newest first.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func ViewRevisedMessages(db *wrap.DB, limit int) ([]ArchivedMessage, error) {
+	var msgs []ArchivedMessage
+	err := db.View(func(txn *lmdb.Txn) error {
+		dbi, ok := db.GetDBis()[ArchiveDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", ArchiveDBIName)
+		}
+		revisedDBI, ok := db.GetDBis()[RevisedDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", RevisedDBIName)
+		}
+
+		cursor, err := txn.OpenCursor(revisedDBI)
+		if err != nil {
+			return fmt.Errorf("failed to create cursor: %w", err)
+		}
+		defer cursor.Close()
+
+		// keys are big endian IDs, walking backwards is newest first
+		for len(msgs) < limit {
+			k, _, err := cursor.Get(nil, nil, lmdb.Prev)
+			if lmdb.IsNotFound(err) {
+				break // no more entries
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get previous entry: %w", err)
+			}
+			msg, err := TxnGetArchivedMessage(txn, dbi, snowflake.ID(binary.BigEndian.Uint64(k)))
+			if lmdb.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			msgs = append(msgs, *msg)
+		}
+		return nil
+	})
+	return msgs, err
+}
+
+// revisedKey is the key of a message in the revised DBI.
+func revisedKey(messageID snowflake.ID) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(messageID))
+}
+
+// txnIndexRevised adds a message to the revised DBI if it was edited or deleted, and removes it otherwise.
+func txnIndexRevised(txn *lmdb.Txn, dbi lmdb.DBI, msg *ArchivedMessage) error {
+	if len(msg.Revisions) == 0 && msg.Deleted == nil {
+		if err := txn.Del(dbi, revisedKey(msg.ID), nil); err != nil && !lmdb.IsNotFound(err) {
+			return fmt.Errorf("failed to unindex revised message: %w", err)
+		}
+		return nil
+	}
+	if err := txn.Put(dbi, revisedKey(msg.ID), []byte{}, 0); err != nil {
+		return fmt.Errorf("failed to index revised message: %w", err)
+	}
+	return nil
+}
+
+// isRevised reports whether msg differs from the stored version in a way worth keeping a revision for.
+// Embed unfurls also trigger updates, those don't change the content or attachments.
+func isRevised(stored, msg *ArchivedMessage) bool {
+	if stored.Content != msg.Content || len(stored.Attachments) != len(msg.Attachments) {
+		return true
+	}
+	for i := range stored.Attachments {
+		// CDN urls are re-signed on every fetch, compare what the author uploaded
+		if stored.Attachments[i].Filename != msg.Attachments[i].Filename || stored.Attachments[i].Size != msg.Attachments[i].Size {
+			return true
+		}
+	}
+	return false
+}
+
+// redact strips everything the author wrote, leaving a tombstone that keeps the thread structure intact.
+func redact(msg *ArchivedMessage) {
+	msg.Content = ""
+	msg.Attachments = nil
+	msg.Edited = nil
+	msg.Revisions = nil
+	msg.Redacted = true
+}
+
+func gzipJSON(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(value); err != nil {
+		zw.Close()
+		return nil, fmt.Errorf("failed to encode: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipJSON(data []byte, value any) error {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decompress: %w", err)
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return fmt.Errorf("failed to decompress: %w", err)
+	}
+	return json.Unmarshal(raw, value)
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func TestArchiveOptOut(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	channelID := snowflake.New(now.Add(-time.Hour))
+	alice, bob := snowflake.New(now.Add(-2*time.Hour)), snowflake.New(now.Add(-3*time.Hour))
+	if _, err := UpsertChannel(db, channelID, func(c *Channel) error { return nil }); err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+	for _, id := range []snowflake.ID{alice, bob} {
+		if _, err := UpsertUser(db, id, func(u *User) error {
+			u.BackupOptOut = id == bob
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	msg := func(id int, author snowflake.ID) ArchivedMessage {
+		return ArchivedMessage{
+			ID:          snowflake.New(now.Add(time.Duration(id) * time.Second)),
+			ChannelID:   channelID,
+			AuthorID:    author,
+			Content:     "secret",
+			Attachments: []ArchivedAttachment{{Filename: "a.png"}},
+		}
+	}
+	msgs := []ArchivedMessage{msg(1, alice), msg(2, bob), msg(3, alice)}
+	if err := ArchiveMessages(db, channelID, msgs, func(b *ChannelBackup) error {
+		b.Head = msgs[2].ID
+		return nil
+	}); err != nil {
+		t.Fatalf("ArchiveMessages() failed: %v", err)
+	}
+
+	check := func(t *testing.T, id snowflake.ID, redacted bool) {
+		t.Helper()
+		got, err := ViewArchivedMessage(db, id)
+		if err != nil {
+			t.Fatalf("Failed to view message: %v", err)
+		}
+		if got.Redacted != redacted || (got.Content == "") != redacted || (len(got.Attachments) == 0) != redacted {
+			t.Errorf("Message %s: expected redacted=%v, got %+v", id, redacted, got)
+		}
+	}
+
+	t.Run("On Archive", func(t *testing.T) {
+		check(t, msgs[0].ID, false)
+		check(t, msgs[1].ID, true)
+		ch, err := ViewChannel(db, channelID)
+		if err != nil {
+			t.Fatalf("Failed to view channel: %v", err)
+		}
+		if ch.Backup.Head != msgs[2].ID {
+			t.Errorf("Expected Head %s, got %s", msgs[2].ID, ch.Backup.Head)
+		}
+	})
+
+	t.Run("Retroactive", func(t *testing.T) {
+		n, err := RedactArchivedMessages(db, alice)
+		if err != nil {
+			t.Fatalf("RedactArchivedMessages() failed: %v", err)
+		}
+		if n != 2 {
+			t.Errorf("Expected 2 redacted messages, got %d", n)
+		}
+		for _, m := range msgs {
+			check(t, m.ID, true)
+		}
+		// already redacted messages are skipped
+		if n, _ := RedactArchivedMessages(db, alice); n != 0 {
+			t.Errorf("Expected 0 redacted messages on second run, got %d", n)
+		}
+	})
+}
+
+func TestArchiveRevisions(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now().Truncate(time.Second)
+	channelID := snowflake.New(now.Add(-time.Hour))
+	alice := snowflake.New(now.Add(-2 * time.Hour))
+	if _, err := UpsertChannel(db, channelID, func(c *Channel) error { return nil }); err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+	archive := func(msg ArchivedMessage) {
+		t.Helper()
+		if err := ArchiveMessages(db, channelID, []ArchivedMessage{msg}, func(b *ChannelBackup) error { return nil }); err != nil {
+			t.Fatalf("ArchiveMessages() failed: %v", err)
+		}
+	}
+	view := func(id snowflake.ID) *ArchivedMessage {
+		t.Helper()
+		msg, err := ViewArchivedMessage(db, id)
+		if err != nil {
+			t.Fatalf("Failed to view message: %v", err)
+		}
+		return msg
+	}
+
+	original := ArchivedMessage{ID: snowflake.New(now), ChannelID: channelID, AuthorID: alice, Content: "first", Created: now}
+	archive(original)
+	archive(original) // refetched unchanged, e.g. an embed unfurl
+	if got := view(original.ID); len(got.Revisions) != 0 {
+		t.Fatalf("Expected no revisions for an unchanged message, got %+v", got.Revisions)
+	}
+
+	edited := original
+	edited.Content = "second"
+	editedAt := now.Add(time.Minute)
+	edited.Edited = &editedAt
+	archive(edited)
+	got := view(original.ID)
+	if got.Content != "second" || len(got.Revisions) != 1 || got.Revisions[0].Content != "first" || got.Revisions[0].Edited != nil {
+		t.Fatalf("Expected the original as a revision, got %+v", got)
+	}
+
+	deletedAt := now.Add(2 * time.Minute)
+	if found, err := MarkArchivedMessageDeleted(db, original.ID, deletedAt); err != nil || !found {
+		t.Fatalf("MarkArchivedMessageDeleted() failed: found=%v err=%v", found, err)
+	}
+	if found, _ := MarkArchivedMessageDeleted(db, snowflake.New(now.Add(time.Hour)), deletedAt); found {
+		t.Errorf("Expected unarchived message to not be found")
+	}
+	archive(edited) // a later pass must not drop the history
+	got = view(original.ID)
+	if got.Deleted == nil || !got.Deleted.Equal(deletedAt) || len(got.Revisions) != 1 {
+		t.Fatalf("Expected history to survive re-archiving, got %+v", got)
+	}
+
+	revised, err := ViewRevisedMessages(db, 10)
+	if err != nil {
+		t.Fatalf("ViewRevisedMessages() failed: %v", err)
+	}
+	if len(revised) != 1 || revised[0].ID != original.ID {
+		t.Errorf("Expected the edited message, got %+v", revised)
+	}
+
+	if _, err := RedactArchivedMessages(db, alice); err != nil {
+		t.Fatalf("RedactArchivedMessages() failed: %v", err)
+	}
+	if got := view(original.ID); len(got.Revisions) != 0 {
+		t.Errorf("Expected revisions to be redacted, got %+v", got.Revisions)
+	}
+}
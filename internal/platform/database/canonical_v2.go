@@ -0,0 +1,149 @@
+package database
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// canonicalV2 is the canonical form of a link as the v2 migration keys assets by it. It is a
+// frozen copy of extractors.Canonical at the time, later changes to the extractors must not
+// change what the migration did. Invalid links are returned as is.
+func canonicalV2(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "https" && u.Port() == "443") || (u.Scheme == "http" && u.Port() == "80") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment, u.RawFragment = "", ""
+	if u.RawQuery != "" {
+		q := u.Query()
+		removed := false
+		for key := range q {
+			if strings.HasPrefix(key, "utm_") || slices.Contains(v2TrackingParams, key) {
+				q.Del(key)
+				removed = true
+			}
+		}
+		// untouched queries keep their encoding, some sites sign them
+		if removed {
+			u.RawQuery = q.Encode()
+		}
+	}
+
+	s := u.String()
+	switch {
+	case hasAnyPrefixV2(s, v2YouTubePrefixes):
+		canonicalV2YouTube(u)
+	case hasAnyPrefixV2(s, v2RedGifsPrefixes):
+		setHostV2(u, "www.redgifs.com")
+		u.Path = strings.ToLower(u.Path)
+	case hasAnyPrefixV2(s, v2RedditPrefixes):
+		canonicalV2Reddit(u)
+	case hasAnyPrefixV2(s, v2ImgurPrefixes):
+		canonicalV2Imgur(u)
+	case hasAnyPrefixV2(s, v2BlueskyPrefixes) && strings.Contains(s, "/post/"):
+		setHostV2(u, "bsky.app")
+		u.Path = strings.TrimSuffix(u.Path, "/")
+	case hasAnyPrefixV2(s, v2XitterPrefixes) && strings.Contains(s, "/status/"):
+		canonicalV2Xitter(u)
+	}
+	return u.String()
+}
+
+var (
+	v2TrackingParams  = []string{"fbclid", "gclid", "dclid", "msclkid", "igshid", "mc_cid", "mc_eid", "ref_src", "ref_url"}
+	v2YouTubePrefixes = []string{"https://www.youtube.com/", "https://youtube.com/", "https://youtu.be/"}
+	v2RedGifsPrefixes = []string{"https://redgifs.com/watch/", "https://www.redgifs.com/watch/"}
+	v2RedditPrefixes  = []string{
+		"https://www.reddit.com/", "https://reddit.com/", "https://v.redd.it/", "https://i.redd.it/", "https://www.redd.it/",
+		"https://np.reddit.com/", "https://amp.reddit.com/", "https://m.reddit.com/", "https://old.reddit.com/", "https://new.reddit.com/"}
+	v2ImgurPrefixes   = []string{"https://imgur.com/", "https://www.imgur.com/", "https://m.imgur.com/", "https://i.imgur.com/"}
+	v2BlueskyPrefixes = []string{"https://bsky.app/profile/", "https://www.bsky.app/profile/"}
+	v2XitterPrefixes  = []string{
+		"https://x.com/", "https://www.x.com/", "https://mobile.x.com/", "https://twitter.com/", "https://www.twitter.com/",
+		"https://mobile.twitter.com/", "https://fxtwitter.com/", "https://fixupx.com/", "https://vxtwitter.com/", "https://fixvx.com/"}
+)
+
+// canonicalV2YouTube rewrites video links to youtube.com/watch?v=<id>, other pages only lose
+// the share params.
+func canonicalV2YouTube(u *url.URL) {
+	var id string
+	switch {
+	case u.Host == "youtu.be":
+		id = strings.Trim(u.Path, "/")
+	case u.Path == "/watch":
+		id = u.Query().Get("v")
+	}
+	u.Host = "www.youtube.com"
+	u.RawPath = ""
+	if id != "" {
+		u.Path, u.RawQuery = "/watch", url.Values{"v": {id}}.Encode()
+		return
+	}
+	q := u.Query()
+	q.Del("si")
+	q.Del("feature")
+	u.RawQuery = q.Encode()
+}
+
+// canonicalV2Reddit unifies the reddit hosts and drops the title slug and comment of post links.
+func canonicalV2Reddit(u *url.URL) {
+	switch u.Host {
+	case "i.redd.it", "v.redd.it", "www.redd.it":
+		u.RawQuery = ""
+		return
+	}
+	setHostV2(u, "www.reddit.com")
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if i := slices.Index(segs, "comments"); i >= 0 && i+1 < len(segs) {
+		u.Path = "/" + strings.ToLower(strings.Join(segs[:i+2], "/")) + "/"
+		u.RawPath = ""
+	}
+}
+
+// canonicalV2Imgur drops title slugs and maps tag links to the gallery post they show.
+func canonicalV2Imgur(u *url.URL) {
+	if u.Host == "i.imgur.com" {
+		u.RawQuery = ""
+		return
+	}
+	setHostV2(u, "imgur.com")
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	id := func(seg string) string { return seg[strings.LastIndex(seg, "-")+1:] }
+	switch {
+	case len(segs) == 2 && (segs[0] == "a" || segs[0] == "gallery"):
+		u.Path = "/" + segs[0] + "/" + id(segs[1])
+	case len(segs) == 3 && segs[0] == "t":
+		u.Path = "/gallery/" + id(segs[2])
+	}
+	u.RawPath = ""
+}
+
+// canonicalV2Xitter maps the twitter hosts and embed fixers to x.com/<user>/status/<id>.
+func canonicalV2Xitter(u *url.URL) {
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	setHostV2(u, "x.com")
+	if len(segs) >= 3 && segs[1] == "status" {
+		u.Path = "/" + strings.ToLower(segs[0]) + "/status/" + segs[2]
+		u.RawPath = ""
+	}
+}
+
+func setHostV2(u *url.URL, host string) {
+	u.Host = host
+	u.RawQuery, u.ForceQuery = "", false
+}
+
+func hasAnyPrefixV2(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
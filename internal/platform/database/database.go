@@ -26,6 +26,12 @@ Guilds
 	<id> -> marshaled Guild struct
 Sessions
 	<token> -> marshaled Session struct
+Search
+	<term>\x00<message id, 8 bytes big endian> -> <guild id><channel id><author id>, 8 bytes big endian each
+Revised
+	<message id, 8 bytes big endian> -> empty, archived messages that were edited or deleted
+Replays
+	<source channel id>:<destination channel id> -> marshaled Replay struct
 
 */
 
@@ -42,12 +48,15 @@ const (
 	ChannelsDBIName  = "channels"
 	GuildsDBIName    = "guilds"
 	SessionsDBIName  = "sessions"
+	SearchDBIName    = "search"
+	RevisedDBIName   = "revised"
+	ReplaysDBIName   = "replays"
 	// Add more DBI names as needed, e.g., UserDBIName, SessionDBIName, etc. Also update the slice below to include them.
 	// My lmdb wrapper hard codes the max number of named dbis to 128.
 )
 
 // Slice for easy initialization. As stated above, if you add more DBIs you'll need to update this slice as well.
-var DBINameList = []string{ConfigDBIName, ArchiveDBIName, AssetsDBIName, FavoritesDBIName, UsersDBIName, ChannelsDBIName, GuildsDBIName, SessionsDBIName}
+var DBINameList = []string{ConfigDBIName, ArchiveDBIName, AssetsDBIName, FavoritesDBIName, UsersDBIName, ChannelsDBIName, GuildsDBIName, SessionsDBIName, SearchDBIName, RevisedDBIName, ReplaysDBIName}
 
 func New(directory string, logger *xlog.Logger) (*wrap.DB, error) {
 	// Initialize LMDB with the specified DBIs
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sprout/pkg/xcrypto"
+	"strings"
+
+	"github.com/Data-Corruption/lmdb-go/wrap"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const GalleryExt = ".tar"
+
+// IsGallery reports whether the asset path is a gallery (a tar of its items).
+func IsGallery(path string) bool {
+	return filepath.Ext(path) == GalleryExt
+}
+
+// StoreGallery packs downloaded temp files into a tar in the assets directory and records it for the
+// given url and guild (0 if unknown), like StoreAsset does for single files. The tar is named after
+// the hash of the item hashes, so the same items in the same order dedupe. Items keep their order and
+// extension. hashes are the hex sha256 of the items if already known, nil or "" to compute them.
+// The temp files are removed on success. Returns the asset name (<hash of hashes>.tar).
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func StoreGallery(db *wrap.DB, storageDir string, guildID snowflake.ID, url string, paths, hashes []string) (string, error) {
+	if len(paths) == 0 {
+		return "", errors.New("empty gallery")
+	}
+
+	// hash of hashes
+	names := make([]string, len(paths))
+	hashOfHashes := sha256.New()
+	for i, path := range paths {
+		var hash string
+		if i < len(hashes) {
+			hash = hashes[i]
+		}
+		if hash == "" {
+			var err error
+			if hash, err = xcrypto.FileSHA256(path); err != nil {
+				return "", fmt.Errorf("failed to hash item %d: %w", i, err)
+			}
+		}
+		hashOfHashes.Write([]byte(hash))
+		names[i] = fmt.Sprintf("%03d-%s%s", i, hash, strings.ToLower(filepath.Ext(path)))
+	}
+	assetName := hex.EncodeToString(hashOfHashes.Sum(nil)) + GalleryExt
+	finalPath := ToAssetPath(filepath.Join(storageDir, "assets"), assetName)
+
+	// pack, unless the same gallery is already stored
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if _, err := os.Stat(finalPath); err != nil {
+		if err := writeGallery(finalPath, names, paths); err != nil {
+			return "", err
+		}
+	}
+	info, err := os.Stat(finalPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat: %w", err)
+	}
+	for _, path := range paths {
+		os.Remove(path)
+	}
+
+	// upsert
+	if _, err := UpsertAsset(db, url, func(asset *Asset) error {
+		asset.Path = finalPath
+		asset.Size = info.Size()
+		asset.Stored = info.ModTime()
+		if asset.GuildID == 0 {
+			asset.GuildID = guildID
+		}
+		return nil
+	}); err != nil {
+		return "", fmt.Errorf("failed to upsert asset: %w", err)
+	}
+	return assetName, nil
+}
+
+// writeGallery writes the tar next to its final path and renames it into place.
+func writeGallery(finalPath string, names, paths []string) error {
+	tmpPath := finalPath + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create gallery: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	tw := tar.NewWriter(out)
+	for i, path := range paths {
+		if err := addToTar(tw, names[i], path); err != nil {
+			out.Close()
+			return fmt.Errorf("failed to add item %d: %w", i, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to finish gallery: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to close gallery: %w", err)
+	}
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return fmt.Errorf("failed to move: %w", err)
+	}
+	return nil
+}
+
+func addToTar(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// ExtractGallery unpacks the items of a gallery asset into dir. Returns their paths in gallery order.
+func ExtractGallery(galleryPath, dir string) ([]string, error) {
+	f, err := os.Open(galleryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var paths []string
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gallery: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// items are written flat, never trust a path from the archive
+		path := filepath.Join(dir, filepath.Base(hdr.Name))
+		out, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create item: %w", err)
+		}
+		_, err = io.Copy(out, tr)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract item: %w", err)
+		}
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("empty gallery")
+	}
+	return paths, nil
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func TestGallery(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	items := []struct{ name, content string }{
+		{"b.jpg", "second in name, first in the gallery"},
+		{"a.PNG", "first in name, second in the gallery"},
+		{"c.gif", "last"},
+	}
+	download := func() []string {
+		var paths []string
+		for _, it := range items {
+			path := filepath.Join(tmpDir, it.name)
+			if err := os.WriteFile(path, []byte(it.content), 0644); err != nil {
+				t.Fatalf("Failed to write item: %v", err)
+			}
+			paths = append(paths, path)
+		}
+		return paths
+	}
+
+	const url = "https://www.reddit.com/r/test/comments/abc/gallery/"
+	paths := download()
+	name, err := StoreGallery(db, tmpDir, 1, url, paths, nil)
+	if err != nil {
+		t.Fatalf("StoreGallery() failed: %v", err)
+	}
+	if !IsGallery(name) {
+		t.Errorf("Expected a gallery asset name, got %s", name)
+	}
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected the temp files to be removed, got %v", err)
+	}
+	asset, err := ViewAsset(db, url)
+	if err != nil {
+		t.Fatalf("ViewAsset() failed: %v", err)
+	}
+	if filepath.Base(asset.Path) != name || asset.GuildID != 1 || asset.Size == 0 {
+		t.Errorf("Unexpected asset: %+v", asset)
+	}
+
+	// same items, same asset
+	again, err := StoreGallery(db, tmpDir, 2, url+"?share=1", download(), nil)
+	if err != nil || again != name {
+		t.Errorf("Expected the same gallery to dedupe, got %s %v", again, err)
+	}
+
+	outDir := filepath.Join(tmpDir, "out")
+	if err := os.Mkdir(outDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	extracted, err := ExtractGallery(asset.Path, outDir)
+	if err != nil {
+		t.Fatalf("ExtractGallery() failed: %v", err)
+	}
+	if len(extracted) != len(items) {
+		t.Fatalf("Expected %d items, got %d", len(items), len(extracted))
+	}
+	for i, path := range extracted {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read item: %v", err)
+		}
+		if string(data) != items[i].content {
+			t.Errorf("Item %d: expected %q, got %q", i, items[i].content, data)
+		}
+		if ext := strings.ToLower(filepath.Ext(items[i].name)); filepath.Ext(path) != ext {
+			t.Errorf("Item %d: expected extension %s, got %s", i, ext, path)
+		}
+	}
+
+	if _, err := StoreGallery(db, tmpDir, 1, url, nil, nil); err == nil {
+		t.Errorf("Expected an empty gallery to fail")
+	}
+}
@@ -1,13 +1,18 @@
 package database
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
+	"sprout/pkg/xcrypto"
 	"time"
 
 	"github.com/Data-Corruption/lmdb-go/lmdb"
 	"github.com/Data-Corruption/lmdb-go/wrap"
+	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/snowflake/v2"
 )
 
@@ -182,7 +187,8 @@ func UpdateConfig(db *wrap.DB, updateFunc func(cfg *Configuration) error) error
 	return err
 }
 
-// ViewAsset retrieves a copy of the given asset from the database.
+// ViewAsset retrieves a copy of the asset of the given url from the database.
+// Assets are keyed by the canonical form of their url, callers canonicalize it.
 //
 // WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
 func ViewAsset(db *wrap.DB, url string) (*Asset, error) {
@@ -196,8 +202,8 @@ func defaultAsset() Asset {
 	}
 }
 
-// UpsertAsset updates the given asset in the database using the provided
-// update function, creating the asset if it does not already exist.
+// UpsertAsset updates the asset of the given url in the database using the provided
+// update function, creating the asset if it does not already exist. Keyed like ViewAsset.
 // It returns a boolean indicating whether the asset was created.
 //
 // WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
@@ -205,6 +211,128 @@ func UpsertAsset(db *wrap.DB, url string, updateFunc func(asset *Asset) error) (
 	return Upsert(db, AssetsDBIName, []byte(url), defaultAsset, updateFunc)
 }
 
+// UpdateAsset updates the existing asset of the given url using the provided update function,
+// unlike UpsertAsset an unknown url is left alone, e.g. one evicted in the meantime. Keyed like
+// ViewAsset. Returns whether the asset exists.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func UpdateAsset(db *wrap.DB, url string, updateFunc func(asset *Asset) error) (bool, error) {
+	found := false
+	err := db.Update(func(txn *lmdb.Txn) error {
+		dbi, ok := db.GetDBis()[AssetsDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", AssetsDBIName)
+		}
+		key := []byte(url)
+		var asset Asset
+		if err := TxnGetAndUnmarshal(txn, dbi, key, &asset); err != nil {
+			if lmdb.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		found = true
+		if err := updateFunc(&asset); err != nil {
+			return fmt.Errorf("update function failed: %w", err)
+		}
+		return TxnMarshalAndPut(txn, dbi, key, asset)
+	})
+	return found, err
+}
+
+// ViewAssets calls fn with the url and a copy of every asset.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func ViewAssets(db *wrap.DB, fn func(url string, asset *Asset) error) error {
+	return ForEach(db, AssetsDBIName, func(key []byte, asset *Asset) (ForEachAction, error) {
+		return Keep, fn(string(key), asset)
+	})
+}
+
+// SetAssetsFavorite marks the existing assets of the given urls as favorited, unknown urls are
+// ignored. Returns the number of marked assets.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func SetAssetsFavorite(db *wrap.DB, urls []string) (int, error) {
+	count := 0
+	err := db.Update(func(txn *lmdb.Txn) error {
+		dbi, ok := db.GetDBis()[AssetsDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", AssetsDBIName)
+		}
+		for _, url := range urls {
+			var asset Asset
+			if err := TxnGetAndUnmarshal(txn, dbi, []byte(url), &asset); err != nil {
+				if lmdb.IsNotFound(err) {
+					continue
+				}
+				return err
+			}
+			if asset.Favorite {
+				continue
+			}
+			asset.Favorite = true
+			if err := TxnMarshalAndPut(txn, dbi, []byte(url), asset); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// DeleteAssets removes the records of the given urls if they still point at the given path, so an
+// asset that was downloaded again in the meantime is kept. Files are not touched.
+// Returns the number of removed records.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func DeleteAssets(db *wrap.DB, paths map[string]string) (int, error) {
+	count := 0
+	err := db.Update(func(txn *lmdb.Txn) error {
+		dbi, ok := db.GetDBis()[AssetsDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", AssetsDBIName)
+		}
+		for url, path := range paths {
+			var asset Asset
+			if err := TxnGetAndUnmarshal(txn, dbi, []byte(url), &asset); err != nil {
+				if lmdb.IsNotFound(err) {
+					continue
+				}
+				return err
+			}
+			if asset.Path != path {
+				continue
+			}
+			if err := txn.Del(dbi, []byte(url), nil); err != nil {
+				return fmt.Errorf("failed to delete asset: %w", err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// ViewFavorites returns the IDs of all favorited source messages.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func ViewFavorites(db *wrap.DB) (map[snowflake.ID]bool, error) {
+	favorites := make(map[snowflake.ID]bool)
+	if err := ForEach(db, FavoritesDBIName, func(key []byte, _ *snowflake.ID) (ForEachAction, error) {
+		id, err := snowflake.Parse(string(key))
+		if err != nil {
+			return Keep, fmt.Errorf("failed to parse message ID: %w", err)
+		}
+		favorites[id] = true
+		return Keep, nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to iterate favorites: %w", err)
+	}
+	return favorites, nil
+}
+
 // ViewUser retrieves a copy of the given user from the database.
 //
 // WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
@@ -215,16 +343,10 @@ func ViewUser(db *wrap.DB, userID snowflake.ID) (*User, error) {
 	return View[User](db, UsersDBIName, []byte(userID.String()))
 }
 
-// defaultUser returns a User with default settings.
+// defaultUser returns a User with default settings. Auto expand is on for every
+// extractor unless turned off, see DomainBools.Get.
 func defaultUser() User {
-	return User{
-		AutoExpand: DomainBools{
-			Reddit:        true,
-			RedGifs:       true,
-			YouTube:       true,
-			YouTubeShorts: true,
-		},
-	}
+	return User{AutoExpand: DomainBools{}}
 }
 
 // UpsertUser updates the given user in the database using the provided
@@ -372,6 +494,33 @@ func UpsertGuild(db *wrap.DB, guildID snowflake.ID, updateFunc func(guild *Guild
 	return Upsert(db, GuildsDBIName, []byte(guildID.String()), defaultGuild, updateFunc)
 }
 
+func replayKey(sourceID, destID snowflake.ID) []byte {
+	return []byte(sourceID.String() + ":" + destID.String())
+}
+
+// ViewReplay retrieves a copy of the replay state of sourceID into destID.
+// lmdb.IsNotFound(err) will be true if the replay was never started.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func ViewReplay(db *wrap.DB, sourceID, destID snowflake.ID) (*Replay, error) {
+	if sourceID == 0 || destID == 0 {
+		return nil, fmt.Errorf("invalid channel ID")
+	}
+	return View[Replay](db, ReplaysDBIName, replayKey(sourceID, destID))
+}
+
+// UpsertReplay updates the replay state of sourceID into destID using the provided
+// update function, creating it if it does not already exist.
+// It returns a boolean indicating whether the replay was created.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func UpsertReplay(db *wrap.DB, sourceID, destID snowflake.ID, updateFunc func(replay *Replay) error) (bool, error) {
+	if sourceID == 0 || destID == 0 {
+		return false, fmt.Errorf("invalid channel ID")
+	}
+	return Upsert(db, ReplaysDBIName, replayKey(sourceID, destID), func() Replay { return Replay{} }, updateFunc)
+}
+
 // DeleteGuild removes a guild and all its associated channels from the database.
 //
 // WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
@@ -521,23 +670,57 @@ func ViewAllGuildsWithChannels(db *wrap.DB) ([]GuildWithID, error) {
 
 // sortChannels sorts channels in Discord order: non-deleted first, then by category hierarchy and position.
 // Categories (type 4) come first with their children grouped underneath, sorted by position.
+// Threads follow their parent channel, oldest first, threads of unknown parents go last.
 func sortChannels(channels []ChannelWithID) {
+	// Split off threads, they have no position of their own
+	var threads []ChannelWithID
+	others := channels[:0:0]
+	for _, ch := range channels {
+		if IsThread(ch.Channel.Type) {
+			threads = append(threads, ch)
+		} else {
+			others = append(others, ch)
+		}
+	}
+
 	// Build a map of category ID -> position for ordering categories
 	categoryPos := make(map[snowflake.ID]int) // category ID -> position
-	for _, ch := range channels {
+	for _, ch := range others {
 		if ch.Channel.Type == 4 { // GuildCategory
 			categoryPos[ch.ID] = ch.Channel.Position
 		}
 	}
 
 	// Bubble sort with custom comparison
-	for i := 0; i < len(channels)-1; i++ {
-		for j := i + 1; j < len(channels); j++ {
-			if shouldSwap(channels[i], channels[j], categoryPos) {
-				channels[i], channels[j] = channels[j], channels[i]
+	for i := 0; i < len(others)-1; i++ {
+		for j := i + 1; j < len(others); j++ {
+			if shouldSwap(others[i], others[j], categoryPos) {
+				others[i], others[j] = others[j], others[i]
 			}
 		}
 	}
+
+	// Put threads back under their parents
+	slices.SortFunc(threads, func(a, b ChannelWithID) int { return cmp.Compare(a.ID, b.ID) })
+	result := channels[:0]
+	for _, ch := range others {
+		result = append(result, ch)
+		for _, th := range threads {
+			if th.Channel.ParentID == ch.ID {
+				result = append(result, th)
+			}
+		}
+	}
+	for _, th := range threads {
+		if !slices.ContainsFunc(others, func(ch ChannelWithID) bool { return ch.ID == th.Channel.ParentID }) {
+			result = append(result, th)
+		}
+	}
+}
+
+// IsThread reports whether the channel type is a thread (including forum posts).
+func IsThread(t discord.ChannelType) bool {
+	return t == discord.ChannelTypeGuildNewsThread || t == discord.ChannelTypeGuildPublicThread || t == discord.ChannelTypeGuildPrivateThread
 }
 
 // shouldSwap returns true if channel a should come after channel b.
@@ -625,3 +808,47 @@ func sortGuilds(guilds []GuildWithID) {
 func ToAssetPath(storageDir string, assetName string) string {
 	return filepath.Join(storageDir, assetName[:2], assetName[2:4], assetName)
 }
+
+// StoreAsset moves a downloaded temp file into the assets directory under its sha256 name
+// and records it for the given url and guild (0 if unknown). hash is the hex sha256 of the file
+// if it's already known, "" to compute it. Returns the asset name (<hash>.<ext>).
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func StoreAsset(db *wrap.DB, storageDir string, guildID snowflake.ID, url, path, hash string) (string, error) {
+	// hash
+	if hash == "" {
+		var err error
+		if hash, err = xcrypto.FileSHA256(path); err != nil {
+			return "", fmt.Errorf("failed to hash: %w", err)
+		}
+	}
+	assetName := fmt.Sprintf("%s%s", hash, filepath.Ext(path))
+	finalPath := ToAssetPath(filepath.Join(storageDir, "assets"), assetName)
+
+	// move
+	// create directory if it doesn't exist
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.Rename(path, finalPath); err != nil {
+		return "", fmt.Errorf("failed to move: %w", err)
+	}
+	info, err := os.Stat(finalPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat: %w", err)
+	}
+
+	// upsert
+	if _, err := UpsertAsset(db, url, func(asset *Asset) error {
+		asset.Path = finalPath
+		asset.Size = info.Size()
+		asset.Stored = time.Now()
+		if asset.GuildID == 0 {
+			asset.GuildID = guildID
+		}
+		return nil
+	}); err != nil {
+		return "", fmt.Errorf("failed to upsert asset: %w", err)
+	}
+	return assetName, nil
+}
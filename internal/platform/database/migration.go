@@ -1,7 +1,9 @@
 package database
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"sprout/pkg/migrator"
 
 	"github.com/Data-Corruption/lmdb-go/lmdb"
@@ -11,6 +13,7 @@ import (
 
 func Migrate(db *wrap.DB, logger *xlog.Logger) error {
 	m := migrator.New()
+	var orphaned []string // asset files to remove once the migrations are committed
 
 	// Add steps here. Order matters!
 
@@ -32,14 +35,28 @@ func Migrate(db *wrap.DB, logger *xlog.Logger) error {
 		return nil
 	})
 
+	m.Add("v2", "Rekey assets by canonical URL", func(txn *lmdb.Txn) error {
+		assetsDBI, ok := db.GetDBis()[AssetsDBIName]
+		if !ok {
+			return fmt.Errorf("assets DBI not found")
+		}
+		moved, dropped, err := txnRekeyAssets(txn, assetsDBI)
+		if err != nil {
+			return fmt.Errorf("failed to rekey assets: %w", err)
+		}
+		orphaned = append(orphaned, dropped...)
+		logger.Infof("Rekeyed %d assets by canonical URL", moved)
+		return nil
+	})
+
 	/* Example version bump
-	migrator.Add("v2", "Add Thing to Thing", func(txn *lmdb.Txn) error {
-		// do v2 stuff
+	migrator.Add("v3", "Add Thing to Thing", func(txn *lmdb.Txn) error {
+		// do v3 stuff
 		return nil
 	})
 	*/
 
-	return db.Update(func(txn *lmdb.Txn) error {
+	if err := db.Update(func(txn *lmdb.Txn) error {
 		// Get current version
 		cfgDBI, ok := db.GetDBis()[ConfigDBIName]
 		if !ok {
@@ -66,5 +83,98 @@ func Migrate(db *wrap.DB, logger *xlog.Logger) error {
 
 		logger.Infof("Migrated from %q to %q\n", currentVer, newVer)
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+
+	if len(orphaned) > 0 {
+		removeOrphanedFiles(db, logger, orphaned)
+	}
+	return nil
+}
+
+// removeOrphanedFiles removes asset files no asset references anymore. Files are shared by assets
+// with the same content, so each is only removed if no other asset still points at it.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func removeOrphanedFiles(db *wrap.DB, logger *xlog.Logger, paths []string) {
+	referenced := make(map[string]bool)
+	if err := ViewAssets(db, func(_ string, asset *Asset) error {
+		referenced[asset.Path] = true
+		return nil
+	}); err != nil {
+		logger.Errorf("Failed to list assets, leaving %d orphaned files: %v", len(paths), err)
+		return
+	}
+	removed := 0
+	for _, path := range paths {
+		if referenced[path] {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Warnf("Failed to remove orphaned asset file %s: %v", path, err)
+			continue
+		}
+		referenced[path] = true // in case it is listed twice
+		removed++
+	}
+	logger.Infof("Removed %d orphaned asset files", removed)
+}
+
+// txnRekeyAssets moves assets stored under a raw url to its canonical form. If the canonical url
+// already has an asset, that one is kept and inherits the favorite and NSFW flags. Returns the
+// number of moved assets and the files of dropped duplicates, to remove after the commit.
+func txnRekeyAssets(txn *lmdb.Txn, dbi lmdb.DBI) (int, []string, error) {
+	cursor, err := txn.OpenCursor(dbi)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create cursor: %w", err)
+	}
+	type move struct {
+		from, to string
+		asset    Asset
+	}
+	var moves []move
+	var dropped []string
+	for {
+		k, v, err := cursor.Get(nil, nil, lmdb.Next)
+		if lmdb.IsNotFound(err) {
+			break
+		}
+		if err != nil {
+			cursor.Close()
+			return 0, nil, fmt.Errorf("failed to get next asset: %w", err)
+		}
+		from := string(k)
+		if to := canonicalV2(from); to != from {
+			var asset Asset
+			if err := json.Unmarshal(v, &asset); err != nil {
+				cursor.Close()
+				return 0, nil, fmt.Errorf("failed to unmarshal asset %q: %w", from, err)
+			}
+			moves = append(moves, move{from, to, asset})
+		}
+	}
+	cursor.Close()
+
+	for _, m := range moves {
+		var existing Asset
+		switch err := TxnGetAndUnmarshal(txn, dbi, []byte(m.to), &existing); {
+		case err == nil:
+			existing.Favorite = existing.Favorite || m.asset.Favorite
+			existing.NSFW = existing.NSFW || m.asset.NSFW
+			if m.asset.Path != "" && m.asset.Path != existing.Path {
+				dropped = append(dropped, m.asset.Path)
+			}
+			m.asset = existing
+		case !lmdb.IsNotFound(err):
+			return 0, nil, fmt.Errorf("failed to get asset %q: %w", m.to, err)
+		}
+		if err := TxnMarshalAndPut(txn, dbi, []byte(m.to), m.asset); err != nil {
+			return 0, nil, fmt.Errorf("failed to put asset %q: %w", m.to, err)
+		}
+		if err := txn.Del(dbi, []byte(m.from), nil); err != nil {
+			return 0, nil, fmt.Errorf("failed to delete asset %q: %w", m.from, err)
+		}
+	}
+	return len(moves), dropped, nil
 }
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -75,8 +76,8 @@ func TestMigrate(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to read version: %v", err)
 		}
-		if version != "v1" {
-			t.Errorf("Expected version v1, got %s", version)
+		if version != "v2" {
+			t.Errorf("Expected version v2, got %s", version)
 		}
 	})
 
@@ -89,7 +90,7 @@ func TestMigrate(t *testing.T) {
 			t.Fatalf("Second Migrate() failed: %v", err)
 		}
 
-		// Verify Version is still v1
+		// Verify Version is still v2
 		var version string
 		err = db.View(func(txn *lmdb.Txn) error {
 			dbi, ok := db.GetDBis()[ConfigDBIName]
@@ -101,17 +102,101 @@ func TestMigrate(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to read version: %v", err)
 		}
-		if version != "v1" {
-			t.Errorf("Expected version v1, got %s", version)
+		if version != "v2" {
+			t.Errorf("Expected version v2, got %s", version)
 		}
 	})
 
-	/*
-		// Template for testing future migrations (e.g. v1 -> v2)
-		t.Run("v1 to v2", func(t *testing.T) {
-			// 1. Setup: Manually insert v1 data (or use a helper that sets up v1 state)
-			// 2. Action: Run Migrate()
-			// 3. Verify: Check that data is transformed to v2 format
-		})
-	*/
+	t.Run("v1 to v2", func(t *testing.T) {
+		db := openRawDB()
+		defer db.Close()
+
+		// Setup: v1 with assets keyed by raw urls, the youtube duplicates have files
+		assetsDir := t.TempDir()
+		ytA, ytB := filepath.Join(assetsDir, "a.mp4"), filepath.Join(assetsDir, "b.mp4")
+		for _, path := range []string{ytA, ytB} {
+			if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+				t.Fatalf("Failed to write asset file: %v", err)
+			}
+		}
+		raw := map[string]Asset{
+			"https://youtu.be/abc":                                {Path: ytA},
+			"https://www.youtube.com/watch?v=abc&t=3":             {Path: ytB, Favorite: true},
+			"https://old.reddit.com/r/pics/comments/xyz/title/":   {Path: "/assets/c.jpg", NSFW: true},
+			"https://cdn.discordapp.com/attachments/1/2/file.png": {Path: "/assets/d.png"},
+			"https://example.com/page?utm_source=share#top":       {Path: "/assets/e.jpg"},
+		}
+		if err := db.Update(func(txn *lmdb.Txn) error {
+			cfgDBI, assetsDBI := db.GetDBis()[ConfigDBIName], db.GetDBis()[AssetsDBIName]
+			if err := TxnMarshalAndPut(txn, cfgDBI, []byte(ConfigVersionKey), "v1"); err != nil {
+				return err
+			}
+			for url, asset := range raw {
+				if err := TxnMarshalAndPut(txn, assetsDBI, []byte(url), asset); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to set up v1 state: %v", err)
+		}
+
+		// Action
+		if err := Migrate(db, logger); err != nil {
+			t.Fatalf("Migrate() failed: %v", err)
+		}
+
+		// Verify: both youtube links merged into one favorited asset, the rest rekeyed
+		got := make(map[string]Asset)
+		if err := ViewAssets(db, func(url string, asset *Asset) error {
+			got[url] = *asset
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to read assets: %v", err)
+		}
+		if len(got) != 4 {
+			t.Errorf("Expected 4 assets, got %d: %v", len(got), got)
+		}
+		yt := got["https://www.youtube.com/watch?v=abc"]
+		if yt.Path == "" || !yt.Favorite {
+			t.Errorf("Expected merged favorited youtube asset, got %+v", yt)
+		}
+		for _, path := range []string{ytA, ytB} {
+			if _, err := os.Stat(path); (err == nil) != (path == yt.Path) {
+				t.Errorf("Expected only the kept file to remain, %s: %v", path, err)
+			}
+		}
+		if r := got["https://www.reddit.com/r/pics/comments/xyz/"]; r.Path != "/assets/c.jpg" || !r.NSFW {
+			t.Errorf("Expected rekeyed reddit asset, got %+v", r)
+		}
+		if d := got["https://cdn.discordapp.com/attachments/1/2/file.png"]; d.Path != "/assets/d.png" {
+			t.Errorf("Expected untouched attachment asset, got %+v", d)
+		}
+		if e := got["https://example.com/page"]; e.Path != "/assets/e.jpg" {
+			t.Errorf("Expected tracking params dropped, got %v", got)
+		}
+	})
+}
+
+func TestCanonicalV2(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://youtu.be/abc?t=3&si=share", "https://www.youtube.com/watch?v=abc"},
+		{"https://www.youtube.com/shorts/abc?si=share", "https://www.youtube.com/shorts/abc"},
+		{"https://old.reddit.com/r/Pics/comments/abc/some_title/?utm_source=share", "https://www.reddit.com/r/pics/comments/abc/"},
+		{"https://i.redd.it/abc.jpg?utm_medium=x", "https://i.redd.it/abc.jpg"},
+		{"https://www.RedGifs.com/watch/SomeGif?utm_source=x", "https://www.redgifs.com/watch/somegif"},
+		{"https://imgur.com/t/funny/Gal0001", "https://imgur.com/gallery/Gal0001"},
+		{"https://www.bsky.app/profile/alice.bsky.social/post/abc/", "https://bsky.app/profile/alice.bsky.social/post/abc"},
+		{"https://fxtwitter.com/Alice/status/1/photo/1?s=20", "https://x.com/alice/status/1"},
+		{"https://Example.com:443/a?utm_source=x&id=1#frag", "https://example.com/a?id=1"},
+		{"not a url", "not a url"},
+	}
+	for _, tt := range tests {
+		if got := canonicalV2(tt.url); got != tt.want {
+			t.Errorf("canonicalV2(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
 }
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Data-Corruption/lmdb-go/lmdb"
+	"github.com/Data-Corruption/lmdb-go/wrap"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const (
+	minTermLen = 2
+	maxTermLen = 64 // longer terms are truncated, keeps keys well under the lmdb limit
+	maxTerms   = 8  // max terms in a query
+)
+
+// Tokenize splits text into unique lowercase search terms. Anything that isn't a letter or number is a separator.
+func Tokenize(text string) []string {
+	var terms []string
+	for _, field := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if len(field) < minTermLen {
+			continue
+		}
+		if len(field) > maxTermLen {
+			field = strings.ToValidUTF8(field[:maxTermLen], "")
+		}
+		if !slices.Contains(terms, field) {
+			terms = append(terms, field)
+		}
+	}
+	return terms
+}
+
+func searchKey(term string, messageID snowflake.ID) []byte {
+	key := make([]byte, len(term)+1+8)
+	copy(key, term)
+	binary.BigEndian.PutUint64(key[len(term)+1:], uint64(messageID))
+	return key
+}
+
+// txnIndexMessage adds the terms of a message to the search index. Redacted messages are not indexed.
+func txnIndexMessage(txn *lmdb.Txn, dbi lmdb.DBI, msg *ArchivedMessage) error {
+	if msg.Redacted {
+		return nil
+	}
+	value := make([]byte, 24)
+	binary.BigEndian.PutUint64(value[0:], uint64(msg.GuildID))
+	binary.BigEndian.PutUint64(value[8:], uint64(msg.ChannelID))
+	binary.BigEndian.PutUint64(value[16:], uint64(msg.AuthorID))
+	for _, term := range Tokenize(msg.Content) {
+		if err := txn.Put(dbi, searchKey(term, msg.ID), value, 0); err != nil {
+			return fmt.Errorf("failed to index term: %w", err)
+		}
+	}
+	return nil
+}
+
+// txnUnindexMessage removes the terms of a message from the search index.
+func txnUnindexMessage(txn *lmdb.Txn, dbi lmdb.DBI, msg *ArchivedMessage) error {
+	for _, term := range Tokenize(msg.Content) {
+		if err := txn.Del(dbi, searchKey(term, msg.ID), nil); err != nil && !lmdb.IsNotFound(err) {
+			return fmt.Errorf("failed to unindex term: %w", err)
+		}
+	}
+	return nil
+}
+
+// SearchQuery describes a search over the archive. Zero values mean no filter.
+type SearchQuery struct {
+	Text      string         // all terms must match
+	GuildIDs  []snowflake.ID // required, guilds the searcher has access to
+	ChannelID snowflake.ID
+	AuthorID  snowflake.ID
+	After     time.Time
+	Before    time.Time
+	Limit     int // defaults to 25
+}
+
+// SearchResult holds the newest matching messages and the total number of matches.
+type SearchResult struct {
+	Messages []ArchivedMessage
+	Total    int
+}
+
+// Search returns archived messages matching every term of the query, newest first.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func Search(db *wrap.DB, q SearchQuery) (*SearchResult, error) {
+	terms := Tokenize(q.Text)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("query has no searchable terms")
+	}
+	if len(terms) > maxTerms {
+		return nil, fmt.Errorf("query has too many terms, max is %d", maxTerms)
+	}
+	if len(q.GuildIDs) == 0 {
+		return &SearchResult{}, nil
+	}
+	if q.Limit <= 0 {
+		q.Limit = 25
+	}
+	var minID, maxID snowflake.ID
+	if !q.After.IsZero() {
+		minID = snowflake.New(q.After)
+	}
+	if !q.Before.IsZero() {
+		maxID = snowflake.New(q.Before)
+	}
+
+	result := &SearchResult{}
+	err := db.View(func(txn *lmdb.Txn) error {
+		searchDBI, ok := db.GetDBis()[SearchDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", SearchDBIName)
+		}
+		archiveDBI, ok := db.GetDBis()[ArchiveDBIName]
+		if !ok {
+			return fmt.Errorf("DBI %q not found", ArchiveDBIName)
+		}
+
+		cursor, err := txn.OpenCursor(searchDBI)
+		if err != nil {
+			return fmt.Errorf("failed to create cursor: %w", err)
+		}
+		defer cursor.Close()
+
+		// intersect the matches of each term
+		var matches map[snowflake.ID]struct{}
+		for _, term := range terms {
+			prefix := append([]byte(term), 0)
+			found := make(map[snowflake.ID]struct{})
+			k, v, err := cursor.Get(prefix, nil, lmdb.SetRange)
+			for ; err == nil && bytes.HasPrefix(k, prefix); k, v, err = cursor.Get(nil, nil, lmdb.Next) {
+				if len(k) != len(prefix)+8 || len(v) != 24 {
+					continue
+				}
+				id := snowflake.ID(binary.BigEndian.Uint64(k[len(prefix):]))
+				if (minID != 0 && id < minID) || (maxID != 0 && id > maxID) {
+					continue
+				}
+				if !slices.Contains(q.GuildIDs, snowflake.ID(binary.BigEndian.Uint64(v[0:]))) {
+					continue
+				}
+				if q.ChannelID != 0 && snowflake.ID(binary.BigEndian.Uint64(v[8:])) != q.ChannelID {
+					continue
+				}
+				if q.AuthorID != 0 && snowflake.ID(binary.BigEndian.Uint64(v[16:])) != q.AuthorID {
+					continue
+				}
+				if matches == nil {
+					found[id] = struct{}{}
+				} else if _, ok := matches[id]; ok {
+					found[id] = struct{}{}
+				}
+			}
+			if err != nil && !lmdb.IsNotFound(err) {
+				return fmt.Errorf("failed to scan index: %w", err)
+			}
+			matches = found
+			if len(matches) == 0 {
+				return nil
+			}
+		}
+
+		ids := make([]snowflake.ID, 0, len(matches))
+		for id := range matches {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		slices.Reverse(ids)
+		result.Total = len(ids)
+
+		for _, id := range ids[:min(len(ids), q.Limit)] {
+			msg, err := TxnGetArchivedMessage(txn, archiveDBI, id)
+			if err != nil {
+				if lmdb.IsNotFound(err) {
+					continue
+				}
+				return err
+			}
+			result.Messages = append(result.Messages, *msg)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
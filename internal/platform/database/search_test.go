@@ -0,0 +1,123 @@
+package database
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Hello, hello WORLD! a bc https://example.com/x?y=1 ünïcode")
+	want := []string{"hello", "world", "bc", "https", "example", "com", "ünïcode"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	guildA, guildB := snowflake.New(base.Add(-4*time.Hour)), snowflake.New(base.Add(-5*time.Hour))
+	channelA, channelB := snowflake.New(base.Add(-2*time.Hour)), snowflake.New(base.Add(-3*time.Hour))
+	alice, bob := snowflake.New(base.Add(-6*time.Hour)), snowflake.New(base.Add(-7*time.Hour))
+	for _, id := range []snowflake.ID{channelA, channelB} {
+		if _, err := UpsertChannel(db, id, func(c *Channel) error { return nil }); err != nil {
+			t.Fatalf("Failed to create channel: %v", err)
+		}
+	}
+
+	msg := func(day int, guild, channel, author snowflake.ID, content string) ArchivedMessage {
+		created := base.AddDate(0, 0, day)
+		return ArchivedMessage{ID: snowflake.New(created), GuildID: guild, ChannelID: channel, AuthorID: author, Content: content, Created: created}
+	}
+	msgsA := []ArchivedMessage{
+		msg(0, guildA, channelA, alice, "the quick brown fox"),
+		msg(1, guildA, channelA, bob, "a quick lunch"),
+		msg(2, guildA, channelA, alice, "Quick! The fox is back"),
+	}
+	msgsB := []ArchivedMessage{
+		msg(3, guildB, channelB, bob, "quick fox in another guild"),
+	}
+	for ch, msgs := range map[snowflake.ID][]ArchivedMessage{channelA: msgsA, channelB: msgsB} {
+		if err := ArchiveMessages(db, ch, msgs, func(b *ChannelBackup) error { return nil }); err != nil {
+			t.Fatalf("ArchiveMessages() failed: %v", err)
+		}
+	}
+
+	ids := func(r *SearchResult) []snowflake.ID {
+		var out []snowflake.ID
+		for _, m := range r.Messages {
+			out = append(out, m.ID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []snowflake.ID
+	}{
+		{"Single Term", SearchQuery{Text: "quick", GuildIDs: []snowflake.ID{guildA}}, []snowflake.ID{msgsA[2].ID, msgsA[1].ID, msgsA[0].ID}},
+		{"All Terms", SearchQuery{Text: "FOX quick", GuildIDs: []snowflake.ID{guildA}}, []snowflake.ID{msgsA[2].ID, msgsA[0].ID}},
+		{"Guild Scope", SearchQuery{Text: "fox", GuildIDs: []snowflake.ID{guildA, guildB}}, []snowflake.ID{msgsB[0].ID, msgsA[2].ID, msgsA[0].ID}},
+		{"Author", SearchQuery{Text: "quick", GuildIDs: []snowflake.ID{guildA}, AuthorID: bob}, []snowflake.ID{msgsA[1].ID}},
+		{"Channel", SearchQuery{Text: "quick", GuildIDs: []snowflake.ID{guildA, guildB}, ChannelID: channelB}, []snowflake.ID{msgsB[0].ID}},
+		{"Dates", SearchQuery{Text: "quick", GuildIDs: []snowflake.ID{guildA}, After: base.AddDate(0, 0, 1), Before: base.AddDate(0, 0, 1)}, []snowflake.ID{msgsA[1].ID}},
+		{"Limit", SearchQuery{Text: "quick", GuildIDs: []snowflake.ID{guildA}, Limit: 1}, []snowflake.ID{msgsA[2].ID}},
+		{"No Match", SearchQuery{Text: "slow", GuildIDs: []snowflake.ID{guildA}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Search(db, tt.query)
+			if err != nil {
+				t.Fatalf("Search() failed: %v", err)
+			}
+			if got := ids(r); !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Reindex On Update", func(t *testing.T) {
+		edited := msgsA[0]
+		edited.Content = "the slow brown fox"
+		if err := ArchiveMessages(db, channelA, []ArchivedMessage{edited}, func(b *ChannelBackup) error { return nil }); err != nil {
+			t.Fatalf("ArchiveMessages() failed: %v", err)
+		}
+		r, err := Search(db, SearchQuery{Text: "quick brown", GuildIDs: []snowflake.ID{guildA}})
+		if err != nil {
+			t.Fatalf("Search() failed: %v", err)
+		}
+		if r.Total != 0 {
+			t.Errorf("Expected stale terms to be removed, got %v", ids(r))
+		}
+	})
+
+	t.Run("Unindex On Redact", func(t *testing.T) {
+		if _, err := RedactArchivedMessages(db, alice); err != nil {
+			t.Fatalf("RedactArchivedMessages() failed: %v", err)
+		}
+		r, err := Search(db, SearchQuery{Text: "fox", GuildIDs: []snowflake.ID{guildA}})
+		if err != nil {
+			t.Fatalf("Search() failed: %v", err)
+		}
+		if r.Total != 0 {
+			t.Errorf("Expected redacted messages to be unsearchable, got %v", ids(r))
+		}
+	})
+}
@@ -17,14 +17,17 @@ type RestartContext struct {
 	MessageID snowflake.ID `json:"messageID"`
 }
 
-// DomainBools represents per-domain toggling for a feature
+// DomainBools represents per-domain toggling for a feature, keyed by extractor ID.
 // Instagram is not included cause they don't support small project / casual API usage.
-// Twitter is not included cause the api pricing is stupid. Fuck you Elon, pathetic evil moron.
-type DomainBools struct {
-	Reddit        bool `json:"reddit"`
-	RedGifs       bool `json:"redGifs"` // ;p
-	YouTube       bool `json:"youTube"` // ignored by auto expand
-	YouTubeShorts bool `json:"youTubeShorts"`
+// X goes through an fxtwitter compatible API, see XitterAPIURL, cause the official api pricing is stupid.
+type DomainBools map[string]bool
+
+// Get returns the toggle of the given extractor, or fallback if it was never set.
+func (d DomainBools) Get(id string, fallback bool) bool {
+	if v, ok := d[id]; ok {
+		return v
+	}
+	return fallback
 }
 
 type Configuration struct {
@@ -43,11 +46,59 @@ type Configuration struct {
 
 	BotToken string `json:"botToken"`
 
-	OllamaURL string `json:"ollamaURL"` // e.g., "http://localhost:11434"
+	OllamaURL    string `json:"ollamaURL"`    // e.g., "http://localhost:11434"
+	XitterAPIURL string `json:"xitterAPIURL"` // fxtwitter or vxtwitter compatible API, e.g., "https://api.fxtwitter.com". "" = default
+
+	YtDLPHosts map[string]int `json:"ytdlpHosts"` // hosts downloaded with yt-dlp, to the minimum seconds between their links, e.g. "tiktok.com": 10
+
+	QueuePolicies map[string]QueuePolicy `json:"queuePolicies"` // by queue name, overrides the extractors' defaults
+
+	Outbound map[string]OutboundRoute `json:"outbound"` // by domain, applies to its subdomains too
+}
+
+// OutboundRoute is how downloads from a domain leave, see download.Route.
+type OutboundRoute struct {
+	Proxy   string `json:"proxy"`   // http, https, socks5 or socks5h URL, may carry credentials. "" = direct
+	Cookies string `json:"cookies"` // absolute path of a Netscape cookies file, "" = none
+}
+
+// QueuePolicy is an admin override of the rate policy of an extractor queue, in seconds.
+type QueuePolicy struct {
+	Interval float64 `json:"interval"` // minimum time between jobs
+	Jitter   float64 `json:"jitter"`   // extra random delay added to each interval
+	Backoff  float64 `json:"backoff"`  // initial backoff after a failed job
 }
 
+// Asset is a local copy of linked or attached media. Size and Stored are zero for assets stored
+// before retention policies existed, the file is used instead. GuildID is 0 if unknown.
 type Asset struct {
-	Path string `json:"path"`
+	Path     string       `json:"path"`
+	Size     int64        `json:"size"`     // bytes on disk
+	Stored   time.Time    `json:"stored"`   // when it was downloaded
+	GuildID  snowflake.ID `json:"guildID"`  // guild it was stored for, whose retention policy applies
+	Favorite bool         `json:"favorite"` // used by a favorited message, never evicted
+	NSFW     bool         `json:"nsfw"`     // marked NSFW by the source, spoilered outside NSFW channels
+
+	// what the link rot monitor last saw of the source, see linkrot.Monitor
+	Source        SourceState `json:"source"`
+	SourceReason  string      `json:"sourceReason"`  // why it's gone, e.g. "private", "not_found"
+	SourceChecked time.Time   `json:"sourceChecked"` // last probe, zero if never probed
+	SourceDied    time.Time   `json:"sourceDied"`    // when the source was first seen gone, zero while alive
+}
+
+// SourceState is the state of the source of an asset.
+type SourceState string
+
+const (
+	SourceUnknown SourceState = ""        // never probed
+	SourceAlive   SourceState = "alive"   // still there
+	SourceRemoved SourceState = "removed" // unavailable, e.g. private or taken down, may come back
+	SourceDeleted SourceState = "deleted" // deleted by its author or the site, never rechecked
+)
+
+// Dead reports whether the source of the asset is gone and the asset is the only copy left.
+func (a *Asset) Dead() bool {
+	return a.Source == SourceRemoved || a.Source == SourceDeleted
 }
 
 type User struct {
@@ -61,11 +112,20 @@ type User struct {
 	AutoExpand   DomainBools `json:"autoExpand"`
 }
 
+// ChannelBackup holds the archive cursors for a channel. On the first run Ceil is set to
+// a snowflake of the current time, the backward walk then moves Tail down from Ceil until the
+// start of the channel is reached (Complete), and the forward walk moves Head up from Ceil.
+// An imported export that doesn't reach Tail yet is remembered, the backward walk jumps over
+// it once it gets there.
 type ChannelBackup struct {
-	Enabled bool         `json:"backupEnabled"` // overruled if this is the bot channel
-	Ceil    snowflake.ID `json:"backupCeil"`
-	Head    snowflake.ID `json:"backupHead"`
-	Tail    snowflake.ID `json:"backupTail"`
+	Enabled        bool         `json:"backupEnabled"`  // overruled if this is the bot channel
+	Ceil           snowflake.ID `json:"backupCeil"`     // 0 until the first run
+	Head           snowflake.ID `json:"backupHead"`     // newest archived message (or Ceil)
+	Tail           snowflake.ID `json:"backupTail"`     // oldest archived message (or Ceil)
+	Complete       bool         `json:"backupComplete"` // backward walk reached the first message
+	ImportHead     snowflake.ID `json:"importHead"`     // newest message of a pending imported range, 0 if none
+	ImportTail     snowflake.ID `json:"importTail"`     // oldest message of the pending imported range
+	ImportComplete bool         `json:"importComplete"` // the imported range starts at the first message
 }
 
 type Channel struct {
@@ -73,17 +133,38 @@ type Channel struct {
 	Name     string              `json:"name"`
 	Type     discord.ChannelType `json:"type"`
 	Position int                 `json:"position"` // position in the channel list, guildThreads are always 0
-	ParentID snowflake.ID        `json:"parentID"` // category ID, 0 if none
+	ParentID snowflake.ID        `json:"parentID"` // category ID, or the parent channel of a thread, 0 if none
 	Backup   ChannelBackup       `json:"backup"`
 	AiChat   bool                `json:"aiChat"`
 	Deleted  bool                `json:"deleted"` // for knowing to skip backup
 }
 
+// BackupProgress is the status of a backup run, kept after the run finishes for the UI.
+type BackupProgress struct {
+	Started       time.Time    `json:"started"`
+	ChannelsDone  int          `json:"channelsDone"`
+	ChannelsTotal int          `json:"channelsTotal"`
+	Messages      int          `json:"messages"`  // archived so far, counted per finished channel
+	Errors        int          `json:"errors"`    // channels that failed
+	ChannelID     snowflake.ID `json:"channelID"` // bot channel the progress message was posted in
+	MessageID     snowflake.ID `json:"messageID"` // progress message, edited as the run goes, 0 if none
+}
+
 type GuildBackup struct {
-	Enabled  bool      `json:"enabled"`
-	Password string    `json:"password"` // after daily backups are completed, this is used to create an encrypted zip file
-	RunID    string    `json:"runID"`    // for knowing if a backup is in progress, synchronizing the channels debugging, etc.
-	LastRun  time.Time `json:"lastRun"`  // for UI
+	Enabled  bool           `json:"enabled"`
+	Password string         `json:"password"` // after daily backups are completed, this is used to create an encrypted zip file
+	Hour     int            `json:"hour"`     // hour of the day (UTC) the daily run starts
+	RunID    string         `json:"runID"`    // for knowing if a backup is in progress, synchronizing the channels debugging, etc.
+	LastRun  time.Time      `json:"lastRun"`  // for UI
+	Progress BackupProgress `json:"progress"` // of the run in progress, or the last one if RunID is empty
+}
+
+// RetentionPolicy bounds the storage used by a guild, zero values mean no limit. Favorited
+// messages and assets are never evicted.
+type RetentionPolicy struct {
+	MaxAgeDays     int              `json:"maxAgeDays"`     // archived messages and assets older than this are evicted
+	MaxBytes       int64            `json:"maxBytes"`       // assets and archived messages combined
+	DomainMaxBytes map[string]int64 `json:"domainMaxBytes"` // assets per source domain, e.g. "redgifs.com"
 }
 
 type Guild struct {
@@ -96,6 +177,64 @@ type Guild struct {
 	Backup         GuildBackup         `json:"backup"`
 	AntiRotEnabled bool                `json:"antiRotEnabled"`
 	AiChatEnabled  bool                `json:"aiChatEnabled"`
+	Retention      RetentionPolicy     `json:"retention"`
+}
+
+// UploadLimit returns the size limit of a file the bot uploads to the guild, by boost tier.
+func (g *Guild) UploadLimit() int64 {
+	switch g.PremiumTier {
+	case discord.PremiumTier2:
+		return 49 * 1024 * 1024 // 49mb
+	case discord.PremiumTier3:
+		return 99 * 1024 * 1024 // 99mb
+	default:
+		return 24 * 1024 * 1024 // 24mb
+	}
+}
+
+// ArchivedAttachment is the stored form of a message attachment.
+type ArchivedAttachment struct {
+	Filename    string `json:"filename"`
+	URL         string `json:"url"` // discord CDN url, these expire
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"`
+	Asset       string `json:"asset"` // local asset name (<hash>.<ext>) if the media was mirrored, empty otherwise
+}
+
+// ArchivedRevision is a superseded version of an edited message.
+type ArchivedRevision struct {
+	Content     string               `json:"content"`
+	Attachments []ArchivedAttachment `json:"attachments"`
+	Edited      *time.Time           `json:"edited"` // when this version was written, nil for the original
+}
+
+// ArchivedMessage is the stored form of a backed up message, gzipped in the Archive DBI.
+type ArchivedMessage struct {
+	ID          snowflake.ID         `json:"id"`
+	GuildID     snowflake.ID         `json:"guildID"`
+	ChannelID   snowflake.ID         `json:"channelID"`
+	AuthorID    snowflake.ID         `json:"authorID"`
+	Author      string               `json:"author"` // username at time of archiving
+	Content     string               `json:"content"`
+	ReplyTo     snowflake.ID         `json:"replyTo"` // 0 if not a reply
+	Attachments []ArchivedAttachment `json:"attachments"`
+	Created     time.Time            `json:"created"`
+	Edited      *time.Time           `json:"edited"`
+	Redacted    bool                 `json:"redacted"`  // author opted out, content and attachments removed
+	Revisions   []ArchivedRevision   `json:"revisions"` // prior versions, oldest first
+	Deleted     *time.Time           `json:"deleted"`   // when the deletion was seen, nil if not deleted
+}
+
+// Replay is the state of an archived channel being replayed into another channel through a webhook.
+type Replay struct {
+	WebhookID    snowflake.ID `json:"webhookID"` // 0 until created, reused on resume
+	WebhookToken string       `json:"webhookToken"`
+	Cursor       snowflake.ID `json:"cursor"`   // last replayed source message, 0 before the first
+	Parts        int          `json:"parts"`    // webhook messages of the message after the cursor already posted
+	Replayed     int          `json:"replayed"` // messages posted so far
+	Started      time.Time    `json:"started"`
+	Finished     time.Time    `json:"finished"` // zero while unfinished
+	Error        string       `json:"error"`    // why the last attempt stopped, cleared on resume
 }
 
 type Session struct {
@@ -0,0 +1,297 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxDirectSize caps direct downloads, larger files fail with ErrTooLarge.
+	MaxDirectSize = 1 << 30
+	// maxResumeAttempts is how many times an interrupted download is resumed.
+	maxResumeAttempts = 3
+	// sniffLength is how much of a file http.DetectContentType looks at.
+	sniffLength = 512
+)
+
+var ErrTooLarge = errors.New("file is too large")
+
+// RateLimitError is returned when a server answers 429, or 503 with a Retry-After header.
+// It matches ErrTooManyRequests with errors.Is.
+type RateLimitError struct {
+	RetryAfter time.Duration // 0 if the server didn't say
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%v, retry after %s", ErrTooManyRequests, e.RetryAfter)
+	}
+	return ErrTooManyRequests.Error()
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrTooManyRequests
+}
+
+// DirectResult is a file downloaded by DownloadDirect.
+type DirectResult struct {
+	Path        string
+	Size        int64
+	SHA256      string // hex
+	ContentType string // sniffed, or from the response if sniffing was inconclusive
+}
+
+// DownloadDirect downloads a file over http into a temp file named *.<ext>, resuming with
+// Range requests if the connection drops. If the content turns out to be another media type
+// than ext says, the file gets the sniffed extension instead.
+// The caller is responsible for removing the returned file when done.
+func DownloadDirect(ctx context.Context, rawURL, tempDir, ext, userAgent string, maxBytes int64) (DirectResult, error) {
+	f, err := os.CreateTemp(tempDir, "*."+ext)
+	if err != nil {
+		return DirectResult{}, fmt.Errorf("create temp file: %w", err)
+	}
+	d := &directDownload{url: rawURL, userAgent: userAgent, maxBytes: maxBytes, file: f, hash: sha256.New()}
+	err = d.run(ctx)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("close temp file: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return DirectResult{}, err
+	}
+
+	res := DirectResult{
+		Path:        f.Name(),
+		Size:        d.written,
+		SHA256:      hex.EncodeToString(d.hash.Sum(nil)),
+		ContentType: d.contentType(),
+	}
+	if sniffed := extForContentType(res.ContentType); sniffed != "" && !sameExt(sniffed, ext) {
+		fixed := strings.TrimSuffix(res.Path, filepath.Ext(res.Path)) + "." + sniffed
+		if err := os.Rename(res.Path, fixed); err != nil {
+			os.Remove(res.Path)
+			return DirectResult{}, fmt.Errorf("rename to sniffed extension: %w", err)
+		}
+		res.Path = fixed
+	}
+	return res, nil
+}
+
+// directDownload is the state of one download across resume attempts.
+type directDownload struct {
+	url, userAgent string
+	maxBytes       int64
+	file           *os.File
+	hash           hash.Hash
+	written        int64
+	head           []byte // first bytes, for content sniffing
+	header         string // Content-Type of the response
+}
+
+// resumableError is a failure after which the download can continue where it stopped.
+type resumableError struct{ err error }
+
+func (e *resumableError) Error() string { return e.err.Error() }
+func (e *resumableError) Unwrap() error { return e.err }
+
+func (d *directDownload) run(ctx context.Context) error {
+	for attempt := 0; ; attempt++ {
+		err := d.fetch(ctx)
+		var re *resumableError
+		if err == nil || !errors.As(err, &re) || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= maxResumeAttempts {
+			return fmt.Errorf("download failed after %d resumes: %w", attempt, re.err)
+		}
+	}
+}
+
+// fetch requests the rest of the file and appends it.
+func (d *directDownload) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	req.Header.Set("User-Agent", d.userAgent)
+	if d.written > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", d.written))
+	}
+	resp, err := Client.Do(req) // no timeout of its own, downloads are bounded by their context
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("download timed out: %w", err)
+		}
+		if d.written > 0 {
+			return &resumableError{err}
+		}
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != "":
+		return &RateLimitError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	case resp.StatusCode == http.StatusPartialContent && d.written > 0:
+		if start, ok := rangeStart(resp.Header.Get("Content-Range")); !ok || start != d.written {
+			return fmt.Errorf("server resumed at the wrong offset: %q", resp.Header.Get("Content-Range"))
+		}
+	case resp.StatusCode == http.StatusOK:
+		if d.written > 0 {
+			// range ignored, start over
+			if err := d.reset(); err != nil {
+				return err
+			}
+		}
+		d.header = resp.Header.Get("Content-Type")
+	default:
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	if resp.ContentLength > 0 && d.written+resp.ContentLength > d.maxBytes {
+		return fmt.Errorf("%w: %d bytes", ErrTooLarge, d.written+resp.ContentLength)
+	}
+
+	// one byte over the limit is enough to know it's too large
+	body := &readErrReader{r: io.LimitReader(resp.Body, d.maxBytes-d.written+1)}
+	n, err := io.Copy(io.MultiWriter(d.file, d.hash, (*headWriter)(d)), body)
+	d.written += n
+	switch {
+	case d.written > d.maxBytes:
+		return fmt.Errorf("%w: over %d bytes", ErrTooLarge, d.maxBytes)
+	case body.err != nil:
+		if ctx.Err() != nil {
+			return fmt.Errorf("download cancelled: %w", ctx.Err())
+		}
+		return &resumableError{fmt.Errorf("connection lost after %d bytes: %w", d.written, body.err)}
+	case err != nil:
+		return fmt.Errorf("write failed: %w", err)
+	}
+	return nil
+}
+
+// reset discards what was written so far.
+func (d *directDownload) reset() error {
+	if err := d.file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate: %w", err)
+	}
+	if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek: %w", err)
+	}
+	d.hash.Reset()
+	d.written, d.head = 0, nil
+	return nil
+}
+
+// contentType returns the sniffed type, or the response's if sniffing was inconclusive.
+func (d *directDownload) contentType() string {
+	sniffed := http.DetectContentType(d.head)
+	if sniffed == "application/octet-stream" || strings.HasPrefix(sniffed, "text/plain") {
+		if d.header != "" {
+			return d.header
+		}
+	}
+	return sniffed
+}
+
+// headWriter keeps the first sniffLength bytes of a download.
+type headWriter directDownload
+
+func (h *headWriter) Write(p []byte) (int, error) {
+	if missing := sniffLength - len(h.head); missing > 0 {
+		h.head = append(h.head, p[:min(missing, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// readErrReader records read errors so they can be told apart from write errors of io.Copy.
+type readErrReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// parseRetryAfter parses a Retry-After header, either seconds or an http date. Returns 0 if unset or invalid.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// rangeStart returns the first byte of a Content-Range header, e.g. 100 for "bytes 100-199/200".
+func rangeStart(v string) (int64, bool) {
+	v, ok := strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	start, _, ok := strings.Cut(v, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	return n, err == nil
+}
+
+// mediaExts maps the media types worth correcting an extension for to their extension.
+var mediaExts = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+	"image/avif": "avif",
+	"video/mp4":  "mp4",
+	"video/webm": "webm",
+	"audio/mpeg": "mp3",
+}
+
+// extForContentType returns the extension of a media type, or "" if it's not one we correct to.
+func extForContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaExts[mediaType]
+}
+
+// sameExt compares extensions, treating spellings of the same type as equal.
+func sameExt(a, b string) bool {
+	norm := func(ext string) string {
+		ext = strings.ToLower(ext)
+		if ext == "jpeg" || ext == "jfif" {
+			return "jpg"
+		}
+		return ext
+	}
+	return norm(a) == norm(b)
+}
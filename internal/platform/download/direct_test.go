@@ -0,0 +1,188 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pngBytes is enough of a png for http.DetectContentType.
+var pngBytes = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 600)...)
+
+func sha(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// flakyServer serves content, dropping the connection halfway through the first response.
+// Range requests are answered with 206 unless ignoreRange is set. Returns the Range headers seen.
+func flakyServer(t *testing.T, content []byte, ignoreRange bool) (*httptest.Server, *[]string) {
+	t.Helper()
+	var ranges []string
+	first := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if first {
+			first = false
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(content[:len(content)/2])
+			// lie about the length, the client sees an unexpected EOF
+			conn, _, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				t.Fatalf("hijack: %v", err)
+			}
+			conn.Close()
+			return
+		}
+		start := 0
+		if v := r.Header.Get("Range"); v != "" && !ignoreRange {
+			fmt.Sscanf(v, "bytes=%d-", &start)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		w.Write(content[start:])
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &ranges
+}
+
+func TestDownloadDirect(t *testing.T) {
+	content := bytes.Repeat([]byte("halsey "), 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "test-agent" {
+			t.Errorf("Request without user agent")
+		}
+		switch r.URL.Path {
+		case "/file.txt":
+			w.Write(content)
+		case "/image.jpg":
+			w.Header().Set("Content-Type", "image/jpeg") // wrong, sniffing wins
+			w.Write(pngBytes)
+		case "/clip":
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Write([]byte("not sniffable"))
+		}
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+
+	res, err := DownloadDirect(context.Background(), srv.URL+"/file.txt", dir, "txt", "test-agent", MaxDirectSize)
+	if err != nil {
+		t.Fatalf("DownloadDirect failed: %v", err)
+	}
+	got, _ := os.ReadFile(res.Path)
+	if !bytes.Equal(got, content) || res.Size != int64(len(content)) || res.SHA256 != sha(content) {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	if filepath.Dir(res.Path) != dir || filepath.Ext(res.Path) != ".txt" {
+		t.Errorf("Unexpected path %s", res.Path)
+	}
+
+	res, err = DownloadDirect(context.Background(), srv.URL+"/image.jpg", dir, "jpg", "test-agent", MaxDirectSize)
+	if err != nil || filepath.Ext(res.Path) != ".png" || res.ContentType != "image/png" {
+		t.Errorf("Expected sniffed png, got %+v, %v", res, err)
+	}
+
+	// sniffing is inconclusive, the header decides
+	res, err = DownloadDirect(context.Background(), srv.URL+"/clip", dir, "bin", "test-agent", MaxDirectSize)
+	if err != nil || filepath.Ext(res.Path) != ".mp4" {
+		t.Errorf("Expected mp4 from header, got %+v, %v", res, err)
+	}
+}
+
+func TestDownloadDirectResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	for _, ignoreRange := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ignoreRange=%v", ignoreRange), func(t *testing.T) {
+			srv, ranges := flakyServer(t, content, ignoreRange)
+			res, err := DownloadDirect(context.Background(), srv.URL, t.TempDir(), "bin", "test-agent", MaxDirectSize)
+			if err != nil {
+				t.Fatalf("DownloadDirect failed: %v", err)
+			}
+			got, _ := os.ReadFile(res.Path)
+			if !bytes.Equal(got, content) || res.SHA256 != sha(content) {
+				t.Errorf("Resumed file differs, %d bytes, sha %s", len(got), res.SHA256)
+			}
+			if len(*ranges) != 2 || (*ranges)[0] != "" || !strings.HasPrefix((*ranges)[1], "bytes=") {
+				t.Errorf("Unexpected Range headers %q", *ranges)
+			}
+		})
+	}
+}
+
+func TestDownloadDirectErrors(t *testing.T) {
+	big := bytes.Repeat([]byte("x"), 2048)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/big":
+			w.Write(big)
+		case "/big-chunked":
+			w.Write(big[:1024])
+			w.(http.Flusher).Flush() // no Content-Length, only streaming catches it
+			w.Write(big[1024:])
+		case "/limited":
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/missing":
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+
+	for _, path := range []string{"/big", "/big-chunked"} {
+		if _, err := DownloadDirect(context.Background(), srv.URL+path, dir, "bin", "test-agent", 1024); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s: expected ErrTooLarge, got %v", path, err)
+		}
+	}
+
+	_, err := DownloadDirect(context.Background(), srv.URL+"/limited", dir, "bin", "test-agent", MaxDirectSize)
+	var rl *RateLimitError
+	if !errors.Is(err, ErrTooManyRequests) || !errors.As(err, &rl) || rl.RetryAfter != 2*time.Minute {
+		t.Errorf("Expected rate limit error with retry after, got %v", err)
+	}
+
+	if _, err := DownloadDirect(context.Background(), srv.URL+"/missing", dir, "bin", "test-agent", MaxDirectSize); err == nil {
+		t.Error("Expected error for 404")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := DownloadDirect(ctx, srv.URL+"/big", dir, "bin", "test-agent", MaxDirectSize); err == nil {
+		t.Error("Expected error for cancelled context")
+	}
+
+	// failures leave nothing behind
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no leftover files, got %d", len(entries))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"30":                            30 * time.Second,
+		"-5":                            0,
+		"soon":                          0,
+		"Wed, 01 Jan 2025 12:01:30 GMT": 90 * time.Second,
+		"Wed, 01 Jan 2025 11:00:00 GMT": 0,
+	}
+	for v, want := range tests {
+		if got := parseRetryAfter(v, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", v, got, want)
+		}
+	}
+}
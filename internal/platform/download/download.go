@@ -1,10 +1,10 @@
 // Package download implements a three-stage media retrieval pipeline:
 //
-//  1. ParseDomain classifies the incoming link so we know which extractor to use.
-//  2. Domain-specific extractors resolve high-level resources (posts, threads, etc.)
-//     into direct media URLs; YouTube/Shorts skip this step and go straight to yt-dlp.
-//  3. DownloadMedia downloads the media URL to a temp file using the appropriate
-//     tool (e.g., ffmpeg, curl) determined by analyzing the URL for a format type.
+//  1. extractors.Find picks the registered extractor whose matchers accept the link.
+//  2. The extractor resolves high-level resources (posts, threads, etc.) into direct
+//     media URLs; YouTube/Shorts/RedGifs links are the media and go straight to yt-dlp.
+//  3. DownloadMedia downloads the media URL to a temp file, streams with ffmpeg and plain
+//     files in process (see DownloadDirect), determined by analyzing the URL for a format type.
 //
 // Doing it like this keeps file-level downloads simple to reason about, yet allows the
 // package to accept richer inputs and makes future extractors easy to add.
@@ -15,9 +15,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -27,21 +29,30 @@ const defaultTimeout = 5 * time.Minute
 
 var ErrTooManyRequests = errors.New("too many requests, try again later")
 
+// ErrUnavailable is returned by yt-dlp for media that was removed, deleted or made private.
+var ErrUnavailable = errors.New("media is unavailable")
+
+// File is a downloaded temp file, the caller is responsible for removing it.
+type File struct {
+	Path   string
+	SHA256 string // hex, "" if it wasn't hashed while downloading
+}
+
 // DownloadMedia parses the URL into a DownloadPlan and executes it.
-// Returns the path to the downloaded file or an error.
-func DownloadMedia(rawURL, tempDir, userAgent string, timeout time.Duration) (string, error) {
+// Returns the downloaded file or an error.
+func DownloadMedia(rawURL, tempDir, userAgent string, timeout time.Duration) (File, error) {
 	plan, err := ParseMediaURL(rawURL)
 	if err != nil {
-		return "", err
+		return File{}, err
 	}
 	return DownloadWithPlan(plan, tempDir, userAgent, timeout)
 }
 
 // DownloadWithPlan executes a previously parsed download plan.
-// Returns the path to the downloaded file or an error.
-func DownloadWithPlan(plan DownloadPlan, tempDir, userAgent string, timeout time.Duration) (string, error) {
+// Returns the downloaded file or an error.
+func DownloadWithPlan(plan DownloadPlan, tempDir, userAgent string, timeout time.Duration) (File, error) {
 	if err := plan.Validate(); err != nil {
-		return "", err
+		return File{}, err
 	}
 	if timeout <= 0 {
 		timeout = defaultTimeout
@@ -52,17 +63,33 @@ func DownloadWithPlan(plan DownloadPlan, tempDir, userAgent string, timeout time
 
 	switch plan.Strategy {
 	case StrategyFFmpeg:
-		return fetchWithTempFile(ctx, plan, tempDir, "ffmpeg", userAgent, runFFmpeg)
+		path, err := fetchWithTempFile(ctx, plan, tempDir, "ffmpeg", userAgent, runFFmpeg)
+		return File{Path: path}, err
 	case StrategyDirect:
-		return fetchWithTempFile(ctx, plan, tempDir, "curl", userAgent, runCurl)
+		res, err := DownloadDirect(ctx, plan.URL, tempDir, plan.OutputExt, userAgent, MaxDirectSize)
+		if err != nil {
+			return File{}, err
+		}
+		return File{Path: res.Path, SHA256: res.SHA256}, nil
 	default:
-		return "", fmt.Errorf("unsupported download strategy: %s", plan.Strategy)
+		return File{}, fmt.Errorf("unsupported download strategy: %s", plan.Strategy)
 	}
 }
 
+// Progress is how far a yt-dlp download got. Video and audio are downloaded one after the other,
+// so the progress starts over for the second.
+type Progress struct {
+	Downloaded int64
+	Total      int64 // estimated if yt-dlp doesn't know it exactly, 0 if unknown
+}
+
+// ytdlpProgressPrefix marks the progress lines of our yt-dlp progress template.
+const ytdlpProgressPrefix = "[sprout-progress]"
+
 // YtDLP downloads YouTube media to a temp file, moves it to a safe location, and returns the path.
+// onProgress, if set, is called as the download progresses.
 // The caller is responsible for removing the returned file when done.
-func YtDLP(ctx context.Context, rawURL, tempDir string, timeout time.Duration) (string, error) {
+func YtDLP(ctx context.Context, rawURL, tempDir string, timeout time.Duration, onProgress func(Progress)) (string, error) {
 	if err := ensureTool("yt-dlp"); err != nil {
 		return "", err
 	}
@@ -81,21 +108,48 @@ func YtDLP(ctx context.Context, rawURL, tempDir string, timeout time.Duration) (
 	// run yt-dlp. use a generic name "clip" so we don't have to guess the title.
 	outTpl := filepath.Join(tmpDir, "clip.%(ext)s")
 
-	cmd := exec.CommandContext(
-		dCtx, "yt-dlp",
+	progressArgs := []string{"--no-progress"}
+	if onProgress != nil {
+		progressArgs = []string{"--progress", "--newline", "--progress-template",
+			"download:" + ytdlpProgressPrefix + " %(progress.downloaded_bytes)s %(progress.total_bytes)s %(progress.total_bytes_estimate)s"}
+	}
+	args := append([]string{
 		"-f", "bestvideo+bestaudio/best",
 		"--no-playlist",
-		"-q", "--no-warnings", "--no-progress",
+		"-q", "--no-warnings",
 		"-o", outTpl,
-		rawURL,
-	)
+	}, progressArgs...)
+	route := RouteFor(rawURL)
+	routeArgs, err := ytdlpRouteArgs(route, tmpDir)
+	if err != nil {
+		return "", err
+	}
+	args = append(args, routeArgs...)
+	cmd := exec.CommandContext(dCtx, "yt-dlp", append(args, rawURL)...)
+	cmd.Env = proxyEnv(route, ytdlpProxyVars...)
 
-	// capture stderr in case of failure
+	// capture stderr in case of failure. progress is printed to stderr in quiet mode, watch both to
+	// be safe, exec serializes writes when they share the writer
 	var stderr strings.Builder
 	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("yt-dlp failed: %v\n%s", err, strings.TrimSpace(stderr.String()))
+	var progress *lineWriter
+	if onProgress != nil {
+		progress = &lineWriter{fn: func(line string) {
+			if p, ok := parseYtDLPProgress(line); ok {
+				onProgress(p)
+			} else {
+				stderr.WriteString(line + "\n")
+			}
+		}}
+		cmd.Stdout, cmd.Stderr = progress, progress
+	}
+
+	err = cmd.Run()
+	if progress != nil {
+		progress.flush()
+	}
+	if err != nil {
+		return "", fmt.Errorf("yt-dlp failed: %v\n%s", err, route.redact(strings.TrimSpace(stderr.String())))
 	}
 
 	// find the file, should be the only file in tmpDir
@@ -130,6 +184,57 @@ func YtDLP(ctx context.Context, rawURL, tempDir string, timeout time.Duration) (
 	return finalPath, nil
 }
 
+// parseYtDLPProgress parses a line printed by our yt-dlp progress template, unknown values are "NA".
+func parseYtDLPProgress(line string) (Progress, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), ytdlpProgressPrefix)
+	if !ok {
+		return Progress{}, false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) != 3 {
+		return Progress{}, false
+	}
+	num := func(v string) int64 {
+		f, err := strconv.ParseFloat(v, 64) // the estimate is a float
+		if err != nil || f < 0 {
+			return 0
+		}
+		return int64(f)
+	}
+	p := Progress{Downloaded: num(fields[0]), Total: num(fields[1])}
+	if p.Total == 0 {
+		p.Total = num(fields[2])
+	}
+	return p, true
+}
+
+// lineWriter calls fn with every complete line written to it.
+type lineWriter struct {
+	fn  func(line string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush passes on what's left after the last newline.
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.fn(string(w.buf))
+		w.buf = nil
+	}
+}
+
 // YtDLPLength probes the length of a YouTube video in seconds using yt-dlp.
 func YtDLPLength(ctx context.Context, rawURL string, timeout time.Duration) (int, error) {
 	if err := ensureTool("yt-dlp"); err != nil {
@@ -142,24 +247,39 @@ func YtDLPLength(ctx context.Context, rawURL string, timeout time.Duration) (int
 	pCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	// the cookies need a place to be copied to
+	tmpDir, err := os.MkdirTemp("", "yt-dlp-probe-")
+	if err != nil {
+		return 0, fmt.Errorf("mktemp: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	route := RouteFor(rawURL)
+	routeArgs, err := ytdlpRouteArgs(route, tmpDir)
+	if err != nil {
+		return 0, err
+	}
+
 	stdout := &bytes.Buffer{}
 	stderr := &bytes.Buffer{}
 
-	cmd := exec.CommandContext(
-		pCtx, "yt-dlp",
+	args := append([]string{
 		"-q", "--no-warnings", "--no-progress",
 		"--print", "duration",
-		rawURL,
-	)
+	}, routeArgs...)
+	cmd := exec.CommandContext(pCtx, "yt-dlp", append(args, rawURL)...)
+	cmd.Env = proxyEnv(route, ytdlpProxyVars...)
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
 	if err := cmd.Run(); err != nil {
 		// if context timed out, surface that explicitly.
 		if errors.Is(pCtx.Err(), context.DeadlineExceeded) {
-			return 0, fmt.Errorf("yt-dlp duration probe timed out: %s", strings.TrimSpace(stderr.String()))
+			return 0, fmt.Errorf("yt-dlp duration probe timed out: %s", route.redact(strings.TrimSpace(stderr.String())))
+		}
+		if isUnavailableMessage(stderr.String()) {
+			return 0, fmt.Errorf("%w: %s", ErrUnavailable, route.redact(strings.TrimSpace(stderr.String())))
 		}
-		return 0, fmt.Errorf("yt-dlp duration probe failed: %v\n%s", err, strings.TrimSpace(stderr.String()))
+		return 0, fmt.Errorf("yt-dlp duration probe failed: %v\n%s", err, route.redact(strings.TrimSpace(stderr.String())))
 	}
 
 	out := strings.TrimSpace(stdout.String())
@@ -242,6 +362,30 @@ func fetchWithTempFile(ctx context.Context, plan DownloadPlan, tempDir, tool, us
 	return outPath, nil
 }
 
+// ytdlpProxyVars are the environment variables yt-dlp takes its proxy from, ALL_PROXY for socks.
+var ytdlpProxyVars = []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY"}
+
+// ytdlpRouteArgs returns the yt-dlp flags of a route, its cookies are copied into dir. The proxy
+// goes in the environment, see proxyEnv.
+func ytdlpRouteArgs(route Route, dir string) ([]string, error) {
+	cookies, err := copyCookies(route, dir)
+	if err != nil {
+		return nil, err
+	}
+	if cookies != "" {
+		return []string{"--cookies", cookies}, nil
+	}
+	return nil, nil
+}
+
+// hostname returns the host of a URL, or the URL itself if it doesn't parse.
+func hostname(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Hostname()
+	}
+	return rawURL
+}
+
 func ensureTool(name string) error {
 	if _, err := exec.LookPath(name); err != nil {
 		return fmt.Errorf("%s not found in PATH: %w", name, err)
@@ -250,20 +394,22 @@ func ensureTool(name string) error {
 }
 
 func runFFmpeg(ctx context.Context, rawURL, outPath, userAgent string) error {
-	cmd := exec.CommandContext(
-		ctx,
-		"ffmpeg",
+	// ffmpeg only speaks http proxies, and gets no cookies
+	route := RouteFor(rawURL)
+	if strings.HasPrefix(route.Proxy, "socks5") {
+		return fmt.Errorf("ffmpeg can't use the socks proxy of %s, use an http proxy for streams", hostname(rawURL))
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg",
 		"-y",
 		"-user_agent", userAgent,
 		"-allowed_extensions", "ALL",
-		"-i", rawURL,
-		"-c", "copy",
-		outPath,
+		"-i", rawURL, "-c", "copy", outPath,
 	)
+	cmd.Env = proxyEnv(route, "http_proxy")
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		// include last line of ffmpeg output when possible
-		msg := strings.TrimSpace(string(out))
+		msg := route.redact(strings.TrimSpace(string(out)))
 		if msg == "" {
 			msg = err.Error()
 		}
@@ -280,37 +426,23 @@ func runFFmpeg(ctx context.Context, rawURL, outPath, userAgent string) error {
 	return nil
 }
 
-func runCurl(ctx context.Context, rawURL, outPath, userAgent string) error {
-	cmd := exec.CommandContext(
-		ctx,
-		"curl",
-		"-fsSL",
-		"-A", userAgent,
-		"-w", "%{http_code}",
-		"-o", outPath,
-		rawURL,
-	)
-	out, err := cmd.CombinedOutput()
-	msg := strings.TrimSpace(string(out))
-	if err != nil {
-		if msg == "" {
-			msg = err.Error()
-		}
-		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-			return fmt.Errorf("curl timed out: %s", msg)
-		}
-		// Check the HTTP status code from -w "%{http_code}".
-		if status := parseCurlStatusCode(msg); status == 429 {
-			return ErrTooManyRequests
-		}
-		// Fallback to message sniffing in case status parse fails but server
-		// text still mentions rate limiting.
-		if isTooManyRequestsMessage(msg) {
-			return ErrTooManyRequests
-		}
-		return fmt.Errorf("curl failed: %s", msg)
-	}
-	return nil
+// unavailableMessages are what yt-dlp says about media that is gone, lowercase.
+var unavailableMessages = []string{
+	"video unavailable",
+	"private video",
+	"this video has been removed",
+	"this video is no longer available",
+	"account associated with this video has been terminated",
+	"http error 404",
+	"http error 410",
+}
+
+// isUnavailableMessage does a best-effort sniff for yt-dlp errors about removed or private media.
+func isUnavailableMessage(msg string) bool {
+	lower := strings.ToLower(msg)
+	return slices.ContainsFunc(unavailableMessages, func(m string) bool {
+		return strings.Contains(lower, m)
+	})
 }
 
 // isTooManyRequestsMessage does a best-effort sniff for HTTP 429 / rate limit messages.
@@ -325,18 +457,3 @@ func isTooManyRequestsMessage(msg string) bool {
 	}
 	return false
 }
-
-// parseCurlStatusCode tries to pull an HTTP status code out of curl's -w "%{http_code}" output.
-func parseCurlStatusCode(msg string) int {
-	fields := strings.Fields(msg)
-	for i := len(fields) - 1; i >= 0; i-- {
-		if len(fields[i]) != 3 {
-			continue
-		}
-		n, err := strconv.Atoi(fields[i])
-		if err == nil {
-			return n
-		}
-	}
-	return 0
-}
@@ -0,0 +1,54 @@
+package download
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestParseYtDLPProgress(t *testing.T) {
+	tests := []struct {
+		line string
+		want Progress
+		ok   bool
+	}{
+		{"[sprout-progress] 1024 4096 NA", Progress{Downloaded: 1024, Total: 4096}, true},
+		{"[sprout-progress] 1024 NA 5000.5", Progress{Downloaded: 1024, Total: 5000}, true},
+		{"[sprout-progress] 1024 NA NA\r", Progress{Downloaded: 1024}, true},
+		{"  [sprout-progress] NA NA NA", Progress{}, true},
+		{"[sprout-progress] 1024", Progress{}, false},
+		{"ERROR: [youtube] abc: Video unavailable", Progress{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseYtDLPProgress(tt.line)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseYtDLPProgress(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{fn: func(line string) { lines = append(lines, line) }}
+	for _, chunk := range []string{"first\r\nsec", "ond\n", "\nthird"} {
+		fmt.Fprint(w, chunk)
+	}
+	w.flush()
+	if want := []string{"first", "second", "", "third"}; !slices.Equal(lines, want) {
+		t.Errorf("Got lines %q, want %q", lines, want)
+	}
+}
+
+func TestIsUnavailableMessage(t *testing.T) {
+	for msg, want := range map[string]bool{
+		"ERROR: [youtube] abc: Video unavailable. This video has been removed by the uploader": true,
+		"ERROR: [youtube] abc: Private video. Sign in if you've been granted access":           true,
+		"ERROR: [generic] Unable to download webpage: HTTP Error 404: Not Found":               true,
+		"ERROR: [youtube] abc: Unable to download API page: HTTP Error 429: Too Many Requests": false,
+		"ERROR: unable to connect to proxy":                                                    false,
+	} {
+		if got := isUnavailableMessage(msg); got != want {
+			t.Errorf("isUnavailableMessage(%q) = %v", msg, got)
+		}
+	}
+}
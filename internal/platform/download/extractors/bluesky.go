@@ -0,0 +1,257 @@
+package extractors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func init() {
+	Register(bluesky{})
+}
+
+const maxBlueskyJSONLength = 4 << 20
+
+// blueskyBaseURL is the AppView posts are fetched from, it needs no auth. Overridden by tests.
+var blueskyBaseURL = "https://public.api.bsky.app"
+
+// blueskyNSFWLabels are the self and moderation labels that mark a post as adult content.
+var blueskyNSFWLabels = []string{"porn", "sexual", "nudity", "graphic-media"}
+
+type bluesky struct{}
+
+func (bluesky) Info() Info {
+	return Info{ID: "bluesky", Name: "Bluesky", Emoji: "bluesky", AutoExpand: true, Queue: defaultQueue("bluesky")}
+}
+
+func (bluesky) Match(rawURL string) bool {
+	return hasAnyPrefix(rawURL, []string{"https://bsky.app/profile/", "https://www.bsky.app/profile/"}) &&
+		strings.Contains(rawURL, "/post/")
+}
+
+func (bluesky) Extract(ctx context.Context, rawURL, userAgent string) (Result, string, error) {
+	return Bluesky(ctx, rawURL, userAgent)
+}
+
+func (bluesky) Canonicalize(u *url.URL) {
+	setHost(u, "bsky.app")
+	u.Path = strings.TrimSuffix(u.Path, "/")
+}
+
+// blueskyPost is the subset of an app.bsky.feed.defs#postView we use.
+type blueskyPost struct {
+	URI    string `json:"uri"`
+	Author struct {
+		Handle string `json:"handle"`
+	} `json:"author"`
+	Record struct {
+		Text string `json:"text"`
+	} `json:"record"`
+	Embed  *blueskyEmbed  `json:"embed"`
+	Labels []blueskyLabel `json:"labels"`
+}
+
+type blueskyLabel struct {
+	Val string `json:"val"`
+}
+
+// blueskyEmbed is a union of the embed views, distinguished by Type.
+type blueskyEmbed struct {
+	Type string `json:"$type"`
+	// app.bsky.embed.images#view
+	Images []struct {
+		Fullsize string `json:"fullsize"`
+	} `json:"images"`
+	// app.bsky.embed.video#view
+	Playlist string `json:"playlist"`
+	// app.bsky.embed.external#view
+	External *struct {
+		URI string `json:"uri"`
+	} `json:"external"`
+	// app.bsky.embed.record#view, or app.bsky.embed.recordWithMedia#view where it's wrapped once more
+	Record json.RawMessage `json:"record"`
+	// app.bsky.embed.recordWithMedia#view
+	Media *blueskyEmbed `json:"media"`
+}
+
+// blueskyQuote is an app.bsky.embed.record#viewRecord, or one of the not found / blocked views.
+type blueskyQuote struct {
+	Type   string `json:"$type"`
+	Author struct {
+		Handle string `json:"handle"`
+	} `json:"author"`
+	Value struct {
+		Text string `json:"text"`
+	} `json:"value"`
+	Labels []blueskyLabel  `json:"labels"`
+	Embeds []*blueskyEmbed `json:"embeds"`
+}
+
+// Bluesky extracts and returns the media urls of a bluesky post using the public AppView.
+// Posts without media of their own fall back to the media of the post they quote, or to text.
+// Returns result, user safe error message, and an error if any. Deleted posts return a *RemovedError.
+func Bluesky(ctx context.Context, rawURL, userAgent string) (Result, string, error) {
+	xlog.Debugf(ctx, "Extracting media from Bluesky URL: %s", rawURL)
+
+	// https://bsky.app/profile/<handle or did>/post/<rkey>
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Result{}, "Invalid Bluesky link", fmt.Errorf("invalid Bluesky URL: %w", err)
+	}
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segs) != 4 || segs[0] != "profile" || segs[2] != "post" {
+		return Result{}, "Not a Bluesky post link", fmt.Errorf("not a Bluesky post URL: %s", rawURL)
+	}
+	actor, rkey := segs[1], segs[3]
+
+	// at-uris want a DID, handles have to be resolved first
+	did := actor
+	if !strings.HasPrefix(actor, "did:") {
+		var out struct {
+			DID string `json:"did"`
+		}
+		if errMsg, err := blueskyXRPC(ctx, "com.atproto.identity.resolveHandle", url.Values{"handle": {actor}}, userAgent, &out); err != nil {
+			return Result{}, errMsg, err
+		}
+		did = out.DID
+	}
+
+	var thread struct {
+		Thread struct {
+			Type string      `json:"$type"`
+			Post blueskyPost `json:"post"`
+		} `json:"thread"`
+	}
+	params := url.Values{
+		"uri":          {"at://" + did + "/app.bsky.feed.post/" + rkey},
+		"depth":        {"0"},
+		"parentHeight": {"0"},
+	}
+	if errMsg, err := blueskyXRPC(ctx, "app.bsky.feed.getPostThread", params, userAgent, &thread); err != nil {
+		return Result{}, errMsg, err
+	}
+	switch thread.Thread.Type {
+	case "app.bsky.feed.defs#threadViewPost":
+	case "app.bsky.feed.defs#notFoundPost":
+		return Result{}, "This post was deleted", &RemovedError{Deleted: true, Reason: "not_found"}
+	case "app.bsky.feed.defs#blockedPost":
+		return Result{}, "This post is blocked", &RemovedError{Reason: "blocked"}
+	default:
+		return Result{}, "Unsupported post type", fmt.Errorf("unsupported thread type: '%s'", thread.Thread.Type)
+	}
+	post := thread.Thread.Post
+
+	result := blueskyResult(post.Embed)
+	result.NSFW = blueskyNSFW(post.Labels)
+	if result.Kind == ResultText {
+		result.Text = fmt.Sprintf("@%s: %s", post.Author.Handle, post.Record.Text)
+	}
+
+	// a quote without media of its own shows the quoted post
+	if quote := blueskyQuoted(post.Embed); quote != nil && result.Kind == ResultText {
+		for _, embed := range quote.Embeds {
+			if r := blueskyResult(embed); r.Kind == ResultMedia {
+				r.NSFW = result.NSFW || blueskyNSFW(quote.Labels)
+				xlog.Debugf(ctx, "Using media of quoted post by %s", quote.Author.Handle)
+				return r, "", nil
+			}
+		}
+		if quote.Type == "app.bsky.embed.record#viewRecord" {
+			result.Text += fmt.Sprintf("\n> @%s: %s", quote.Author.Handle, quote.Value.Text)
+		}
+	}
+	xlog.Debugf(ctx, "Found Bluesky result: %+v", result)
+	return result, "", nil
+}
+
+// blueskyResult converts the media of an embed view, anything else is a text result.
+func blueskyResult(embed *blueskyEmbed) Result {
+	if embed == nil {
+		return Result{Kind: ResultText}
+	}
+	switch embed.Type {
+	case "app.bsky.embed.images#view":
+		result := Result{Kind: ResultMedia}
+		for _, img := range embed.Images {
+			// cdn urls end in <cid>@<format> instead of an extension
+			_, ext, _ := strings.Cut(img.Fullsize[strings.LastIndex(img.Fullsize, "/")+1:], "@")
+			result.Media = append(result.Media, Media{URL: img.Fullsize, Ext: ext})
+		}
+		if len(result.Media) > 0 {
+			return result
+		}
+	case "app.bsky.embed.video#view":
+		if embed.Playlist != "" {
+			return Result{Kind: ResultMedia, Media: []Media{{URL: embed.Playlist}}}
+		}
+	case "app.bsky.embed.external#view":
+		if embed.External != nil && embed.External.URI != "" {
+			return Result{Kind: ResultLink, Link: embed.External.URI}
+		}
+	case "app.bsky.embed.recordWithMedia#view":
+		return blueskyResult(embed.Media)
+	}
+	return Result{Kind: ResultText}
+}
+
+// blueskyQuoted returns the post quoted by an embed, or nil if it doesn't quote one.
+func blueskyQuoted(embed *blueskyEmbed) *blueskyQuote {
+	if embed == nil || len(embed.Record) == 0 {
+		return nil
+	}
+	raw := embed.Record
+	if embed.Type == "app.bsky.embed.recordWithMedia#view" {
+		// {"record": {"record": viewRecord}}
+		var inner struct {
+			Record json.RawMessage `json:"record"`
+		}
+		if err := json.Unmarshal(raw, &inner); err != nil {
+			return nil
+		}
+		raw = inner.Record
+	} else if embed.Type != "app.bsky.embed.record#view" {
+		return nil
+	}
+	var quote blueskyQuote
+	if err := json.Unmarshal(raw, &quote); err != nil {
+		return nil
+	}
+	return &quote
+}
+
+func blueskyNSFW(labels []blueskyLabel) bool {
+	return slices.ContainsFunc(labels, func(l blueskyLabel) bool {
+		return slices.Contains(blueskyNSFWLabels, l.Val)
+	})
+}
+
+// blueskyXRPC calls a query method of the AppView and decodes the response into out.
+// Returns user safe error message, and an error if any.
+func blueskyXRPC(ctx context.Context, method string, params url.Values, userAgent string, out any) (string, error) {
+	return fetchJSON(ctx, blueskyBaseURL+"/xrpc/"+method+"?"+params.Encode(), userAgent, maxBlueskyJSONLength, "Bluesky", blueskyStatus(method), out)
+}
+
+// blueskyStatus maps the xrpc errors of method, {"error": "NotFound", "message": "..."} with a 400 status.
+func blueskyStatus(method string) statusFunc {
+	return func(code int, body io.Reader) (string, error) {
+		if code != http.StatusBadRequest {
+			return "", nil
+		}
+		var xerr struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(body).Decode(&xerr)
+		if xerr.Error == "NotFound" || strings.Contains(xerr.Message, "not found") {
+			return "This post or account was deleted", &RemovedError{Deleted: true, Reason: "not_found"}
+		}
+		return "Failed to fetch Bluesky post", fmt.Errorf("%s failed: %s: %s", method, xerr.Error, xerr.Message)
+	}
+}
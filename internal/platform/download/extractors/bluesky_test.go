@@ -0,0 +1,143 @@
+package extractors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sprout/internal/platform/download"
+	"strings"
+	"testing"
+)
+
+// blueskyFixtures stubs the XRPC methods used by the extractor. Handles are resolved from a
+// fixed table, threads are served from testdata/bluesky/<rkey>.json.
+func blueskyFixtures(t *testing.T) {
+	t.Helper()
+	handles := map[string]string{"alice.bsky.social": "did:plc:alice"}
+	xrpcError := func(w http.ResponseWriter, name, msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"` + name + `","message":"` + msg + `"}`))
+	}
+	fixtureServer(t, &blueskyBaseURL, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/xrpc/com.atproto.identity.resolveHandle":
+			did, ok := handles[q.Get("handle")]
+			if !ok {
+				xrpcError(w, "InvalidRequest", "Unable to resolve handle")
+				return
+			}
+			w.Write([]byte(`{"did":"` + did + `"}`))
+		case "/xrpc/app.bsky.feed.getPostThread":
+			uri := q.Get("uri")
+			if !strings.HasPrefix(uri, "at://did:plc:alice/app.bsky.feed.post/") {
+				t.Errorf("Unexpected post uri: %s", uri)
+			}
+			rkey := uri[strings.LastIndex(uri, "/")+1:]
+			if rkey == "ratelimited" {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			if !serveFixture(w, "bluesky", rkey) {
+				xrpcError(w, "NotFound", "Post not found: "+uri)
+			}
+		default:
+			t.Errorf("Unexpected request path: %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func blueskyURL(rkey string) string {
+	return "https://bsky.app/profile/alice.bsky.social/post/" + rkey
+}
+
+func TestBluesky(t *testing.T) {
+	blueskyFixtures(t)
+
+	tests := []struct {
+		name string
+		url  string
+		want Result
+	}{
+		{"images", blueskyURL("images"), Result{
+			Kind: ResultMedia,
+			Media: []Media{
+				{URL: "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:alice/bafkimg1@jpeg", Ext: "jpeg"},
+				{URL: "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:alice/bafkimg2@png", Ext: "png"},
+			},
+			NSFW: true,
+		}},
+		{"did in url", "https://bsky.app/profile/did:plc:alice/post/video", media("https://video.bsky.app/watch/did%3Aplc%3Aalice/bafkvid/playlist.m3u8")},
+		{"quoted media", blueskyURL("quote"), Result{
+			Kind:  ResultMedia,
+			Media: []Media{{URL: "https://video.bsky.app/watch/did%3Aplc%3Abob/bafkbobvid/playlist.m3u8"}},
+			NSFW:  true,
+		}},
+		{"quoted text", blueskyURL("quotetext"), Result{Kind: ResultText, Text: "@alice.bsky.social: hard agree\n> @bob.bsky.social: hot take"}},
+		{"quoted post deleted", blueskyURL("quotegone"), Result{Kind: ResultText, Text: "@alice.bsky.social: lol"}},
+		{"record with media", blueskyURL("recordmedia"), Result{
+			Kind:  ResultMedia,
+			Media: []Media{{URL: "https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:alice/bafkimg3@jpeg", Ext: "jpeg"}},
+		}},
+		{"external link", blueskyURL("external"), Result{Kind: ResultLink, Link: "https://www.youtube.com/watch?v=abc"}},
+		{"text", blueskyURL("text"), Result{Kind: ResultText, Text: "@alice.bsky.social: just words"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errMsg, err := Bluesky(context.Background(), tt.url, "test-agent")
+			if err != nil {
+				t.Fatalf("Bluesky failed: %s: %v", errMsg, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBlueskyErrors(t *testing.T) {
+	blueskyFixtures(t)
+
+	tests := []struct {
+		name    string
+		url     string
+		removed bool // expect a *RemovedError
+	}{
+		{"not found post", blueskyURL("notfound"), true},
+		{"missing post", blueskyURL("missing"), true},
+		{"blocked post", blueskyURL("blocked"), true},
+		{"unknown handle", "https://bsky.app/profile/nobody.bsky.social/post/text", false},
+		{"profile link", "https://bsky.app/profile/alice.bsky.social", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errMsg, err := Bluesky(context.Background(), tt.url, "test-agent")
+			if err == nil || errMsg == "" {
+				t.Fatalf("Expected error with message, got %q, %v", errMsg, err)
+			}
+			var removed *RemovedError
+			if errors.As(err, &removed) != tt.removed {
+				t.Errorf("Expected removed=%v, got %v", tt.removed, err)
+			}
+		})
+	}
+
+	if _, _, err := Bluesky(context.Background(), blueskyURL("ratelimited"), "test-agent"); !errors.Is(err, download.ErrTooManyRequests) {
+		t.Errorf("Expected ErrTooManyRequests, got %v", err)
+	}
+}
+
+func TestParseBlueskyMedia(t *testing.T) {
+	// cdn images have no extension, the hinted type must still produce a plan
+	plan, err := download.ParseMediaURLAs("https://cdn.bsky.app/img/feed_fullsize/plain/did:plc:alice/bafkimg1@jpeg", "jpeg")
+	if err != nil || plan.Strategy != download.StrategyDirect || plan.OutputExt != "jpeg" {
+		t.Errorf("Unexpected image plan: %+v, %v", plan, err)
+	}
+	plan, err = download.ParseMediaURL("https://video.bsky.app/watch/did%3Aplc%3Aalice/bafkvid/playlist.m3u8")
+	if err != nil || plan.Strategy != download.StrategyFFmpeg || plan.OutputExt != "mp4" {
+		t.Errorf("Unexpected video plan: %+v, %v", plan, err)
+	}
+}
@@ -0,0 +1,74 @@
+package extractors
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Canonicalizer is implemented by extractors that can rewrite their links into one form per
+// piece of media, e.g. youtu.be/x and youtube.com/watch?v=x&t=3 into youtube.com/watch?v=x.
+type Canonicalizer interface {
+	// Canonicalize rewrites a link matched by the extractor in place. Scheme and host are
+	// already lowercase, the fragment and tracking params are already gone.
+	Canonicalize(u *url.URL)
+}
+
+// Resolver is implemented by extractors with short links that need a request to resolve,
+// e.g. reddit's /s/ share links.
+type Resolver interface {
+	// Resolve returns the link a short link points to, or rawURL if it isn't one or can't be resolved.
+	Resolve(ctx context.Context, rawURL, userAgent string) string
+}
+
+// trackingParams are query params that never change what a link points to.
+var trackingParams = []string{"fbclid", "gclid", "dclid", "msclkid", "igshid", "mc_cid", "mc_eid", "ref_src", "ref_url"}
+
+// Canonical returns the canonical form of a link, assets are keyed by it so one piece of media
+// maps to one asset however it was linked. Links no extractor matches only lose their fragment
+// and tracking params. Invalid links are returned as is.
+func Canonical(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "https" && u.Port() == "443") || (u.Scheme == "http" && u.Port() == "80") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment, u.RawFragment = "", ""
+	if u.RawQuery != "" {
+		q := u.Query()
+		removed := false
+		for key := range q {
+			if strings.HasPrefix(key, "utm_") || slices.Contains(trackingParams, key) {
+				q.Del(key)
+				removed = true
+			}
+		}
+		// untouched queries keep their encoding, some sites sign them
+		if removed {
+			u.RawQuery = q.Encode()
+		}
+	}
+	if c, ok := Find(u.String()).(Canonicalizer); ok {
+		c.Canonicalize(u)
+	}
+	return u.String()
+}
+
+// Resolve resolves a short link of ex and returns the canonical form of the result.
+func Resolve(ctx context.Context, ex Extractor, rawURL, userAgent string) string {
+	if r, ok := ex.(Resolver); ok {
+		rawURL = r.Resolve(ctx, rawURL, userAgent)
+	}
+	return Canonical(rawURL)
+}
+
+// setHost replaces the host of a link and drops its query, the common canonical form.
+func setHost(u *url.URL, host string) {
+	u.Host = host
+	u.RawQuery, u.ForceQuery = "", false
+}
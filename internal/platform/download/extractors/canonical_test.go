@@ -0,0 +1,45 @@
+package extractors
+
+import "testing"
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://youtu.be/abc?t=3&si=share", "https://www.youtube.com/watch?v=abc"},
+		{"https://youtube.com/watch?v=abc&t=3", "https://www.youtube.com/watch?v=abc"},
+		{"https://www.youtube.com/watch?feature=shared&v=abc", "https://www.youtube.com/watch?v=abc"},
+		{"https://www.youtube.com/shorts/abc?si=share", "https://www.youtube.com/shorts/abc"},
+		{"https://www.youtube.com/playlist?list=PL1&si=share", "https://www.youtube.com/playlist?list=PL1"},
+		{"https://old.reddit.com/r/Pics/comments/abc/some_title/?utm_source=share", "https://www.reddit.com/r/pics/comments/abc/"},
+		{"https://www.reddit.com/r/pics/comments/abc/some_title/def/?context=3", "https://www.reddit.com/r/pics/comments/abc/"},
+		{"https://reddit.com/comments/abc", "https://www.reddit.com/comments/abc/"},
+		{"https://www.reddit.com/r/pics/s/AbC123", "https://www.reddit.com/r/pics/s/AbC123"},
+		{"https://i.redd.it/abc.jpg?utm_medium=x", "https://i.redd.it/abc.jpg"},
+		{"https://www.RedGifs.com/watch/SomeGif?utm_source=x", "https://www.redgifs.com/watch/somegif"},
+		{"https://imgur.com/gallery/funny-cats-Gal0001", "https://imgur.com/gallery/Gal0001"},
+		{"https://imgur.com/t/funny/Gal0001", "https://imgur.com/gallery/Gal0001"},
+		{"https://m.imgur.com/a/some-cats-Alb0001?ref=x", "https://imgur.com/a/Alb0001"},
+		{"https://i.imgur.com/Gif0001.gifv", "https://i.imgur.com/Gif0001.gifv"},
+		{"https://www.bsky.app/profile/alice.bsky.social/post/abc/", "https://bsky.app/profile/alice.bsky.social/post/abc"},
+		{"https://fxtwitter.com/Alice/status/1/photo/1?s=20", "https://x.com/alice/status/1"},
+		{"https://mobile.twitter.com/alice/status/1", "https://x.com/alice/status/1"},
+		// no extractor, only tracking is dropped
+		{"https://Example.com:443/a?utm_source=x&id=1#frag", "https://example.com/a?id=1"},
+		{"https://example.com/a?b=2&a=%7e", "https://example.com/a?b=2&a=%7e"},
+		{"not a url", "not a url"},
+	}
+	for _, tt := range tests {
+		got := Canonical(tt.url)
+		if got != tt.want {
+			t.Errorf("Canonical(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+		if again := Canonical(got); again != got {
+			t.Errorf("Canonical is not idempotent for %q: %q", got, again)
+		}
+		if ex := Find(tt.url); ex != nil && Find(got) != ex {
+			t.Errorf("Canonical form of %q is not matched by %s: %q", tt.url, ex.Info().ID, got)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Package extractors resolves links to supported sites into downloadable media.
+//
+// Each site is an Extractor registered with Register. Registering one enables anti-rot
+// mirroring for its links, auto expand and the matching settings toggles, and picks the
+// emoji of the button linking back to the source.
+package extractors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Extractor resolves the links of one site.
+type Extractor interface {
+	Info() Info
+	// Match reports whether the link belongs to this extractor.
+	Match(rawURL string) bool
+	// Extract resolves the link into a result.
+	// Returns result, user safe error message, and an error if any. Links to content that
+	// is gone return a *RemovedError.
+	Extract(ctx context.Context, rawURL, userAgent string) (Result, string, error)
+}
+
+// LinkEmoji is implemented by extractors whose emoji depends on the link.
+type LinkEmoji interface {
+	// EmojiFor returns the app emoji name prefix of the link.
+	EmojiFor(rawURL string) string
+}
+
+// Prober is implemented by extractors that can't tell from Extract alone whether the source of a
+// link is still there, e.g. because direct media links are resolved without reaching the site.
+type Prober interface {
+	// Probe returns nil if the source of the link is still there, a *RemovedError if it's gone
+	// and ErrNotProbed if it can't tell.
+	Probe(ctx context.Context, rawURL, userAgent string) error
+}
+
+// ErrNotProbed is returned by probes that can't tell whether a source is still there.
+var ErrNotProbed = errors.New("source can't be checked")
+
+// Probe checks whether the source of a link resolved by ex is still there, see Prober. The
+// links of extractors without a probe are extracted, which fails once their source is gone.
+func Probe(ctx context.Context, ex Extractor, rawURL, userAgent string) error {
+	if p, ok := ex.(Prober); ok {
+		return p.Probe(ctx, rawURL, userAgent)
+	}
+	_, _, err := ex.Extract(ctx, rawURL, userAgent)
+	return err
+}
+
+// QueueHost is implemented by extractors that queue the links of each host separately, so a host
+// with a long interval doesn't hold up the others. The host queues share the extractor's policy.
+type QueueHost interface {
+	// QueueHost returns the host of the link and the minimum interval between its links, which
+	// raises the interval of the policy. ok is false for links of no particular host.
+	QueueHost(rawURL string) (host string, interval time.Duration, ok bool)
+}
+
+// Emoji returns the app emoji name prefix of a link resolved by ex.
+func Emoji(ex Extractor, rawURL string) string {
+	if le, ok := ex.(LinkEmoji); ok {
+		return le.EmojiFor(rawURL)
+	}
+	return ex.Info().Emoji
+}
+
+// Info is the display metadata and queue policy of an extractor.
+type Info struct {
+	ID         string // settings key, e.g. "reddit"
+	Name       string // shown in settings and to the AI chat
+	Emoji      string // app emoji name prefix used for the source link button
+	AutoExpand bool   // link only messages may be replaced with the media
+	Queue      QueuePolicy
+}
+
+// QueuePolicy describes the rate limited queue extraction and downloads of an extractor run in.
+// Extractors hitting the same site share a queue by using the same name.
+type QueuePolicy struct {
+	Name     string
+	Interval time.Duration // minimum time between jobs
+	Jitter   time.Duration // extra random delay added to each interval
+	Backoff  time.Duration // initial backoff after a failed job
+}
+
+// defaultQueue is the policy used by the built-in extractors.
+func defaultQueue(name string) QueuePolicy {
+	return QueuePolicy{Name: name, Interval: 5 * time.Second, Jitter: 2 * time.Second, Backoff: 30 * time.Second}
+}
+
+// ResultKind is what a link resolved to.
+type ResultKind int
+
+const (
+	ResultText  ResultKind = iota // nothing to mirror, maybe some text
+	ResultMedia                   // one or more media files
+	ResultLink                    // an external link, mirrored by its own extractor if one matches
+)
+
+// Result is the resolved content of a link.
+type Result struct {
+	Kind    ResultKind
+	Media   []Media // ResultMedia, more than one item is stored as a gallery
+	Link    string  // ResultLink
+	Text    string  // ResultText, what the post says if there's anything worth showing
+	NSFW    bool
+	Seconds int // length of the media if known, long media waits for admin confirmation
+}
+
+// Media is a single downloadable media file.
+type Media struct {
+	URL   string
+	Ext   string // file type if the URL doesn't show it
+	YtDLP bool   // download with yt-dlp instead of download.DownloadMedia
+}
+
+// RemovedError is returned for content that was removed by moderators or deleted by its author.
+type RemovedError struct {
+	Deleted bool   // deleted by the author, removed otherwise
+	Reason  string // site specific, e.g. "moderator", "deleted", "copyright_takedown"
+}
+
+func (e *RemovedError) Error() string {
+	if e.Deleted {
+		return "post was deleted"
+	}
+	return fmt.Sprintf("post was removed (%s)", e.Reason)
+}
+
+var registry []Extractor
+
+// Register adds an extractor. Matchers of different extractors must not overlap.
+// Should only be called from init functions.
+func Register(ex Extractor) {
+	id := ex.Info().ID
+	for _, other := range registry {
+		if other.Info().ID == id {
+			panic("duplicate extractor: " + id)
+		}
+	}
+	registry = append(registry, ex)
+}
+
+// All returns the registered extractors in registration order.
+func All() []Extractor {
+	return registry
+}
+
+// Queues returns the default policies of the extractor queues, one per queue name in registration order.
+func Queues() []QueuePolicy {
+	var policies []QueuePolicy
+	seen := make(map[string]bool)
+	for _, ex := range registry {
+		if p := ex.Info().Queue; !seen[p.Name] {
+			seen[p.Name] = true
+			policies = append(policies, p)
+		}
+	}
+	return policies
+}
+
+// Find returns the extractor matching the link, or nil if none does.
+func Find(rawURL string) Extractor {
+	for _, ex := range registry {
+		if ex.Match(rawURL) {
+			return ex
+		}
+	}
+	return nil
+}
+
+// Get returns the extractor with the given ID, or nil if there is none.
+func Get(id string) Extractor {
+	for _, ex := range registry {
+		if ex.Info().ID == id {
+			return ex
+		}
+	}
+	return nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package extractors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/download"
+	"testing"
+)
+
+// fixtureServer stands in for the API at *baseURL for the rest of the test, every request
+// must carry the test user agent.
+func fixtureServer(t *testing.T, baseURL *string, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "test-agent" {
+			t.Errorf("Request without user agent: %s", r.URL)
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	old := *baseURL
+	*baseURL = srv.URL
+	t.Cleanup(func() { *baseURL = old })
+}
+
+// serveFixture writes testdata/<site>/<name>.json, returns false if there's no such fixture.
+func serveFixture(w http.ResponseWriter, site, name string) bool {
+	data, err := os.ReadFile(filepath.Join("testdata", site, name+".json"))
+	if err != nil {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+	return true
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		url string
+		id  string // "" if no extractor should match
+	}{
+		{"https://www.reddit.com/r/pics/comments/abc/title/", "reddit"},
+		{"https://old.reddit.com/r/pics/comments/abc/title/", "reddit"},
+		{"https://i.redd.it/abc.jpg", "reddit"},
+		{"https://www.youtube.com/watch?v=abc", "youTube"},
+		{"https://youtu.be/abc", "youTube"},
+		{"https://www.youtube.com/shorts/abc", "youTubeShorts"},
+		{"https://youtube.com/shorts/abc", "youTubeShorts"},
+		{"https://www.redgifs.com/watch/abc", "redGifs"},
+		{"https://imgur.com/a/abc", "imgur"},
+		{"https://i.imgur.com/abc.gifv", "imgur"},
+		{"https://bsky.app/profile/alice.bsky.social/post/abc", "bluesky"},
+		{"https://bsky.app/profile/alice.bsky.social", ""},
+		{"https://x.com/someone/status/1", "xitter"},
+		{"https://mobile.twitter.com/someone/status/1", "xitter"},
+		{"https://x.com/someone", ""},
+		{"https://example.com/video.mp4", ""},
+	}
+	for _, tt := range tests {
+		// matchers must not overlap, registration order would decide otherwise
+		var matched []string
+		for _, ex := range All() {
+			if ex.Match(tt.url) {
+				matched = append(matched, ex.Info().ID)
+			}
+		}
+		if len(matched) > 1 {
+			t.Errorf("%s matched several extractors: %v", tt.url, matched)
+		}
+
+		ex := Find(tt.url)
+		switch {
+		case tt.id == "" && ex != nil:
+			t.Errorf("%s: expected no extractor, got %s", tt.url, ex.Info().ID)
+		case tt.id != "" && ex == nil:
+			t.Errorf("%s: expected %s, got none", tt.url, tt.id)
+		case tt.id != "" && ex.Info().ID != tt.id:
+			t.Errorf("%s: expected %s, got %s", tt.url, tt.id, ex.Info().ID)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	for _, ex := range All() {
+		info := ex.Info()
+		if Get(info.ID) != ex {
+			t.Errorf("Get(%q) did not return its extractor", info.ID)
+		}
+		if info.Name == "" || info.Emoji == "" || info.Queue.Name == "" {
+			t.Errorf("Extractor %q is missing display metadata or a queue: %+v", info.ID, info)
+		}
+	}
+	if Get("unknown") != nil {
+		t.Error("Expected nil for unknown extractor")
+	}
+}
+
+func TestQueues(t *testing.T) {
+	names := make(map[string]bool)
+	for _, p := range Queues() {
+		if names[p.Name] {
+			t.Errorf("Queue %q listed twice", p.Name)
+		}
+		names[p.Name] = true
+	}
+	for _, ex := range All() {
+		if !names[ex.Info().Queue.Name] {
+			t.Errorf("Queue %q of %q is not listed", ex.Info().Queue.Name, ex.Info().ID)
+		}
+	}
+}
+
+func TestProbeMedia(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("Probe sent %s, want HEAD", r.Method)
+		}
+		switch r.URL.Path {
+		case "/alive.jpg", "/removed.png":
+		case "/moved.jpg":
+			http.Redirect(w, r, "/removed.png", http.StatusFound)
+		case "/gone.jpg":
+			w.WriteHeader(http.StatusNotFound)
+		case "/limited.jpg":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/forbidden.jpg":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	if u, err := probeMedia(ctx, srv.URL+"/alive.jpg", "test-agent"); err != nil || u.Path != "/alive.jpg" {
+		t.Errorf("Expected alive media, got %v, %v", u, err)
+	}
+	if u, err := probeMedia(ctx, srv.URL+"/moved.jpg", "test-agent"); err != nil || u.Path != "/removed.png" {
+		t.Errorf("Expected the redirect to be followed, got %v, %v", u, err)
+	}
+	var removed *RemovedError
+	if _, err := probeMedia(ctx, srv.URL+"/gone.jpg", "test-agent"); !errors.As(err, &removed) {
+		t.Errorf("Expected removed media, got %v", err)
+	}
+	if _, err := probeMedia(ctx, srv.URL+"/limited.jpg", "test-agent"); !errors.Is(err, download.ErrTooManyRequests) {
+		t.Errorf("Expected rate limit, got %v", err)
+	}
+	if _, err := probeMedia(ctx, srv.URL+"/forbidden.jpg", "test-agent"); !errors.Is(err, ErrNotProbed) {
+		t.Errorf("Expected an unchecked source, got %v", err)
+	}
+	if _, err := probeMedia(ctx, srv.URL+"/down.jpg", "test-agent"); err == nil || errors.Is(err, ErrNotProbed) || errors.As(err, &removed) {
+		t.Errorf("Expected a transient failure, got %v", err)
+	}
+}
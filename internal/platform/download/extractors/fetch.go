@@ -0,0 +1,93 @@
+package extractors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sprout/internal/platform/download"
+	"time"
+)
+
+// fetchTimeout bounds a call to the API of a site.
+const fetchTimeout = 10 * time.Second
+
+// statusFunc maps an error status of a site's API to a user safe message and an error, body
+// is the limited response body. A nil error leaves the status to fetchJSON.
+type statusFunc func(code int, body io.Reader) (string, error)
+
+// fetchJSON gets rawURL and decodes at most limit bytes of the JSON response into out. site
+// names the API in messages, e.g. "Reddit". Rate limits return download.ErrTooManyRequests and
+// not found a *RemovedError, status (optional) maps error statuses first.
+// Returns a user safe error message and an error if any.
+func fetchJSON(ctx context.Context, rawURL, userAgent string, limit int64, site string, status statusFunc, out any) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "Failed to fetch " + site + " post", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+	resp, err := download.Client.Do(req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "Timed out fetching " + site + " post", fmt.Errorf("timed out fetching %s post after %s", site, fetchTimeout)
+		}
+		return "Failed to fetch " + site + " post", fmt.Errorf("failed to fetch %s post: %w", site, err)
+	}
+	defer resp.Body.Close()
+	body := io.LimitReader(resp.Body, limit)
+
+	if resp.StatusCode != http.StatusOK && status != nil {
+		if msg, err := status(resp.StatusCode, body); err != nil {
+			return msg, err
+		}
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return site + " is rate limiting us, try again later", download.ErrTooManyRequests
+	case resp.StatusCode == http.StatusNotFound:
+		return "This post was removed or deleted", &RemovedError{Reason: "not_found"}
+	case resp.StatusCode != http.StatusOK:
+		return "Failed to fetch " + site + " post", fmt.Errorf("failed to fetch %s post: %s", site, resp.Status)
+	}
+
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		return "Failed to read " + site + " post", fmt.Errorf("failed to decode %s post: %w", site, err)
+	}
+	return "", nil
+}
+
+// probeMedia checks that a direct media link still answers, without downloading it. Returns the
+// URL it ended up at after redirects, a *RemovedError if it's gone and ErrNotProbed if the
+// answer doesn't tell, e.g. when the site refuses to answer bots.
+func probeMedia(ctx context.Context, rawURL, userAgent string) (*url.URL, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := download.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe %s: %w", rawURL, err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, download.ErrTooManyRequests
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusGone:
+		return nil, &RemovedError{Reason: "not_found"}
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("failed to probe %s: %s", rawURL, resp.Status)
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("%w: %s answered %s", ErrNotProbed, rawURL, resp.Status)
+	}
+	return resp.Request.URL, nil
+}
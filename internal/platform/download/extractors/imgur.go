@@ -0,0 +1,181 @@
+package extractors
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func init() {
+	Register(imgur{})
+}
+
+const (
+	maxImgurJSONLength = 4 << 20
+	// imgurClientID is the public client ID of the imgur.com web app, the post API rejects
+	// requests without one.
+	imgurClientID = "546c25a59c58ad7"
+)
+
+// imgurBaseURL is where post metadata is fetched from. Overridden by tests.
+var imgurBaseURL = "https://api.imgur.com"
+
+type imgur struct{}
+
+func (imgur) Info() Info {
+	return Info{ID: "imgur", Name: "Imgur", Emoji: "imgur", AutoExpand: true, Queue: defaultQueue("imgur")}
+}
+
+func (imgur) Match(rawURL string) bool {
+	return hasAnyPrefix(rawURL, []string{
+		"https://imgur.com/",
+		"https://www.imgur.com/",
+		"https://m.imgur.com/",
+		"https://i.imgur.com/"})
+}
+
+func (imgur) Extract(ctx context.Context, rawURL, userAgent string) (Result, string, error) {
+	return Imgur(ctx, rawURL, userAgent)
+}
+
+// Probe checks direct links, which Extract resolves without asking Imgur, on i.imgur.com.
+// Removed images redirect to a placeholder.
+func (imgur) Probe(ctx context.Context, rawURL, userAgent string) error {
+	result, _, err := Imgur(ctx, rawURL, userAgent)
+	if err != nil || !imgurDirect(rawURL) {
+		return err
+	}
+	final, err := probeMedia(ctx, result.Media[0].URL, userAgent)
+	if err != nil {
+		return err
+	}
+	if final.Path == "/removed.png" {
+		return &RemovedError{Reason: "removed"}
+	}
+	return nil
+}
+
+// imgurDirect reports whether the link is one Imgur resolves to a file without the post API,
+// e.g. i.imgur.com/<id>.png or imgur.com/<id>.gifv.
+func imgurDirect(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	path := strings.Trim(u.Path, "/")
+	return strings.EqualFold(u.Host, "i.imgur.com") || (!strings.Contains(path, "/") && strings.Contains(path, "."))
+}
+
+// Canonicalize drops title slugs and maps tag links to the gallery post they show.
+func (imgur) Canonicalize(u *url.URL) {
+	if u.Host == "i.imgur.com" {
+		u.RawQuery = ""
+		return
+	}
+	setHost(u, "imgur.com")
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case len(segs) == 2 && (segs[0] == "a" || segs[0] == "gallery"):
+		u.Path = "/" + segs[0] + "/" + imgurID(segs[1])
+	case len(segs) == 3 && segs[0] == "t":
+		u.Path = "/gallery/" + imgurID(segs[2])
+	}
+	u.RawPath = ""
+}
+
+// imgurPost is the subset of a post from the post API we use.
+type imgurPost struct {
+	IsMature bool `json:"is_mature"`
+	Media    []struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+		Ext string `json:"ext"`
+	} `json:"media"`
+}
+
+// Imgur extracts and returns the media urls of imgur images, gifv and albums.
+// Returns result, user safe error message, and an error if any. Removed posts return a *RemovedError.
+func Imgur(ctx context.Context, rawURL, userAgent string) (Result, string, error) {
+	xlog.Debugf(ctx, "Extracting media from Imgur URL: %s", rawURL)
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Result{}, "Invalid Imgur link", fmt.Errorf("invalid Imgur URL: %w", err)
+	}
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segs) == 0 || segs[0] == "" {
+		return Result{}, "Not an Imgur post link", fmt.Errorf("not an Imgur post URL: %s", rawURL)
+	}
+
+	// direct links need no extraction, gifv is an html player around an mp4
+	if strings.EqualFold(u.Host, "i.imgur.com") {
+		return Result{Kind: ResultMedia, Media: []Media{{URL: imgurDirectURL(segs[len(segs)-1])}}}, "", nil
+	}
+
+	var endpoint string
+	switch {
+	case len(segs) == 2 && segs[0] == "a":
+		endpoint = "/post/v1/albums/" + imgurID(segs[1])
+	case len(segs) == 2 && segs[0] == "gallery", len(segs) == 3 && segs[0] == "t":
+		// gallery posts can be an album or a single image
+		endpoint = "/post/v1/posts/" + imgurID(segs[len(segs)-1])
+	case len(segs) == 1:
+		// imgur.com/<id> and imgur.com/<id>.gifv
+		if id, ext, ok := strings.Cut(segs[0], "."); ok {
+			return Result{Kind: ResultMedia, Media: []Media{{URL: imgurDirectURL(id + "." + ext)}}}, "", nil
+		}
+		endpoint = "/post/v1/media/" + segs[0]
+	default:
+		return Result{}, "Unsupported Imgur link", fmt.Errorf("unsupported Imgur URL: %s", rawURL)
+	}
+
+	post, errMsg, err := fetchImgurPost(ctx, endpoint, userAgent)
+	if err != nil {
+		return Result{}, errMsg, err
+	}
+
+	output := Result{Kind: ResultMedia, NSFW: post.IsMature}
+	for _, m := range post.Media {
+		src := m.URL
+		if src == "" && m.ID != "" && m.Ext != "" {
+			src = "https://i.imgur.com/" + m.ID + "." + m.Ext
+		}
+		if src == "" {
+			continue
+		}
+		src = imgurDirectURL(src[strings.LastIndex(src, "/")+1:])
+		xlog.Debugf(ctx, "Found Imgur media: %s", src)
+		output.Media = append(output.Media, Media{URL: src})
+	}
+	if len(output.Media) == 0 {
+		return Result{}, "This post has no media", &RemovedError{Reason: "empty"}
+	}
+	return output, "", nil
+}
+
+// fetchImgurPost fetches a post from the post API.
+// Returns post, user safe error message, and an error if any.
+func fetchImgurPost(ctx context.Context, endpoint, userAgent string) (*imgurPost, string, error) {
+	var post imgurPost
+	if errMsg, err := fetchJSON(ctx, imgurBaseURL+endpoint+"?client_id="+imgurClientID+"&include=media", userAgent, maxImgurJSONLength, "Imgur", nil, &post); err != nil {
+		return nil, errMsg, err
+	}
+	return &post, "", nil
+}
+
+// imgurID returns the ID of a post path segment, newer links prefix it with a title slug,
+// e.g. "funny-cat-pictures-AbC12de".
+func imgurID(seg string) string {
+	return seg[strings.LastIndex(seg, "-")+1:]
+}
+
+// imgurDirectURL returns the i.imgur.com url of a file name, gifv is swapped for the mp4 it plays.
+func imgurDirectURL(name string) string {
+	if id, ok := strings.CutSuffix(name, ".gifv"); ok {
+		name = id + ".mp4"
+	}
+	return "https://i.imgur.com/" + name
+}
@@ -0,0 +1,111 @@
+package extractors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sprout/internal/platform/download"
+	"strings"
+	"testing"
+)
+
+// imgurFixtures serves testdata/imgur/<id>.json for /post/v1/<kind>/<id> requests and records
+// the requested paths. Ids with no fixture are answered like Imgur answers unknown posts.
+func imgurFixtures(t *testing.T) *[]string {
+	t.Helper()
+	var requested []string
+	fixtureServer(t, &imgurBaseURL, func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if r.URL.Query().Get("client_id") == "" || r.URL.Query().Get("include") != "media" {
+			t.Errorf("Request without client_id or media: %s", r.URL)
+		}
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 4 || parts[0] != "post" || parts[1] != "v1" {
+			t.Errorf("Unexpected request path: %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		if parts[3] == "ratelimited" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if !serveFixture(w, "imgur", parts[3]) {
+			http.NotFound(w, r)
+		}
+	})
+	return &requested
+}
+
+func TestImgur(t *testing.T) {
+	requested := imgurFixtures(t)
+
+	tests := []struct {
+		name string
+		url  string
+		path string // API path requested, "" if none
+		want Result
+	}{
+		{"direct image", "https://i.imgur.com/Img0001.png", "", media("https://i.imgur.com/Img0001.png")},
+		{"direct gifv", "https://i.imgur.com/Gif0001.gifv", "", media("https://i.imgur.com/Gif0001.mp4")},
+		{"page gifv", "https://imgur.com/Gif0001.gifv", "", media("https://i.imgur.com/Gif0001.mp4")},
+		{"single image", "https://imgur.com/Img0001", "/post/v1/media/Img0001", media("https://i.imgur.com/Img0001.png")},
+		{"album", "https://imgur.com/a/Alb0001", "/post/v1/albums/Alb0001", Result{
+			Kind: ResultMedia,
+			Media: []Media{
+				{URL: "https://i.imgur.com/Cat0001.jpeg"},
+				{URL: "https://i.imgur.com/Cat0002.mp4"},
+				{URL: "https://i.imgur.com/Cat0003.gif"},
+			},
+			NSFW: true,
+		}},
+		{"album with slug", "https://imgur.com/a/some-cats-Alb0001", "/post/v1/albums/Alb0001", Result{
+			Kind: ResultMedia,
+			Media: []Media{
+				{URL: "https://i.imgur.com/Cat0001.jpeg"},
+				{URL: "https://i.imgur.com/Cat0002.mp4"},
+				{URL: "https://i.imgur.com/Cat0003.gif"},
+			},
+			NSFW: true,
+		}},
+		{"gallery gifv", "https://imgur.com/gallery/a-single-gif-Gal0001", "/post/v1/posts/Gal0001", media("https://i.imgur.com/Gif0001.mp4")},
+		{"tag gallery", "https://imgur.com/t/funny/Gal0001", "/post/v1/posts/Gal0001", media("https://i.imgur.com/Gif0001.mp4")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*requested = nil
+			got, errMsg, err := Imgur(context.Background(), tt.url, "test-agent")
+			if err != nil {
+				t.Fatalf("Imgur failed: %s: %v", errMsg, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %#v, got %#v", tt.want, got)
+			}
+			var want []string
+			if tt.path != "" {
+				want = []string{tt.path}
+			}
+			if !reflect.DeepEqual(*requested, want) {
+				t.Errorf("Expected requests %v, got %v", want, *requested)
+			}
+		})
+	}
+}
+
+func TestImgurErrors(t *testing.T) {
+	imgurFixtures(t)
+
+	var removed *RemovedError
+	if _, _, err := Imgur(context.Background(), "https://imgur.com/a/Missing1", "test-agent"); !errors.As(err, &removed) || removed.Reason != "not_found" {
+		t.Errorf("Expected not found RemovedError, got %v", err)
+	}
+	if _, _, err := Imgur(context.Background(), "https://imgur.com/a/Empty01", "test-agent"); !errors.As(err, &removed) {
+		t.Errorf("Expected RemovedError for empty album, got %v", err)
+	}
+	if _, _, err := Imgur(context.Background(), "https://imgur.com/ratelimited", "test-agent"); !errors.Is(err, download.ErrTooManyRequests) {
+		t.Errorf("Expected ErrTooManyRequests, got %v", err)
+	}
+	if _, errMsg, err := Imgur(context.Background(), "https://imgur.com/user/someone/favorites", "test-agent"); err == nil || errMsg == "" {
+		t.Errorf("Expected error for unsupported URL, got %q, %v", errMsg, err)
+	}
+}
@@ -6,177 +6,313 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
 	"sprout/internal/platform/download"
-	"sprout/pkg/xhtml"
 	"strings"
 	"time"
 
 	"github.com/Data-Corruption/stdx/xlog"
-	"golang.org/x/net/html"
 )
 
-// TODO: switch to .json since that is probably better for all parties involved
+func init() {
+	Register(reddit{})
+}
+
+type reddit struct{}
+
+func (reddit) Info() Info {
+	return Info{ID: "reddit", Name: "Reddit", Emoji: "reddit", AutoExpand: true, Queue: defaultQueue("reddit")}
+}
+
+func (reddit) Match(rawURL string) bool {
+	return hasAnyPrefix(rawURL, []string{
+		"https://www.reddit.com/",
+		"https://reddit.com/",
+		"https://v.redd.it/",
+		"https://i.redd.it/",
+		"https://www.redd.it/",
+		"https://np.reddit.com/",
+		"https://amp.reddit.com/",
+		"https://m.reddit.com/",
+		"https://old.reddit.com/",
+		"https://new.reddit.com/"})
+}
+
+func (reddit) Extract(ctx context.Context, rawURL, userAgent string) (Result, string, error) {
+	return Reddit(ctx, rawURL, userAgent)
+}
+
+// Probe checks direct image links, which Extract passes through, on i.redd.it.
+func (reddit) Probe(ctx context.Context, rawURL, userAgent string) error {
+	if strings.HasPrefix(rawURL, "https://i.redd.it/") {
+		_, err := probeMedia(ctx, rawURL, userAgent)
+		return err
+	}
+	_, _, err := Reddit(ctx, rawURL, userAgent)
+	return err
+}
 
-type RedditTextResult struct{}
-type RedditLinkResult struct{ Url string }       // URL of the external link
-type RedditBasicResult struct{ Url string }      // URL of an image or gif file
-type RedditVideoResult struct{ Url string }      // URL of a video file
-type RedditGalleryResult struct{ Urls []string } // URLs of multiple image files
+// Canonicalize unifies the reddit hosts and drops the title slug and comment of post links,
+// e.g. old.reddit.com/r/pics/comments/abc/title/def/?context=3 becomes www.reddit.com/r/pics/comments/abc/.
+func (reddit) Canonicalize(u *url.URL) {
+	switch u.Host {
+	case "i.redd.it", "v.redd.it", "www.redd.it":
+		u.RawQuery = ""
+		return
+	}
+	setHost(u, "www.reddit.com")
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if i := slices.Index(segs, "comments"); i >= 0 && i+1 < len(segs) {
+		u.Path = "/" + strings.ToLower(strings.Join(segs[:i+2], "/")) + "/"
+		u.RawPath = ""
+	}
+}
 
-// Reddit extracts and returns the main media content urls from reddit posts.
-// Includes a chan for status updates to be sent to the user.
-// Returns result, user safe error message, and an error if any.
-func Reddit(ctx context.Context, rawURL, userAgent string) (any, string, error) {
+func (reddit) Resolve(_ context.Context, rawURL, userAgent string) string {
+	return resolveShortRedditUrl(rawURL, userAgent)
+}
+
+const (
+	maxRedditPostHops   = 5       // crossposts and links to other posts followed
+	maxRedditJSONLength = 8 << 20 // posts with many comments can be large
+)
+
+// redditBaseURL is where post listings are fetched from, all reddit hosts serve the same .json.
+// Overridden by tests.
+var redditBaseURL = "https://www.reddit.com"
+
+// redditPost is the subset of a post listing we use.
+type redditPost struct {
+	ID                  string       `json:"id"`
+	Permalink           string       `json:"permalink"`
+	URL                 string       `json:"url"`
+	IsSelf              bool         `json:"is_self"`
+	IsVideo             bool         `json:"is_video"`
+	IsGallery           bool         `json:"is_gallery"`
+	PostHint            string       `json:"post_hint"`
+	Over18              bool         `json:"over_18"`
+	RemovedByCategory   string       `json:"removed_by_category"`
+	CrosspostParentList []redditPost `json:"crosspost_parent_list"`
+	Media               *struct {
+		RedditVideo *redditVideo `json:"reddit_video"`
+	} `json:"media"`
+	SecureMedia *struct {
+		RedditVideo *redditVideo `json:"reddit_video"`
+	} `json:"secure_media"`
+	GalleryData *struct {
+		Items []struct {
+			MediaID string `json:"media_id"`
+		} `json:"items"`
+	} `json:"gallery_data"`
+	MediaMetadata map[string]redditMediaMetadata `json:"media_metadata"`
+}
+
+type redditVideo struct {
+	FallbackURL string `json:"fallback_url"` // mp4 without audio
+	HLSURL      string `json:"hls_url"`      // playlist with audio
+}
+
+type redditMediaMetadata struct {
+	Status string `json:"status"` // "valid", "failed" if the item was removed
+	E      string `json:"e"`      // "Image", "AnimatedImage" or "RedditVideo"
+	M      string `json:"m"`      // mime type, e.g. "image/jpg"
+	S      struct {
+		U   string `json:"u"`
+		GIF string `json:"gif"`
+		MP4 string `json:"mp4"`
+	} `json:"s"`
+	HLSURL string `json:"hlsUrl"`
+}
+
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Kind string     `json:"kind"`
+			Data redditPost `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+// Reddit extracts and returns the main media content urls from reddit posts using the .json listing.
+// Returns result, user safe error message, and an error if any. Removed or deleted posts
+// return a *RemovedError.
+func Reddit(ctx context.Context, rawURL, userAgent string) (Result, string, error) {
 	xlog.Debugf(ctx, "Extracting media from Reddit URL: %s", rawURL)
 
+	// direct image links need no extraction
+	if strings.HasPrefix(rawURL, "https://i.redd.it/") {
+		return Result{Kind: ResultMedia, Media: []Media{{URL: rawURL}}}, "", nil
+	}
+
 	// resolve short URLs
 	url := resolveShortRedditUrl(rawURL, userAgent)
 	if url != rawURL {
 		xlog.Debugf(ctx, "Resolved short Reddit URL: %s -> %s", rawURL, url)
 	}
 
-	doc := &html.Node{}
-	shredditPost := &html.Node{}
-	contentHref, postType := "", ""
+	post, errMsg, err := fetchRedditPost(ctx, url, userAgent)
+	if err != nil {
+		return Result{}, errMsg, err
+	}
 
-	// get post info (loop to handle crossposts)
-	i := 0
-	for {
-		// get page with 10s timeout
-		type fetchResult struct {
-			doc *html.Node
-			err error
+	// follow crossposts, parents are embedded, links to other posts have to be fetched
+	for i := 0; ; i++ {
+		if removed := redditRemoved(post); removed != nil {
+			return Result{}, "This post was removed or deleted", removed
 		}
-		fetchCh := make(chan fetchResult, 1)
-		go func() {
-			d, e := xhtml.Fetch(url)
-			fetchCh <- fetchResult{d, e}
-		}()
-		select {
-		case res := <-fetchCh:
-			if res.err != nil {
-				return nil, "Failed to fetch Reddit page", fmt.Errorf("failed to fetch Reddit page: %w", res.err)
-			}
-			doc = res.doc
-		case <-time.After(10 * time.Second):
-			return nil, "Timed out fetching Reddit page", fmt.Errorf("timed out fetching Reddit page after 10s")
+		var next string
+		if len(post.CrosspostParentList) > 0 {
+			xlog.Debugf(ctx, "Following crosspost to: %s", post.CrosspostParentList[0].Permalink)
+		} else if !post.IsSelf && isRedditPostURL(post.URL) {
+			next = post.URL
+			xlog.Debugf(ctx, "Following linked post to: %s", next)
+		} else {
+			break
 		}
-
-		// get post element
-		shredditPost = xhtml.FindElementByTag(doc, "shreddit-post")
-		if shredditPost == nil {
-			return nil, "No shreddit-post element found", fmt.Errorf("no shreddit-post element found in document")
+		if i >= maxRedditPostHops {
+			return Result{}, "Umm... crosspost chain suspiciously long. Aborting.", fmt.Errorf("crosspost chain too long")
 		}
-
-		// TODO: check if post was removed
-
-		// get attributes
-		contentHref = xhtml.GetAttribute(shredditPost, "content-href")
-		if contentHref == "" {
-			return nil, "No content-href attribute found", fmt.Errorf("no content-href attribute found in shreddit-post element")
-		}
-		postType = xhtml.GetAttribute(shredditPost, "post-type")
-		if postType == "" {
-			return nil, "No post-type attribute found", fmt.Errorf("no post-type attribute found in shreddit-post element")
+		nsfw := post.Over18
+		if next == "" {
+			post = &post.CrosspostParentList[0]
+		} else if post, errMsg, err = fetchRedditPost(ctx, next, userAgent); err != nil {
+			return Result{}, errMsg, err
 		}
+		post.Over18 = post.Over18 || nsfw
+	}
 
-		// handle crossposts
-		if postType == "crosspost" {
-			if i >= 5 {
-				return nil, "Umm... crosspost chain suspiciously long. Aborting.", fmt.Errorf("crosspost chain too long")
-			}
-			url = "https://www.reddit.com" + contentHref
-			xlog.Debugf(ctx, "Following crosspost to: %s", url)
-			i++
-			continue
+	// handle post types
+	switch {
+	case post.IsSelf:
+		xlog.Debugf(ctx, "Found text post: %s", post.Permalink)
+		return Result{Kind: ResultText}, "", nil
+	case post.IsGallery:
+		output := Result{Kind: ResultMedia, NSFW: post.Over18}
+		if post.GalleryData == nil || len(post.GalleryData.Items) == 0 {
+			errMsg := "post is a gallery but has no items"
+			return Result{}, errMsg, errors.New(errMsg)
 		}
-		// handle link based crossposts
-		if postType == "link" {
-			linkDomain := download.ParseDomain(contentHref)
-			if linkDomain == download.DomainReddit {
-				if i >= 5 {
-					return nil, "Umm... crosspost chain suspiciously long. Aborting.", fmt.Errorf("crosspost chain too long")
-				}
-				url = contentHref
-				xlog.Debugf(ctx, "Following crosspost to: %s", url)
-				i++
+		for index, item := range post.GalleryData.Items {
+			meta, ok := post.MediaMetadata[item.MediaID]
+			if !ok || meta.Status != "valid" {
+				xlog.Debugf(ctx, "Skipping unavailable gallery item %d: %s", index, item.MediaID)
 				continue
 			}
-		}
-
-		break
-	}
-
-	// handle post types
-	switch postType {
-	case "text":
-		xlog.Debugf(ctx, "Found text post: %s", contentHref)
-		return RedditTextResult{}, "", nil
-	case "link":
-		xlog.Debugf(ctx, "Found link post: %s", contentHref)
-		return RedditLinkResult{Url: contentHref}, "", nil
-	case "image", "gif":
-		xlog.Debugf(ctx, "Found %s media: %s", postType, contentHref)
-		return RedditBasicResult{Url: contentHref}, "", nil
-	case "video":
-		shredditPlayer := xhtml.FindElementByTag(doc, "shreddit-player")
-		if shredditPlayer == nil {
-			shredditPlayer = xhtml.FindElementByTag(doc, "shreddit-player-2")
-			if shredditPlayer == nil {
-				errMsg := "post type is video but no shreddit-player or shreddit-player-2 element found"
-				return nil, errMsg, errors.New(errMsg)
+			src := galleryItemURL(item.MediaID, meta)
+			if src == "" {
+				errMsg := fmt.Sprintf("could not determine the url of gallery item %d (%s)", index, meta.E)
+				return Result{}, errMsg, errors.New(errMsg)
 			}
+			xlog.Debugf(ctx, "Found gallery media: %s", src)
+			output.Media = append(output.Media, Media{URL: src})
 		}
-		src := xhtml.GetAttribute(shredditPlayer, "src")
-		if src == "" {
-			return nil, "No src attribute found in shreddit-player or shreddit-player-2 element", fmt.Errorf("no src attribute found in shreddit-player or shreddit-player-2 element")
+		if len(output.Media) == 0 {
+			return Result{}, "All gallery items were removed", &RemovedError{Reason: "gallery"}
 		}
-		xlog.Debugf(ctx, "Found video media: %s", src)
-		return RedditVideoResult{Url: src}, "", nil
-	case "gallery":
-		output := RedditGalleryResult{Urls: []string{}}
-
-		carousel := xhtml.FindElementByTag(doc, "gallery-carousel")
-		if carousel == nil {
-			errMsg := "post type is gallery but no gallery-carousel element found"
-			return nil, errMsg, errors.New(errMsg)
+		return output, "", nil
+	case post.IsVideo:
+		video := post.redditVideo()
+		if video == nil {
+			errMsg := "post is a video but has no reddit_video"
+			return Result{}, errMsg, errors.New(errMsg)
 		}
-
-		ul := xhtml.FindElementByTag(carousel, "ul")
-		if ul == nil {
-			errMsg := "post type is gallery but no ul element found in gallery-carousel"
-			return nil, errMsg, errors.New(errMsg)
+		src := video.HLSURL
+		if src == "" {
+			src = video.FallbackURL
 		}
-		lis := xhtml.GetLiElements(ul)
-		if len(lis) == 0 {
-			errMsg := "post type is gallery but no li elements found in ul element of gallery-carousel"
-			return nil, errMsg, errors.New(errMsg)
+		if src == "" {
+			errMsg := "post is a video but has neither an hls_url nor a fallback_url"
+			return Result{}, errMsg, errors.New(errMsg)
 		}
+		xlog.Debugf(ctx, "Found video media: %s", src)
+		return Result{Kind: ResultMedia, Media: []Media{{URL: src}}, NSFW: post.Over18}, "", nil
+	case post.PostHint == "image" || strings.HasPrefix(post.URL, "https://i.redd.it/"):
+		xlog.Debugf(ctx, "Found image media: %s", post.URL)
+		return Result{Kind: ResultMedia, Media: []Media{{URL: post.URL}}, NSFW: post.Over18}, "", nil
+	case post.URL != "":
+		xlog.Debugf(ctx, "Found link post: %s", post.URL)
+		return Result{Kind: ResultLink, Link: post.URL, NSFW: post.Over18}, "", nil
+	default:
+		errMsg := "Unsupported post type"
+		return Result{}, errMsg, fmt.Errorf("unsupported post type: hint '%s'", post.PostHint)
+	}
+}
 
-		xlog.Debugf(ctx, "Found %d items in gallery", len(lis))
-		for index, li := range lis {
-			img := xhtml.FindElementByTag(li, "img")
-			if img == nil {
-				errMsg := fmt.Sprintf("post type is gallery but no img element found in li element %d of ul element of gallery-carousel", index)
-				return nil, errMsg, errors.New(errMsg)
-			}
+// fetchRedditPost fetches the .json listing of a post and returns the post.
+// Returns post, user safe error message, and an error if any.
+func fetchRedditPost(ctx context.Context, postURL, userAgent string) (*redditPost, string, error) {
+	jsonURL, err := redditJSONURL(postURL)
+	if err != nil {
+		return nil, "Not a Reddit post link", err
+	}
 
-			src := xhtml.GetAttribute(img, "src")
-			if src == "" {
-				src = xhtml.GetAttribute(img, "data-lazy-src")
-				if src == "" {
-					errMsg := fmt.Sprintf("could not determine the src of gallery-carousel element [%d]", index)
-					return nil, errMsg, errors.New(errMsg)
-				}
-			}
+	// a post listing is an array of the post and its comments
+	var listings []redditListing
+	if errMsg, err := fetchJSON(ctx, jsonURL, userAgent, maxRedditJSONLength, "Reddit", nil, &listings); err != nil {
+		return nil, errMsg, err
+	}
+	if len(listings) == 0 || len(listings[0].Data.Children) == 0 || listings[0].Data.Children[0].Kind != "t3" {
+		return nil, "No post found", fmt.Errorf("no post found in listing of %s", postURL)
+	}
+	return &listings[0].Data.Children[0].Data, "", nil
+}
 
-			xlog.Debugf(ctx, "Found gallery media: %s", src)
-			output.Urls = append(output.Urls, src)
-		}
+// redditJSONURL turns a post URL from any reddit host into its listing URL on redditBaseURL.
+func redditJSONURL(postURL string) (string, error) {
+	u, err := url.Parse(postURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid Reddit URL: %w", err)
+	}
+	path := strings.TrimSuffix(u.EscapedPath(), "/")
+	if !strings.Contains(path, "/comments/") {
+		return "", fmt.Errorf("not a Reddit post URL: %s", postURL)
+	}
+	return redditBaseURL + strings.TrimSuffix(path, ".json") + ".json?raw_json=1", nil
+}
 
-		return output, "", nil
+// isRedditPostURL reports whether a link post points at another reddit post.
+func isRedditPostURL(rawURL string) bool {
+	return reddit{}.Match(rawURL) && strings.Contains(rawURL, "/comments/")
+}
+
+// redditRemoved returns the reason a post is gone, or nil if it is still up.
+func redditRemoved(post *redditPost) *RemovedError {
+	switch post.RemovedByCategory {
+	case "":
+		return nil
+	case "deleted", "author":
+		return &RemovedError{Deleted: true, Reason: post.RemovedByCategory}
+	default:
+		return &RemovedError{Reason: post.RemovedByCategory}
+	}
+}
+
+func (p *redditPost) redditVideo() *redditVideo {
+	if p.SecureMedia != nil && p.SecureMedia.RedditVideo != nil {
+		return p.SecureMedia.RedditVideo
+	}
+	if p.Media != nil {
+		return p.Media.RedditVideo
+	}
+	return nil
+}
+
+// galleryItemURL returns the original of a gallery item. The source urls in the metadata point
+// at resized previews, the original lives on i.redd.it under the media ID and mime type.
+func galleryItemURL(mediaID string, meta redditMediaMetadata) string {
+	switch meta.E {
+	case "Image", "AnimatedImage":
+		if _, ext, ok := strings.Cut(meta.M, "/"); ok && ext != "" {
+			return "https://i.redd.it/" + mediaID + "." + ext
+		}
+		if meta.S.GIF != "" {
+			return meta.S.GIF
+		}
+		return meta.S.U
+	case "RedditVideo":
+		return meta.HLSURL
 	default:
-		return nil, "Unsupported post type: '%s'", fmt.Errorf("unsupported post type: '%s'", postType)
+		return ""
 	}
 }
 
@@ -187,12 +323,11 @@ func resolveShortRedditUrl(rawURL, userAgent string) string {
 	}
 	req, _ := http.NewRequest("HEAD", rawURL, nil)
 	req.Header.Set("User-Agent", userAgent)
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-		// don't auto-follow; we want the Location header
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	client := *download.Client
+	client.Timeout = 10 * time.Second
+	// don't auto-follow; we want the Location header
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
 	}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -0,0 +1,137 @@
+package extractors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sprout/internal/platform/download"
+	"strings"
+	"testing"
+)
+
+// redditFixtures serves testdata/reddit/<id>.json for /r/<sub>/comments/<id>/<slug>.json requests.
+// Ids with no fixture are answered like Reddit answers unknown posts.
+func redditFixtures(t *testing.T) {
+	t.Helper()
+	fixtureServer(t, &redditBaseURL, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("raw_json") != "1" {
+			t.Errorf("Request without raw_json: %s", r.URL)
+		}
+		parts := strings.Split(strings.TrimSuffix(r.URL.Path, ".json"), "/")
+		if len(parts) < 5 || parts[3] != "comments" || !strings.HasSuffix(r.URL.Path, ".json") {
+			t.Errorf("Unexpected request path: %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		switch parts[4] {
+		case "ratelimited":
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		case "broken":
+			w.Write([]byte("<html>not json</html>"))
+			return
+		}
+		if !serveFixture(w, "reddit", parts[4]) {
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func redditURL(id string) string {
+	return "https://www.reddit.com/r/test/comments/" + id + "/some_title/"
+}
+
+func media(url string) Result {
+	return Result{Kind: ResultMedia, Media: []Media{{URL: url}}}
+}
+
+func TestReddit(t *testing.T) {
+	redditFixtures(t)
+
+	tests := []struct {
+		name string
+		url  string
+		want Result
+	}{
+		{"image", redditURL("image"), media("https://i.redd.it/abc123.jpg")},
+		{"direct image", "https://i.redd.it/abc123.jpg", media("https://i.redd.it/abc123.jpg")},
+		{"old reddit host", "https://old.reddit.com/r/pics/comments/image/sunset/", media("https://i.redd.it/abc123.jpg")},
+		{"gallery", redditURL("gallery"), Result{
+			Kind: ResultMedia,
+			Media: []Media{
+				{URL: "https://i.redd.it/m1.jpg"},
+				{URL: "https://i.redd.it/m2.gif"},
+				{URL: "https://v.redd.it/link/gal001/asset/m4/HLSPlaylist.m3u8"},
+			},
+			NSFW: true,
+		}},
+		{"video prefers hls", redditURL("video"), media("https://v.redd.it/vid001/HLSPlaylist.m3u8?a=1")},
+		{"video falls back", redditURL("gif"), media("https://v.redd.it/gif001/DASH_480.mp4?source=fallback")},
+		{"crosspost keeps nsfw", redditURL("crosspost"), Result{Kind: ResultMedia, Media: []Media{{URL: "https://v.redd.it/vid001/HLSPlaylist.m3u8?a=1"}}, NSFW: true}},
+		{"linked post", redditURL("linked"), media("https://i.redd.it/abc123.jpg")},
+		{"external link", redditURL("redgifs"), Result{Kind: ResultLink, Link: "https://www.redgifs.com/watch/someclip", NSFW: true}},
+		{"text", redditURL("text"), Result{Kind: ResultText}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errMsg, err := Reddit(context.Background(), tt.url, "test-agent")
+			if err != nil {
+				t.Fatalf("Reddit failed: %s: %v", errMsg, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRedditRemoved(t *testing.T) {
+	redditFixtures(t)
+
+	tests := []struct {
+		name    string
+		id      string
+		deleted bool
+		reason  string
+	}{
+		{"removed", "removed", false, "moderator"},
+		{"deleted", "deleted", true, "deleted"},
+		{"crosspost parent removed", "crosspost_removed", false, "moderator"},
+		{"not found", "missing", false, "not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errMsg, err := Reddit(context.Background(), redditURL(tt.id), "test-agent")
+			var removed *RemovedError
+			if !errors.As(err, &removed) {
+				t.Fatalf("Expected RemovedError, got %v", err)
+			}
+			if removed.Deleted != tt.deleted || removed.Reason != tt.reason {
+				t.Errorf("Expected deleted=%v reason=%q, got deleted=%v reason=%q", tt.deleted, tt.reason, removed.Deleted, removed.Reason)
+			}
+			if errMsg == "" {
+				t.Error("Expected a user safe error message")
+			}
+		})
+	}
+}
+
+func TestRedditErrors(t *testing.T) {
+	redditFixtures(t)
+
+	_, _, err := Reddit(context.Background(), redditURL("ratelimited"), "test-agent")
+	if !errors.Is(err, download.ErrTooManyRequests) {
+		t.Errorf("Expected ErrTooManyRequests, got %v", err)
+	}
+
+	_, errMsg, err := Reddit(context.Background(), redditURL("broken"), "test-agent")
+	if err == nil || errMsg == "" {
+		t.Errorf("Expected decode error, got %q, %v", errMsg, err)
+	}
+
+	_, errMsg, err = Reddit(context.Background(), "https://www.reddit.com/r/test/", "test-agent")
+	if err == nil || errMsg == "" {
+		t.Errorf("Expected error for non-post URL, got %q, %v", errMsg, err)
+	}
+}
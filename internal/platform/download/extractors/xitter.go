@@ -0,0 +1,246 @@
+package extractors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func init() {
+	Register(xitter{})
+}
+
+const (
+	maxXitterJSONLength = 4 << 20
+	// maxXitterThreadHops limits how many earlier tweets of a self thread are fetched for context.
+	maxXitterThreadHops = 5
+	// DefaultXitterAPI is used when no API is configured.
+	DefaultXitterAPI = "https://api.fxtwitter.com"
+)
+
+// xitterBaseURL is the fxtwitter or vxtwitter compatible API tweets are fetched from, the official
+// API is paywalled. Set from the configuration at startup, overridden by tests.
+var xitterBaseURL = DefaultXitterAPI
+
+// SetXitterAPI sets the API X tweets are fetched from, empty restores the default.
+// Not safe to call while extractions are running.
+func SetXitterAPI(baseURL string) {
+	if baseURL == "" {
+		baseURL = DefaultXitterAPI
+	}
+	xitterBaseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+type xitter struct{}
+
+func (xitter) Info() Info {
+	return Info{ID: "xitter", Name: "X", Emoji: "xitter", AutoExpand: true, Queue: defaultQueue("xitter")}
+}
+
+func (xitter) Match(rawURL string) bool {
+	return hasAnyPrefix(rawURL, []string{
+		"https://x.com/",
+		"https://www.x.com/",
+		"https://mobile.x.com/",
+		"https://twitter.com/",
+		"https://www.twitter.com/",
+		"https://mobile.twitter.com/",
+		"https://fxtwitter.com/",
+		"https://fixupx.com/",
+		"https://vxtwitter.com/",
+		"https://fixvx.com/"}) &&
+		strings.Contains(rawURL, "/status/")
+}
+
+func (xitter) Extract(ctx context.Context, rawURL, userAgent string) (Result, string, error) {
+	return Xitter(ctx, rawURL, userAgent)
+}
+
+// Canonicalize maps the twitter hosts and embed fixers to x.com/<user>/status/<id>, dropping
+// share params and /photo/<n> suffixes.
+func (xitter) Canonicalize(u *url.URL) {
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	setHost(u, "x.com")
+	if len(segs) >= 3 && segs[1] == "status" {
+		u.Path = "/" + strings.ToLower(segs[0]) + "/status/" + segs[2]
+		u.RawPath = ""
+	}
+}
+
+// xitterTweet is a tweet from either API flavor, see fxTweet and vxTweet.
+type xitterTweet struct {
+	ScreenName string
+	Text       string
+	Media      []Media
+	Sensitive  bool
+	ReplyTo    string // screen name of the replied to author, "" if not a reply
+	ReplyToID  string
+	Quote      *xitterTweet
+}
+
+// fxTweet is the subset of an fxtwitter tweet we use.
+type fxTweet struct {
+	Text   string `json:"text"`
+	Author struct {
+		ScreenName string `json:"screen_name"`
+	} `json:"author"`
+	Media *struct {
+		All []xitterMedia `json:"all"`
+	} `json:"media"`
+	Quote             *fxTweet `json:"quote"`
+	PossiblySensitive bool     `json:"possibly_sensitive"`
+	ReplyingTo        string   `json:"replying_to"`
+	ReplyingToStatus  string   `json:"replying_to_status"`
+}
+
+// vxTweet is the subset of a vxtwitter tweet we use.
+type vxTweet struct {
+	Text              string        `json:"text"`
+	UserScreenName    string        `json:"user_screen_name"`
+	MediaExtended     []xitterMedia `json:"media_extended"`
+	QRT               *vxTweet      `json:"qrt"`
+	PossiblySensitive bool          `json:"possibly_sensitive"`
+	ReplyingTo        string        `json:"replyingTo"`
+	ReplyingToID      string        `json:"replyingToID"`
+}
+
+type xitterMedia struct {
+	Type string `json:"type"` // photo / image, video, gif
+	URL  string `json:"url"`
+}
+
+// Xitter extracts and returns the media urls of a tweet using an fxtwitter or vxtwitter compatible API.
+// Tweets without media of their own fall back to the media of the tweet they quote, or to the text of
+// the tweet, the self thread it continues and its quote.
+// Returns result, user safe error message, and an error if any. Deleted tweets return a *RemovedError.
+func Xitter(ctx context.Context, rawURL, userAgent string) (Result, string, error) {
+	xlog.Debugf(ctx, "Extracting media from X URL: %s", rawURL)
+
+	// https://x.com/<user>/status/<id>[/photo/1]
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Result{}, "Invalid X link", fmt.Errorf("invalid X URL: %w", err)
+	}
+	segs := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segs) < 3 || segs[1] != "status" || segs[2] == "" {
+		return Result{}, "Not an X post link", fmt.Errorf("not an X post URL: %s", rawURL)
+	}
+
+	tweet, errMsg, err := fetchTweet(ctx, segs[0], segs[2], userAgent)
+	if err != nil {
+		return Result{}, errMsg, err
+	}
+
+	if len(tweet.Media) > 0 {
+		return Result{Kind: ResultMedia, Media: tweet.Media, NSFW: tweet.Sensitive}, "", nil
+	}
+	// a quote without media of its own shows the quoted tweet
+	if q := tweet.Quote; q != nil && len(q.Media) > 0 {
+		xlog.Debugf(ctx, "Using media of quoted tweet by %s", q.ScreenName)
+		return Result{Kind: ResultMedia, Media: q.Media, NSFW: tweet.Sensitive || q.Sensitive}, "", nil
+	}
+
+	// text, prefixed by the earlier tweets of the author's thread
+	lines := []string{fmt.Sprintf("@%s: %s", tweet.ScreenName, tweet.Text)}
+	for parent, hops := tweet, 0; parent.ReplyToID != "" && strings.EqualFold(parent.ReplyTo, tweet.ScreenName); hops++ {
+		if hops >= maxXitterThreadHops {
+			xlog.Debugf(ctx, "Thread of %s is longer than %d tweets, truncating", rawURL, maxXitterThreadHops)
+			break
+		}
+		if parent, _, err = fetchTweet(ctx, parent.ReplyTo, parent.ReplyToID, userAgent); err != nil {
+			xlog.Debugf(ctx, "Failed to fetch earlier tweet of thread: %v", err)
+			break
+		}
+		lines = append([]string{fmt.Sprintf("@%s: %s", parent.ScreenName, parent.Text)}, lines...)
+	}
+	if q := tweet.Quote; q != nil {
+		lines = append(lines, fmt.Sprintf("> @%s: %s", q.ScreenName, q.Text))
+	}
+	result := Result{Kind: ResultText, Text: strings.Join(lines, "\n"), NSFW: tweet.Sensitive}
+	xlog.Debugf(ctx, "Found X result: %+v", result)
+	return result, "", nil
+}
+
+// fetchTweet fetches a tweet from the configured API.
+// Returns tweet, user safe error message, and an error if any.
+func fetchTweet(ctx context.Context, screenName, id, userAgent string) (*xitterTweet, string, error) {
+	// fxtwitter wraps the tweet, vxtwitter returns it as is
+	var out struct {
+		Tweet *fxTweet `json:"tweet"`
+		vxTweet
+	}
+	if errMsg, err := fetchJSON(ctx, xitterBaseURL+"/"+url.PathEscape(screenName)+"/status/"+url.PathEscape(id), userAgent, maxXitterJSONLength, "X", xitterStatus, &out); err != nil {
+		return nil, errMsg, err
+	}
+	if out.Tweet != nil {
+		return out.Tweet.tweet(), "", nil
+	}
+	if out.UserScreenName == "" {
+		return nil, "Failed to read X post", errors.New("tweet response is neither fxtwitter nor vxtwitter shaped")
+	}
+	return out.vxTweet.tweet(), "", nil
+}
+
+// xitterStatus maps the not found and private answers of the API.
+func xitterStatus(code int, _ io.Reader) (string, error) {
+	switch code {
+	case http.StatusNotFound:
+		return "This post was deleted", &RemovedError{Deleted: true, Reason: "not_found"}
+	case http.StatusUnauthorized:
+		// fxtwitter answers protected accounts with 401 PRIVATE_TWEET
+		return "This post is private", &RemovedError{Reason: "private"}
+	}
+	return "", nil
+}
+
+func (t *fxTweet) tweet() *xitterTweet {
+	out := &xitterTweet{
+		ScreenName: t.Author.ScreenName,
+		Text:       t.Text,
+		Sensitive:  t.PossiblySensitive,
+		ReplyTo:    t.ReplyingTo,
+		ReplyToID:  t.ReplyingToStatus,
+	}
+	if t.Media != nil {
+		out.Media = xitterMediaList(t.Media.All)
+	}
+	if t.Quote != nil {
+		out.Quote = t.Quote.tweet()
+	}
+	return out
+}
+
+func (t *vxTweet) tweet() *xitterTweet {
+	out := &xitterTweet{
+		ScreenName: t.UserScreenName,
+		Text:       t.Text,
+		Media:      xitterMediaList(t.MediaExtended),
+		Sensitive:  t.PossiblySensitive,
+		ReplyTo:    t.ReplyingTo,
+		ReplyToID:  t.ReplyingToID,
+	}
+	if t.QRT != nil {
+		out.Quote = t.QRT.tweet()
+	}
+	return out
+}
+
+// xitterMediaList converts the media of a tweet. Gifs are served as mp4 by both APIs.
+func xitterMediaList(items []xitterMedia) []Media {
+	var media []Media
+	for _, m := range items {
+		switch m.Type {
+		case "photo", "image", "video", "gif":
+			if m.URL != "" {
+				media = append(media, Media{URL: m.URL})
+			}
+		}
+	}
+	return media
+}
@@ -0,0 +1,109 @@
+package extractors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sprout/internal/platform/download"
+	"strings"
+	"testing"
+)
+
+// xitterFixtures stands in for an fxtwitter / vxtwitter API, serving testdata/xitter/<id>.json for
+// /<user>/status/<id> requests and recording the requested ids. Ids with no fixture are not found.
+func xitterFixtures(t *testing.T) *[]string {
+	t.Helper()
+	var requested []string
+	fixtureServer(t, &xitterBaseURL, func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 3 || parts[1] != "status" {
+			t.Errorf("Unexpected request path: %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		requested = append(requested, parts[2])
+		switch parts[2] {
+		case "ratelimited":
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		case "private":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":401,"message":"PRIVATE_TWEET","tweet":null}`))
+			return
+		}
+		if !serveFixture(w, "xitter", parts[2]) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404,"message":"NOT_FOUND","tweet":null}`))
+		}
+	})
+	return &requested
+}
+
+func TestXitter(t *testing.T) {
+	requested := xitterFixtures(t)
+
+	tests := []struct {
+		name      string
+		url       string
+		requested []string
+		want      Result
+	}{
+		{"photos", "https://x.com/alice/status/100", []string{"100"}, Result{
+			Kind: ResultMedia,
+			Media: []Media{
+				{URL: "https://pbs.twimg.com/media/Pic0001.jpg?name=orig"},
+				{URL: "https://pbs.twimg.com/media/Pic0002.png?name=orig"},
+			},
+			NSFW: true,
+		}},
+		{"vxtwitter video", "https://twitter.com/alice/status/101?s=20", []string{"101"},
+			media("https://video.twimg.com/ext_tw_video/101/pu/vid/720x1280/Vid0001.mp4?tag=12")},
+		{"photo suffix", "https://fxtwitter.com/alice/status/101/photo/1", []string{"101"},
+			media("https://video.twimg.com/ext_tw_video/101/pu/vid/720x1280/Vid0001.mp4?tag=12")},
+		{"quoted media", "https://x.com/alice/status/102", []string{"102"}, Result{
+			Kind:  ResultMedia,
+			Media: []Media{{URL: "https://video.twimg.com/tweet_video/Gif0001.mp4"}},
+			NSFW:  true,
+		}},
+		// the thread stops at 105, it replies to someone else
+		{"thread", "https://x.com/alice/status/103", []string{"103", "104", "105"}, Result{
+			Kind: ResultText,
+			Text: "@alice: 1/ a thread\n@alice: 2/ second\n@alice: 3/ and that's why\n> @bob: hot take",
+		}},
+		{"thread start", "https://x.com/alice/status/105", []string{"105"}, Result{Kind: ResultText, Text: "@alice: 1/ a thread"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*requested = nil
+			got, errMsg, err := Xitter(context.Background(), tt.url, "test-agent")
+			if err != nil {
+				t.Fatalf("Xitter failed: %s: %v", errMsg, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %#v, got %#v", tt.want, got)
+			}
+			if !reflect.DeepEqual(*requested, tt.requested) {
+				t.Errorf("Expected requests %v, got %v", tt.requested, *requested)
+			}
+		})
+	}
+}
+
+func TestXitterErrors(t *testing.T) {
+	xitterFixtures(t)
+
+	var removed *RemovedError
+	if _, _, err := Xitter(context.Background(), "https://x.com/alice/status/999", "test-agent"); !errors.As(err, &removed) || !removed.Deleted {
+		t.Errorf("Expected deleted RemovedError, got %v", err)
+	}
+	if _, _, err := Xitter(context.Background(), "https://x.com/alice/status/private", "test-agent"); !errors.As(err, &removed) || removed.Reason != "private" {
+		t.Errorf("Expected private RemovedError, got %v", err)
+	}
+	if _, _, err := Xitter(context.Background(), "https://x.com/alice/status/ratelimited", "test-agent"); !errors.Is(err, download.ErrTooManyRequests) {
+		t.Errorf("Expected ErrTooManyRequests, got %v", err)
+	}
+	if _, errMsg, err := Xitter(context.Background(), "https://x.com/alice", "test-agent"); err == nil || errMsg == "" {
+		t.Errorf("Expected error for profile link, got %q, %v", errMsg, err)
+	}
+}
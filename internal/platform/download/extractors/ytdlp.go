@@ -0,0 +1,249 @@
+package extractors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sprout/internal/platform/download"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func init() {
+	Register(&ytdlp{
+		info: Info{ID: "youTube", Name: "YouTube", Emoji: "youtube", Queue: defaultQueue("youtube")},
+		prefixes: []string{
+			"https://www.youtube.com/",
+			"https://youtube.com/",
+			"https://youtu.be/"},
+		exclude:     youTubeShortsPrefixes,
+		checkLength: true,
+		canonical:   canonicalYouTube,
+	})
+	Register(&ytdlp{
+		info:      Info{ID: "youTubeShorts", Name: "YouTube Shorts", Emoji: "youtube", AutoExpand: true, Queue: defaultQueue("youtube")},
+		prefixes:  youTubeShortsPrefixes,
+		canonical: canonicalYouTube,
+	})
+	Register(&ytdlp{
+		info: Info{ID: "redGifs", Name: "RedGifs", Emoji: "18_plus", AutoExpand: true, Queue: defaultQueue("redgifs")},
+		prefixes: []string{
+			"https://redgifs.com/watch/",
+			"https://www.redgifs.com/watch/"},
+		canonical: func(u *url.URL) {
+			setHost(u, "www.redgifs.com")
+			u.Path = strings.ToLower(u.Path)
+		},
+	})
+	Register(allowlisted)
+}
+
+var youTubeShortsPrefixes = []string{
+	"https://youtube.com/shorts/",
+	"https://www.youtube.com/shorts/"}
+
+// ytdlp is an extractor for sites yt-dlp downloads directly, the link itself is the media.
+type ytdlp struct {
+	info        Info
+	prefixes    []string
+	exclude     []string // prefixes handled by a more specific extractor
+	checkLength bool     // look up the length so long videos can be confirmed first
+	canonical   func(u *url.URL)
+}
+
+func (y *ytdlp) Info() Info {
+	return y.info
+}
+
+func (y *ytdlp) Match(rawURL string) bool {
+	return hasAnyPrefix(rawURL, y.prefixes) && !hasAnyPrefix(rawURL, y.exclude)
+}
+
+func (y *ytdlp) Canonicalize(u *url.URL) {
+	if y.canonical != nil {
+		y.canonical(u)
+	}
+}
+
+func (y *ytdlp) Extract(ctx context.Context, rawURL, userAgent string) (Result, string, error) {
+	result := Result{Kind: ResultMedia, Media: []Media{{URL: rawURL, YtDLP: true}}}
+	if y.checkLength {
+		seconds, err := download.YtDLPLength(ctx, rawURL, 10*time.Second)
+		if errors.Is(err, download.ErrUnavailable) {
+			return Result{}, "This video is unavailable", &RemovedError{Reason: "unavailable"}
+		}
+		if err != nil {
+			return Result{}, "Failed to get the length of the video", fmt.Errorf("failed to get length: %w", err)
+		}
+		xlog.Debugf(ctx, "Found %s media of %d seconds: %s", y.info.Name, seconds, rawURL)
+		result.Seconds = seconds
+	}
+	return result, "", nil
+}
+
+// Probe asks yt-dlp for the length of the media, which fails once it's gone. Extract passes
+// links through unless it checks the length.
+func (y *ytdlp) Probe(ctx context.Context, rawURL, userAgent string) error {
+	_, err := download.YtDLPLength(ctx, rawURL, 30*time.Second)
+	if errors.Is(err, download.ErrUnavailable) {
+		return &RemovedError{Reason: "unavailable"}
+	}
+	return err
+}
+
+// canonicalYouTube rewrites video links to youtube.com/watch?v=<id>, dropping timestamps and
+// share params. Other pages, e.g. shorts and playlists, only lose the share params.
+func canonicalYouTube(u *url.URL) {
+	var id string
+	switch {
+	case u.Host == "youtu.be":
+		id = strings.Trim(u.Path, "/")
+	case u.Path == "/watch":
+		id = u.Query().Get("v")
+	}
+	u.Host = "www.youtube.com"
+	u.RawPath = ""
+	if id != "" {
+		u.Path, u.RawQuery = "/watch", url.Values{"v": {id}}.Encode()
+		return
+	}
+	q := u.Query()
+	q.Del("si")
+	q.Del("feature")
+	u.RawQuery = q.Encode()
+}
+
+// allowlisted is the extractor of the hosts admins allowlisted for yt-dlp, see SetYtDLPHosts.
+var allowlisted = &ytdlpHosts{
+	ytdlp: ytdlp{
+		info:        Info{ID: "ytdlp", Name: "Other sites (yt-dlp)", Emoji: "unknown", AutoExpand: true, Queue: defaultQueue("ytdlp")},
+		checkLength: true,
+	},
+}
+
+// ytdlpHosts downloads links to allowlisted hosts with yt-dlp. Each host gets its own queue with
+// the ytdlp policy, a host can additionally require a minimum interval between its links.
+type ytdlpHosts struct {
+	ytdlp
+	mu        sync.Mutex
+	intervals map[string]int // host to seconds between links, 0 = queue interval only
+}
+
+// SetYtDLPHosts replaces the allowlisted hosts, a map of host to the minimum seconds between
+// links of that host. Hosts handled by another extractor are ignored. Safe for concurrent use.
+func SetYtDLPHosts(hosts map[string]int) {
+	allowlisted.mu.Lock()
+	defer allowlisted.mu.Unlock()
+	allowlisted.intervals = hosts
+}
+
+// host returns the allowlisted host the link belongs to.
+func (y *ytdlpHosts) host(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", false
+	}
+	host := strings.ToLower(u.Hostname())
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	for h := range y.intervals {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return h, true
+		}
+	}
+	return "", false
+}
+
+func (y *ytdlpHosts) Match(rawURL string) bool {
+	if _, ok := y.host(rawURL); !ok {
+		return false
+	}
+	// built-in extractors win, allowlisting e.g. youtube.com must not steal their links
+	return !slices.ContainsFunc(registry, func(ex Extractor) bool {
+		return ex != Extractor(y) && ex.Match(rawURL)
+	})
+}
+
+func (y *ytdlpHosts) Extract(ctx context.Context, rawURL, userAgent string) (Result, string, error) {
+	if _, ok := y.host(rawURL); !ok {
+		return Result{}, "This site is no longer allowed", fmt.Errorf("host of %s is not allowlisted", rawURL)
+	}
+	return y.ytdlp.Extract(ctx, rawURL, userAgent)
+}
+
+// Probe leaves links of hosts that were taken off the allowlist unchecked.
+func (y *ytdlpHosts) Probe(ctx context.Context, rawURL, userAgent string) error {
+	if _, ok := y.host(rawURL); !ok {
+		return fmt.Errorf("%w: host of %s is not allowlisted", ErrNotProbed, rawURL)
+	}
+	return y.ytdlp.Probe(ctx, rawURL, userAgent)
+}
+
+func (y *ytdlpHosts) QueueHost(rawURL string) (string, time.Duration, bool) {
+	host, ok := y.host(rawURL)
+	if !ok {
+		return "", 0, false
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	return host, time.Duration(y.intervals[host]) * time.Second, true
+}
+
+// EmojiFor returns the app emoji name prefix of the link, the host without its top level
+// domain, e.g. "tiktok" for vm.tiktok.com.
+func (y *ytdlpHosts) EmojiFor(rawURL string) string {
+	host, ok := y.host(rawURL)
+	if !ok {
+		return y.info.Emoji
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return host
+	}
+	return labels[len(labels)-2]
+}
+
+// ParseYtDLPHosts parses hosts separated by commas, each optionally followed by the minimum
+// seconds between its links, e.g. "tiktok.com=10, streamable.com, clips.twitch.tv".
+func ParseYtDLPHosts(s string) (map[string]int, error) {
+	hosts := make(map[string]int)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, seconds, hasSeconds := strings.Cut(entry, "=")
+		host = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(host)), "www.")
+		if host == "" || !strings.Contains(host, ".") || strings.ContainsAny(host, "/: ") {
+			return nil, fmt.Errorf("invalid host %q, use host or host=seconds", entry)
+		}
+		interval := 0
+		if hasSeconds {
+			var err error
+			if interval, err = strconv.Atoi(strings.TrimSpace(seconds)); err != nil || interval < 0 {
+				return nil, fmt.Errorf("invalid seconds in %q", entry)
+			}
+		}
+		hosts[host] = interval
+	}
+	return hosts, nil
+}
+
+// FormatYtDLPHosts is the inverse of ParseYtDLPHosts, sorted by host.
+func FormatYtDLPHosts(hosts map[string]int) string {
+	var entries []string
+	for host, interval := range hosts {
+		if interval > 0 {
+			host += "=" + strconv.Itoa(interval)
+		}
+		entries = append(entries, host)
+	}
+	slices.Sort(entries)
+	return strings.Join(entries, ", ")
+}
@@ -0,0 +1,72 @@
+package extractors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestYtDLPHosts(t *testing.T) {
+	hosts, err := ParseYtDLPHosts(" WWW.TikTok.com=10, clips.twitch.tv,youtube.com ,")
+	if err != nil {
+		t.Fatalf("ParseYtDLPHosts() failed: %v", err)
+	}
+	if got := FormatYtDLPHosts(hosts); got != "clips.twitch.tv, tiktok.com=10, youtube.com" {
+		t.Errorf("FormatYtDLPHosts() = %q", got)
+	}
+	for _, bad := range []string{"tiktok", "https://tiktok.com", "tiktok.com=soon", "tiktok.com=-1", "=5"} {
+		if _, err := ParseYtDLPHosts(bad); err == nil {
+			t.Errorf("Expected ParseYtDLPHosts(%q) to fail", bad)
+		}
+	}
+
+	SetYtDLPHosts(hosts)
+	t.Cleanup(func() { SetYtDLPHosts(nil) })
+	tests := []struct {
+		url   string
+		id    string
+		emoji string
+	}{
+		{"https://www.tiktok.com/@someone/video/1", "ytdlp", "tiktok"},
+		{"https://vm.tiktok.com/abc/", "ytdlp", "tiktok"},
+		{"https://clips.twitch.tv/SomeClip", "ytdlp", "twitch"},
+		{"https://www.twitch.tv/videos/1", "", ""},
+		{"https://nottiktok.com/video/1", "", ""},
+		// allowlisting a built-in site leaves its links to the built-in extractor
+		{"https://www.youtube.com/watch?v=abc", "youTube", "youtube"},
+	}
+	for _, tt := range tests {
+		ex := Find(tt.url)
+		switch {
+		case tt.id == "" && ex != nil:
+			t.Errorf("%s: expected no extractor, got %s", tt.url, ex.Info().ID)
+		case tt.id != "" && (ex == nil || ex.Info().ID != tt.id):
+			t.Errorf("%s: expected %s, got %v", tt.url, tt.id, ex)
+		case ex != nil && Emoji(ex, tt.url) != tt.emoji:
+			t.Errorf("%s: expected emoji %s, got %s", tt.url, tt.emoji, Emoji(ex, tt.url))
+		}
+	}
+
+	SetYtDLPHosts(nil)
+	if Find("https://vm.tiktok.com/abc/") != nil {
+		t.Error("Expected no extractor after clearing the allowlist")
+	}
+}
+
+func TestYtDLPHostQueue(t *testing.T) {
+	y := &ytdlpHosts{intervals: map[string]int{"tiktok.com": 10, "vimeo.com": 0}}
+	tests := []struct {
+		url      string
+		host     string
+		interval time.Duration
+	}{
+		{"https://vm.tiktok.com/abc/", "tiktok.com", 10 * time.Second},
+		{"https://vimeo.com/1", "vimeo.com", 0},
+		{"https://example.com/1", "", 0},
+	}
+	for _, tt := range tests {
+		host, interval, ok := y.QueueHost(tt.url)
+		if host != tt.host || interval != tt.interval || ok != (tt.host != "") {
+			t.Errorf("QueueHost(%s) = %q, %s, %v", tt.url, host, interval, ok)
+		}
+	}
+}
@@ -59,14 +59,30 @@ func ParseMediaURL(rawURL string) (DownloadPlan, error) {
 		return DownloadPlan{}, fmt.Errorf("invalid url: %w", err)
 	}
 
-	plan := DownloadPlan{
-		URL: rawURL,
-	}
-
 	ext, err := extractFileType(rawURL)
 	if err != nil {
 		return DownloadPlan{}, err
 	}
+	return planMedia(rawURL, ext), nil
+}
+
+// ParseMediaURLAs is ParseMediaURL for URLs that don't show the file type, e.g. CDN urls
+// ending in a content hash. ext is used instead of the one in the URL.
+func ParseMediaURLAs(rawURL, ext string) (DownloadPlan, error) {
+	if _, err := url.ParseRequestURI(rawURL); err != nil {
+		return DownloadPlan{}, fmt.Errorf("invalid url: %w", err)
+	}
+	if ext == "" {
+		return DownloadPlan{}, fmt.Errorf("invalid file type: empty")
+	}
+	return planMedia(rawURL, strings.ToLower(ext)), nil
+}
+
+// planMedia picks the download strategy for a file type.
+func planMedia(rawURL, ext string) DownloadPlan {
+	plan := DownloadPlan{
+		URL: rawURL,
+	}
 	plan.Ext = ext
 	plan.OutputExt = ext
 
@@ -80,7 +96,7 @@ func ParseMediaURL(rawURL string) (DownloadPlan, error) {
 		plan.Strategy = StrategyDirect
 	}
 
-	return plan, nil
+	return plan
 }
 
 var extRegex = regexp.MustCompile(`\.([a-zA-Z0-9]+)(?:[?#]|$)`)
@@ -103,3 +119,19 @@ func extractFileType(rawURL string) (string, error) {
 	}
 	return strings.ToLower(m[1]), nil
 }
+
+// IsSingleValidURL checks if the given string contains a single valid URL.
+func IsSingleValidURL(s string) bool {
+	// fast path
+	if !(strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")) {
+		return false
+	}
+	// fuzzy check
+	count := strings.Count(s, "http://") + strings.Count(s, "https://")
+	if count != 1 || strings.ContainsAny(s, " \t\n") {
+		return false
+	}
+	// parse URL
+	u, err := url.ParseRequestURI(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
@@ -0,0 +1,72 @@
+// Link Rot
+// Admin listing of mirrored links whose source is gone
+
+import { getJSON } from './api.js';
+
+/** Build the element for one dead source */
+function buildItem(source) {
+    const item = document.createElement('div');
+    item.className = 'bg-base-200/50 rounded-lg p-3 space-y-1';
+
+    const header = document.createElement('div');
+    header.className = 'flex items-center justify-between gap-2 text-sm';
+    const link = document.createElement('a');
+    link.className = 'link link-hover break-all';
+    link.href = source.url;
+    link.target = '_blank';
+    link.rel = 'noopener noreferrer';
+    link.textContent = source.url;
+    const state = document.createElement('span');
+    state.className = source.state === 'deleted' ? 'badge badge-error badge-sm' : 'badge badge-warning badge-sm';
+    state.textContent = source.state;
+    header.appendChild(link);
+    header.appendChild(state);
+    item.appendChild(header);
+
+    const details = document.createElement('div');
+    details.className = 'text-xs text-base-content/70';
+    const parts = [`Gone since ${new Date(source.died).toLocaleDateString()}`];
+    if (source.reason) parts.push(source.reason);
+    if (source.favorite) parts.push('favorited');
+    details.textContent = parts.join(' • ');
+    item.appendChild(details);
+    return item;
+}
+
+/** Open the link rot modal and load the dead sources */
+export function openLinkRotModal() {
+    const modal = document.getElementById('linkrot-modal');
+    const loading = document.getElementById('linkrot-loading');
+    const content = document.getElementById('linkrot-content');
+    const error = document.getElementById('linkrot-error');
+    const errorMessage = document.getElementById('linkrot-error-message');
+
+    // Reset state
+    loading.classList.remove('hidden');
+    content.classList.add('hidden');
+    error.classList.add('hidden');
+    content.innerHTML = '';
+    modal.showModal();
+
+    getJSON('/settings/linkrot/report')
+        .then(report => {
+            loading.classList.add('hidden');
+            const summary = document.createElement('div');
+            summary.className = 'text-sm text-base-content/70';
+            summary.textContent = `${report.alive} alive • ${report.dead} dead • ${report.unchecked} not checked yet`;
+            content.appendChild(summary);
+            (report.sources || []).forEach(source => content.appendChild(buildItem(source)));
+            if (report.dead > report.sources.length) {
+                const note = document.createElement('div');
+                note.className = 'text-xs italic text-base-content/50';
+                note.textContent = `Showing the ${report.sources.length} most recent of ${report.dead} dead links.`;
+                content.appendChild(note);
+            }
+            content.classList.remove('hidden');
+        })
+        .catch(err => {
+            loading.classList.add('hidden');
+            error.classList.remove('hidden');
+            errorMessage.textContent = err.message || 'Failed to load the dead links.';
+        });
+}
@@ -4,6 +4,9 @@
 import { initTheme, setupThemeToggle, toggleTheme } from './theme.js';
 import { blockClicks, unblockClicks } from './ui.js';
 import { openBackupsModal, stopServer, restartServer } from './server.js';
+import { openRevisionsModal } from './revisions.js';
+import { openRetentionModal } from './retention.js';
+import { openLinkRotModal } from './linkrot.js';
 import { initSettings } from './settings.js';
 
 // Initialize theme immediately (before DOM ready) to prevent flash
@@ -12,6 +15,9 @@ initTheme();
 // Expose functions needed by inline onclick handlers in HTML
 window.toggleTheme = toggleTheme;
 window.openBackupsModal = openBackupsModal;
+window.openRevisionsModal = openRevisionsModal;
+window.openRetentionModal = openRetentionModal;
+window.openLinkRotModal = openLinkRotModal;
 window.stopServer = stopServer;
 window.restartServer = restartServer;
 window.blockClicks = blockClicks;
@@ -0,0 +1,122 @@
+// Download Queues
+// Admin editing of the extractor queue policies, with their live state
+
+import { showPending, showSuccess, showError } from './ui.js';
+import { postJSON, getJSON } from './api.js';
+
+const POLL_INTERVAL_MS = 5000;
+
+/** Format seconds for display, e.g. "90s" or "2m 30s" */
+function formatSeconds(seconds) {
+    const s = Math.ceil(seconds);
+    if (s < 60) return `${s}s`;
+    const m = Math.floor(s / 60);
+    return s % 60 ? `${m}m ${s % 60}s` : `${m}m`;
+}
+
+/** Describe the state of a queue, read only queues also show their interval */
+function describe(queue) {
+    const parts = [`${queue.len} queued`];
+    if (queue.readOnly) parts.unshift(`every ${formatSeconds(queue.interval)}`);
+    if (queue.running) parts.push('running');
+    if (queue.backoffLeft > 0) {
+        parts.push(`backing off, ${formatSeconds(queue.backoffLeft)} left`);
+    } else if (queue.nextBackoff > queue.backoff) {
+        parts.push(`next backoff ${formatSeconds(queue.nextBackoff)}`);
+    }
+    return parts.join(' • ');
+}
+
+/** Add the row of a host queue created since the page loaded */
+function addHostRow(rows, queue) {
+    const row = document.createElement('div');
+    row.className = 'queue-host bg-base-200/50 rounded-lg p-3';
+    row.dataset.queue = queue.name;
+    const header = document.createElement('div');
+    header.className = 'flex items-center justify-between gap-2';
+    const name = document.createElement('span');
+    name.className = 'label-text text-base-content font-medium';
+    name.textContent = queue.name;
+    const stats = document.createElement('span');
+    stats.className = 'queue-stats text-xs text-base-content/70';
+    header.append(name, stats);
+    row.append(header);
+    document.getElementById('queue-policies').append(row);
+    rows.set(queue.name, row);
+    return row;
+}
+
+/** Refresh the state of every queue row, and the policy inputs if asked */
+async function refresh(rows, updateInputs = false) {
+    const queues = await getJSON('/settings/queues');
+    queues.forEach(queue => {
+        let row = rows.get(queue.name);
+        if (!row && queue.readOnly) row = addHostRow(rows, queue);
+        if (!row) return;
+        row.querySelector('.queue-stats').textContent = describe(queue);
+        if (queue.readOnly) return;
+        row.querySelector('.queue-policy-reset').disabled = !queue.overridden;
+        if (updateInputs) {
+            row.querySelectorAll('.queue-policy-input').forEach(input => {
+                input.value = queue[input.dataset.field];
+            });
+        }
+    });
+}
+
+/** Wire up the queue policy inputs and poll the queue state while the page is visible */
+export function wireQueuePolicies() {
+    const rows = new Map();
+    document.querySelectorAll('.queue-policy, .queue-host').forEach(row => rows.set(row.dataset.queue, row));
+    if (rows.size === 0) return;
+
+    document.querySelectorAll('.queue-policy').forEach(row => {
+        const name = row.dataset.queue;
+        const status = row.querySelector('.status');
+        const post = async (policy, signal) => {
+            showPending(status);
+            try {
+                await postJSON('/settings/admin', { queuePolicies: { [name]: policy } }, signal);
+                showSuccess(status);
+                return true;
+            } catch (e) {
+                if (e.name !== 'AbortError') showError(status, e.message);
+                return false;
+            }
+        };
+
+        // debounced like the other text inputs, one field at a time
+        row.querySelectorAll('.queue-policy-input').forEach(input => {
+            let timeout = null;
+            let controller = null;
+            input.addEventListener('input', () => {
+                clearTimeout(timeout);
+                if (controller) controller.abort();
+                timeout = setTimeout(async () => {
+                    const value = parseFloat(input.value);
+                    if (isNaN(value)) {
+                        showError(status, 'Invalid number');
+                        return;
+                    }
+                    controller = new AbortController();
+                    if (await post({ [input.dataset.field]: value }, controller.signal)) {
+                        row.querySelector('.queue-policy-reset').disabled = false;
+                    }
+                }, 500);
+            });
+        });
+
+        // back to the default policy
+        row.querySelector('.queue-policy-reset').addEventListener('click', async () => {
+            if (await post(null)) {
+                refresh(rows, true).catch(() => {});
+            }
+        });
+    });
+
+    const poll = () => {
+        if (!document.hidden) refresh(rows).catch(() => {});
+    };
+    poll();
+    setInterval(poll, POLL_INTERVAL_MS);
+}
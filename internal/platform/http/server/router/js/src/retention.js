@@ -0,0 +1,106 @@
+// Retention
+// Admin dry run of the per-server storage retention policies
+
+import { getJSON } from './api.js';
+
+/** Format a byte count for display */
+function formatBytes(bytes) {
+    const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+    let i = 0;
+    while (bytes >= 1024 && i < units.length - 1) {
+        bytes /= 1024;
+        i++;
+    }
+    return `${bytes.toFixed(i === 0 ? 0 : 1)} ${units[i]}`;
+}
+
+/** Describe the policy of a guild */
+function describePolicy(policy) {
+    const parts = [];
+    if (policy.maxAgeDays > 0) parts.push(`${policy.maxAgeDays} days`);
+    if (policy.maxBytes > 0) parts.push(formatBytes(policy.maxBytes));
+    Object.entries(policy.domainMaxBytes || {}).forEach(([domain, size]) => {
+        parts.push(`${domain} ${formatBytes(size)}`);
+    });
+    return parts.length > 0 ? parts.join(' • ') : 'No limits';
+}
+
+/** Build the element for one guild report */
+function buildItem(guild) {
+    const item = document.createElement('div');
+    item.className = 'bg-base-200/50 rounded-lg p-3 space-y-2';
+
+    const header = document.createElement('div');
+    header.className = 'flex items-center justify-between text-sm';
+    const title = document.createElement('span');
+    title.className = 'font-medium';
+    title.textContent = guild.name;
+    const policy = document.createElement('span');
+    policy.className = 'badge badge-ghost badge-sm';
+    policy.textContent = describePolicy(guild.policy);
+    header.appendChild(title);
+    header.appendChild(policy);
+    item.appendChild(header);
+
+    const usage = document.createElement('div');
+    usage.className = 'text-xs text-base-content/70';
+    usage.textContent = `${guild.assets} assets (${formatBytes(guild.assetBytes)}) • ` +
+        `${guild.messages} messages (${formatBytes(guild.archiveBytes)}) • ${guild.protected} favorited`;
+    item.appendChild(usage);
+
+    const evictions = document.createElement('div');
+    evictions.className = guild.evictBytes > 0 ? 'text-sm text-warning' : 'text-sm text-base-content/50';
+    evictions.textContent = guild.evictBytes > 0
+        ? `Would evict ${guild.evictAssets} assets and ${guild.evictMessages} messages, ${formatBytes(guild.evictBytes)}`
+        : 'Nothing to evict';
+    item.appendChild(evictions);
+
+    if (guild.sample && guild.sample.length > 0) {
+        const list = document.createElement('ul');
+        list.className = 'text-xs text-base-content/50 border-l-2 border-base-300 pl-3 space-y-1';
+        guild.sample.forEach(ev => {
+            const entry = document.createElement('li');
+            entry.className = 'break-all';
+            const what = ev.asset || `message ${ev.message}`;
+            entry.textContent = `${new Date(ev.time).toLocaleDateString()} • ${formatBytes(ev.size)} • ${ev.reason} • ${what}`;
+            list.appendChild(entry);
+        });
+        item.appendChild(list);
+    }
+    return item;
+}
+
+/** Open the retention modal and load a fresh dry run */
+export function openRetentionModal() {
+    const modal = document.getElementById('retention-modal');
+    const loading = document.getElementById('retention-loading');
+    const content = document.getElementById('retention-content');
+    const error = document.getElementById('retention-error');
+    const errorMessage = document.getElementById('retention-error-message');
+
+    // Reset state
+    loading.classList.remove('hidden');
+    content.classList.add('hidden');
+    error.classList.add('hidden');
+    content.innerHTML = '';
+    modal.showModal();
+
+    getJSON('/settings/retention/report')
+        .then(report => {
+            loading.classList.add('hidden');
+            (report.guilds || []).forEach(guild => content.appendChild(buildItem(guild)));
+            if (report.unattributedAssets > 0) {
+                const note = document.createElement('div');
+                note.className = 'text-xs italic text-base-content/50';
+                note.textContent = `${report.unattributedAssets} older assets (${formatBytes(report.unattributedBytes)}) ` +
+                    'are not linked to a server and are never evicted.';
+                content.appendChild(note);
+            }
+            content.classList.remove('hidden');
+        })
+        .catch(err => {
+            loading.classList.add('hidden');
+            error.classList.remove('hidden');
+            errorMessage.textContent = err.message || 'Failed to load the retention preview.';
+        });
+}
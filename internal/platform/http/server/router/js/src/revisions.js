@@ -0,0 +1,115 @@
+// Revisions
+// Admin view of the edit / deletion history kept in the message archive
+
+import { getJSON } from './api.js';
+
+/** Format an RFC3339 timestamp for display */
+function formatTime(value) {
+    const date = new Date(value);
+    return date.toLocaleDateString() + ' ' + date.toLocaleTimeString();
+}
+
+/** Build the element for one archived message and its revisions */
+function buildItem(msg) {
+    const item = document.createElement('div');
+    item.className = 'bg-base-200/50 rounded-lg p-3 space-y-2';
+
+    const header = document.createElement('div');
+    header.className = 'flex items-center justify-between text-sm';
+    const title = document.createElement('a');
+    title.className = 'font-medium link link-hover';
+    title.href = msg.link;
+    title.target = '_blank';
+    title.textContent = `${msg.author} in #${msg.channel}`;
+    const state = document.createElement('span');
+    state.className = msg.deleted ? 'badge badge-error badge-sm' : 'badge badge-ghost badge-sm';
+    state.textContent = msg.deleted ? 'Deleted ' + formatTime(msg.deleted) : `${msg.revisions.length - 1} edit(s)`;
+    header.appendChild(title);
+    header.appendChild(state);
+    item.appendChild(header);
+
+    if (msg.redacted) {
+        const note = document.createElement('div');
+        note.className = 'text-xs italic text-base-content/50';
+        note.textContent = 'The author opted out of backups, the content was removed.';
+        item.appendChild(note);
+        return item;
+    }
+
+    msg.revisions.forEach((rev, i) => {
+        const entry = document.createElement('div');
+        entry.className = 'border-l-2 border-base-300 pl-3';
+
+        const when = document.createElement('div');
+        when.className = 'text-xs text-base-content/50';
+        const label = i === 0 ? 'Original' : 'Edit';
+        when.textContent = `${label} • ${formatTime(rev.edited || msg.created)}`;
+
+        const content = document.createElement('div');
+        content.className = 'text-sm whitespace-pre-wrap break-words';
+        content.textContent = rev.content || '(no text)';
+
+        entry.appendChild(when);
+        entry.appendChild(content);
+        if (rev.attachments.length > 0) {
+            const attachments = document.createElement('div');
+            attachments.className = 'text-xs text-base-content/50';
+            attachments.textContent = 'Attachments: ' + rev.attachments.join(', ');
+            entry.appendChild(attachments);
+        }
+        item.appendChild(entry);
+    });
+    return item;
+}
+
+/** Fetch and render revisions, optionally for a single message */
+function loadRevisions(message) {
+    const loading = document.getElementById('revisions-loading');
+    const content = document.getElementById('revisions-content');
+    const empty = document.getElementById('revisions-empty');
+    const error = document.getElementById('revisions-error');
+    const errorMessage = document.getElementById('revisions-error-message');
+
+    // Reset state
+    loading.classList.remove('hidden');
+    content.classList.add('hidden');
+    empty.classList.add('hidden');
+    error.classList.add('hidden');
+    content.innerHTML = '';
+
+    const query = message ? '?message=' + encodeURIComponent(message) : '';
+    getJSON('/settings/archive/revisions' + query)
+        .then(msgs => {
+            loading.classList.add('hidden');
+            if (!msgs || msgs.length === 0) {
+                empty.classList.remove('hidden');
+                return;
+            }
+            msgs.forEach(msg => content.appendChild(buildItem(msg)));
+            content.classList.remove('hidden');
+        })
+        .catch(err => {
+            loading.classList.add('hidden');
+            error.classList.remove('hidden');
+            errorMessage.textContent = err.message || 'Failed to load revisions.';
+        });
+}
+
+/** Open and populate the revisions modal */
+export function openRevisionsModal() {
+    const modal = document.getElementById('revisions-modal');
+    const form = document.getElementById('revisions-lookup');
+    const input = document.getElementById('revisions-message');
+
+    if (!form.dataset.wired) {
+        form.dataset.wired = 'true';
+        form.addEventListener('submit', e => {
+            e.preventDefault();
+            loadRevisions(input.value.trim());
+        });
+    }
+
+    input.value = '';
+    modal.showModal();
+    loadRevisions('');
+}
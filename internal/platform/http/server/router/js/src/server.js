@@ -57,8 +57,18 @@ export function openBackupsModal() {
                     lastRun.textContent = 'No backup run yet';
                 }
 
+                // Same counts as the progress message in the bot channel
+                const status = document.createElement('div');
+                status.className = 'text-xs text-base-content/50';
+                if (backup.running || backup.lastRun) {
+                    status.textContent = (backup.running ? 'In progress: ' : 'Last run: ') +
+                        `${backup.channelsDone}/${backup.channelsTotal} channels, ` +
+                        `${backup.messages} messages, ${backup.errors} errors`;
+                }
+
                 info.appendChild(name);
                 info.appendChild(lastRun);
+                info.appendChild(status);
 
                 const downloadBtn = document.createElement('a');
 
@@ -4,6 +4,7 @@
 import { findStatus, showPending, showSuccess, showError } from './ui.js';
 import { postJSON, deleteRequest } from './api.js';
 import { handleToggle, handleSelect, handleTextInput, handleCheckbox, handleRadio } from './forms.js';
+import { wireQueuePolicies } from './queues.js';
 
 /** Show restart required notice */
 function showRestartNotice() {
@@ -15,9 +16,9 @@ function showRestartNotice() {
 function wireUserSettings() {
     handleToggle('backup-opt-out', '/settings/user', 'backupOptOut');
     handleToggle('ai-chat-opt-out', '/settings/user', 'aiChatOptOut');
-    handleToggle('auto-expand-reddit', '/settings/user', 'autoExpand.reddit');
-    handleToggle('auto-expand-youtube-shorts', '/settings/user', 'autoExpand.youTubeShorts');
-    handleToggle('auto-expand-redgifs', '/settings/user', 'autoExpand.redGifs');
+    document.querySelectorAll('.auto-expand').forEach(el => {
+        handleToggle(el, '/settings/user', `autoExpand.${el.dataset.extractor}`);
+    });
 }
 
 /** Wire up admin settings (Admin tab) */
@@ -28,11 +29,17 @@ function wireAdminSettings() {
     handleTextInput('admin-proxy-port', '/settings/admin', 'proxyPort', 500, { onSuccess: showRestartNotice });
     handleTextInput('admin-bot-token', '/settings/admin', 'botToken', 500, { skipEmpty: true, onSuccess: showRestartNotice });
     handleTextInput('admin-ollama-url', '/settings/admin', 'ollamaURL', 500, { onSuccess: showRestartNotice });
+    handleTextInput('admin-xitter-api-url', '/settings/admin', 'xitterAPIURL', 500, { onSuccess: showRestartNotice });
+    handleTextInput('admin-ytdlp-hosts', '/settings/admin', 'ytdlpHosts', 500);
+    handleTextInput('admin-outbound', '/settings/admin', 'outbound', 800);
 
     // Disable Auto-Expand (server-wide)
-    handleToggle('admin-disable-autoexpand-reddit', '/settings/admin', 'disableAutoExpand.reddit');
-    handleToggle('admin-disable-autoexpand-youtube-shorts', '/settings/admin', 'disableAutoExpand.youTubeShorts');
-    handleToggle('admin-disable-autoexpand-redgifs', '/settings/admin', 'disableAutoExpand.redGifs');
+    document.querySelectorAll('.admin-disable-autoexpand').forEach(el => {
+        handleToggle(el, '/settings/admin', `disableAutoExpand.${el.dataset.extractor}`);
+    });
+
+    // Download queue policies, applied live
+    wireQueuePolicies();
 
     // yt-dlp Update button (one-shot action, not a toggle)
     const ytdlpBtn = document.getElementById('admin-update-yt-dlp');
@@ -69,9 +76,17 @@ function wireGuildSettings() {
         // Backup Password
         handleTextInput(`guild-${guildId}-backup-password`, endpoint, 'backupPassword', 500, { skipEmpty: true });
 
+        // Backup Hour
+        handleSelect(`guild-${guildId}-backup-hour`, endpoint, 'backupHour');
+
         // Synctube URL
         handleTextInput(`guild-${guildId}-synctube`, endpoint, 'synctubeURL', 500);
 
+        // Retention
+        handleTextInput(`guild-${guildId}-retention-age`, endpoint, 'retentionMaxAgeDays', 500);
+        handleTextInput(`guild-${guildId}-retention-size`, endpoint, 'retentionMaxGB', 500);
+        handleTextInput(`guild-${guildId}-retention-domains`, endpoint, 'retentionDomains', 800);
+
         // Toggle settings
         handleToggle(`guild-${guildId}-backup`, endpoint, 'backupEnabled');
         handleToggle(`guild-${guildId}-antirot`, endpoint, 'antiRotEnabled');
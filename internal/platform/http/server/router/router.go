@@ -3,14 +3,22 @@ package router
 import (
 	"fmt"
 	"net/http"
+	"os"
 	"path/filepath"
+	"slices"
 	"sprout/internal/app"
+	"sprout/internal/discord/backup"
+	"sprout/internal/platform/auth"
+	"sprout/internal/platform/database"
 	"sprout/internal/platform/http/server/router/css"
 	"sprout/internal/platform/http/server/router/images"
 	"sprout/internal/platform/http/server/router/js"
 	"sprout/pkg/xcrypto"
 
+	"github.com/Data-Corruption/lmdb-go/lmdb"
+	"github.com/Data-Corruption/stdx/xhttp"
 	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/disgoorg/snowflake/v2"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -69,8 +77,47 @@ func New(a *app.App) *chi.Mux {
 	r.Route("/download", func(s chi.Router) {
 		s.Use(a.AuthManager.Param(a.DB))
 
-		s.Get("/backup", func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte("downloaded backed up server messages\n"))
+		// encrypted backup bundle of a guild, built after each daily backup run
+		s.Get("/backup/{guildID}", func(w http.ResponseWriter, r *http.Request) {
+			session, ok := auth.SessionFromContext(r.Context())
+			if !ok {
+				xhttp.Error(r.Context(), w, auth.ErrNoSessionInContext)
+				return
+			}
+			if !(session.User.IsAdmin || session.User.BackupAccess) {
+				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 403, Msg: "forbidden"})
+				return
+			}
+			guildID, err := snowflake.Parse(chi.URLParam(r, "guildID"))
+			if err != nil {
+				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: "invalid guild ID", Err: err})
+				return
+			}
+			guild, err := database.ViewGuild(a.DB, guildID)
+			if err != nil {
+				if lmdb.IsNotFound(err) {
+					xhttp.Error(r.Context(), w, &xhttp.Err{Code: 404, Msg: "not found"})
+					return
+				}
+				xhttp.Error(r.Context(), w, err)
+				return
+			}
+			// same membership check as the /settings/backups listing
+			if !slices.Contains(guild.Members, session.UserID) {
+				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 403, Msg: "forbidden"})
+				return
+			}
+			if !guild.Backup.Enabled {
+				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 404, Msg: "backups are not enabled for this server"})
+				return
+			}
+			path := backup.BundlePath(a.StorageDir, guildID)
+			if _, err := os.Stat(path); err != nil {
+				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 404, Msg: "no backup has been built yet", Err: err})
+				return
+			}
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-backup-%s.zip"`, a.Name, guildID))
+			http.ServeFile(w, r, path)
 		})
 
 		s.Get("/a", func(w http.ResponseWriter, r *http.Request) {
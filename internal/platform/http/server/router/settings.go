@@ -5,17 +5,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"maps"
 	"net/http"
+	"slices"
 	"sprout/internal/app"
 	"sprout/internal/platform/auth"
 	"sprout/internal/platform/database"
 	"sprout/internal/platform/download"
+	"sprout/internal/platform/download/extractors"
 	"sprout/internal/platform/http/server/router/css"
 	"sprout/internal/platform/http/server/router/images"
 	"sprout/internal/platform/http/server/router/js"
+	"sprout/internal/platform/linkrot"
+	"sprout/internal/platform/retention"
+	"sprout/pkg/workqueue"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Data-Corruption/lmdb-go/lmdb"
 	"github.com/Data-Corruption/stdx/xhttp"
 	"github.com/disgoorg/snowflake/v2"
 	"github.com/go-chi/chi/v5"
@@ -24,7 +32,187 @@ import (
 //go:embed templates/settings.html
 var tmplFS embed.FS
 
-var tmpl = template.Must(template.ParseFS(tmplFS, "templates/settings.html"))
+var tmpl = template.Must(template.New("settings.html").Funcs(template.FuncMap{
+	"isThread":     database.IsThread,
+	"gigabytes":    func(b int64) int64 { return b / retention.GB },
+	"domainLimits": retention.FormatDomainLimits,
+	"ytdlpHosts":   extractors.FormatYtDLPHosts,
+	"outbound": func(rs map[string]database.OutboundRoute) string {
+		return download.FormatRoutes(app.OutboundRoutes(rs))
+	},
+}).ParseFS(tmplFS, "templates/settings.html"))
+
+// hours of the day a guild's daily backup can be scheduled at
+var backupHours = func() []int {
+	hours := make([]int, 24)
+	for i := range hours {
+		hours[i] = i
+	}
+	return hours
+}()
+
+// autoExpandToggle is the settings toggle of an extractor with auto expand.
+type autoExpandToggle struct {
+	ID   string
+	Name string
+	On   bool
+}
+
+// autoExpandToggles lists the toggles of all extractors with auto expand, fallback is used
+// for extractors that were never toggled.
+func autoExpandToggles(bools database.DomainBools, fallback bool) []autoExpandToggle {
+	var toggles []autoExpandToggle
+	for _, ex := range extractors.All() {
+		if info := ex.Info(); info.AutoExpand {
+			toggles = append(toggles, autoExpandToggle{ID: info.ID, Name: info.Name, On: bools.Get(info.ID, fallback)})
+		}
+	}
+	return toggles
+}
+
+// validateAutoExpand rejects toggles of unknown extractors or ones without auto expand.
+func validateAutoExpand(body map[string]bool) error {
+	for id := range body {
+		if ex := extractors.Get(id); ex == nil || !ex.Info().AutoExpand {
+			return &xhttp.Err{Code: 400, Msg: "unknown auto expand domain: " + id}
+		}
+	}
+	return nil
+}
+
+// setAutoExpand applies validated toggles from a request body.
+func setAutoExpand(bools *database.DomainBools, body map[string]bool) {
+	if len(body) == 0 {
+		return
+	}
+	if *bools == nil {
+		*bools = database.DomainBools{}
+	}
+	for id, on := range body {
+		(*bools)[id] = on
+	}
+}
+
+// Bounds of admin queue policies, in seconds. Backoffs longer than the cap of the queue are pointless.
+const (
+	maxQueueInterval = 3600
+	minQueueBackoff  = 1
+	maxQueueBackoff  = 3600
+)
+
+// queueStatus is the policy and state of an extractor queue, durations are in seconds.
+type queueStatus struct {
+	Name        string  `json:"name"`
+	Interval    float64 `json:"interval"`
+	Jitter      float64 `json:"jitter"`
+	Backoff     float64 `json:"backoff"`
+	Overridden  bool    `json:"overridden"`  // by an admin, otherwise it's the extractors' default
+	NextBackoff float64 `json:"nextBackoff"` // applied after the next failure
+	BackoffLeft float64 `json:"backoffLeft"` // of the backoff in progress, 0 if none
+	Len         int     `json:"len"`         // queued jobs, not counting the running one
+	Running     bool    `json:"running"`
+	ReadOnly    bool    `json:"readOnly"` // a host queue, its policy follows its extractor queue
+}
+
+// queueStatuses lists the extractor queues in registration order, followed by the per host
+// queues created so far sorted by name.
+func queueStatuses(a *app.App, overrides map[string]database.QueuePolicy) []queueStatus {
+	var statuses []queueStatus
+	for _, p := range extractors.Queues() {
+		_, overridden := overrides[p.Name]
+		statuses = append(statuses, newQueueStatus(p.Name, a.ExtractorQueues[p.Name], overridden))
+	}
+	hostQueues := a.HostQueues()
+	for _, name := range slices.Sorted(maps.Keys(hostQueues)) {
+		status := newQueueStatus(name, hostQueues[name], false)
+		status.ReadOnly = true
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// newQueueStatus reads the policy and state of a queue.
+func newQueueStatus(name string, q *workqueue.Queue, overridden bool) queueStatus {
+	stats := q.Stats()
+	return queueStatus{
+		Name:        name,
+		Interval:    stats.Interval.Seconds(),
+		Jitter:      stats.Jitter.Seconds(),
+		Backoff:     stats.Backoff.Seconds(),
+		Overridden:  overridden,
+		NextBackoff: stats.NextBackoff.Seconds(),
+		BackoffLeft: stats.BackoffLeft.Seconds(),
+		Len:         q.Len(),
+		Running:     stats.Running,
+	}
+}
+
+// queuePolicyBody is a partial update of a queue policy, in seconds.
+type queuePolicyBody struct {
+	Interval *float64 `json:"interval"`
+	Jitter   *float64 `json:"jitter"`
+	Backoff  *float64 `json:"backoff"`
+}
+
+// validateQueuePolicies rejects updates of unknown queues or with values out of bounds.
+func validateQueuePolicies(body map[string]*queuePolicyBody) error {
+	known := make(map[string]bool)
+	for _, p := range extractors.Queues() {
+		known[p.Name] = true
+	}
+	for name, p := range body {
+		if !known[name] {
+			return &xhttp.Err{Code: 400, Msg: "unknown queue: " + name}
+		}
+		if p == nil {
+			continue
+		}
+		if p.Interval != nil && (*p.Interval < 0 || *p.Interval > maxQueueInterval) {
+			return &xhttp.Err{Code: 400, Msg: fmt.Sprintf("queue interval must be between 0 and %d seconds", maxQueueInterval)}
+		}
+		if p.Jitter != nil && (*p.Jitter < 0 || *p.Jitter > maxQueueInterval) {
+			return &xhttp.Err{Code: 400, Msg: fmt.Sprintf("queue jitter must be between 0 and %d seconds", maxQueueInterval)}
+		}
+		if p.Backoff != nil && (*p.Backoff < minQueueBackoff || *p.Backoff > maxQueueBackoff) {
+			return &xhttp.Err{Code: 400, Msg: fmt.Sprintf("queue backoff must be between %d and %d seconds", minQueueBackoff, maxQueueBackoff)}
+		}
+	}
+	return nil
+}
+
+// setQueuePolicies applies validated updates from a request body, a null policy goes back to the default.
+func setQueuePolicies(policies *map[string]database.QueuePolicy, body map[string]*queuePolicyBody) {
+	if len(body) == 0 {
+		return
+	}
+	if *policies == nil {
+		*policies = make(map[string]database.QueuePolicy)
+	}
+	for _, def := range extractors.Queues() {
+		update, ok := body[def.Name]
+		if !ok {
+			continue
+		}
+		if update == nil {
+			delete(*policies, def.Name)
+			continue
+		}
+		p, ok := (*policies)[def.Name]
+		if !ok {
+			p = database.QueuePolicy{Interval: def.Interval.Seconds(), Jitter: def.Jitter.Seconds(), Backoff: def.Backoff.Seconds()}
+		}
+		if update.Interval != nil {
+			p.Interval = *update.Interval
+		}
+		if update.Jitter != nil {
+			p.Jitter = *update.Jitter
+		}
+		if update.Backoff != nil {
+			p.Backoff = *update.Backoff
+		}
+		(*policies)[def.Name] = p
+	}
+}
 
 // RestartBody is the body of POST /settings/restart requests.
 type RestartBody struct {
@@ -92,6 +280,7 @@ func settingsRoutes(a *app.App, r *chi.Mux) {
 				"Version":         a.Version,
 				"UpdateAvailable": cfg.UpdateAvailable && (a.Version != "vX.X.X"),
 				"User":            session.User,
+				"AutoExpand":      autoExpandToggles(session.User.AutoExpand, true),
 				"AvatarURL":       template.URL(avatarURL),
 				// Admin config fields
 				"LogLevel":          cfg.LogLevel,
@@ -99,10 +288,15 @@ func settingsRoutes(a *app.App, r *chi.Mux) {
 				"Host":              cfg.Host,
 				"ProxyPort":         cfg.ProxyPort,
 				"OllamaURL":         cfg.OllamaURL,
+				"XitterAPIURL":      cfg.XitterAPIURL,
+				"YtDLPHosts":        cfg.YtDLPHosts,
 				"HWAccel":           a.Compressor.GetHWAccel().String(),
-				"DisableAutoExpand": cfg.DisableAutoExpand,
+				"DisableAutoExpand": autoExpandToggles(cfg.DisableAutoExpand, false),
+				"Queues":            queueStatuses(a, cfg.QueuePolicies),
+				"Outbound":          cfg.Outbound,
 				// Guild management
-				"Guilds": guilds,
+				"Guilds":      guilds,
+				"BackupHours": backupHours,
 				// User management
 				"Users": users,
 			}
@@ -126,45 +320,42 @@ func settingsRoutes(a *app.App, r *chi.Mux) {
 
 			// Parse body - all fields are optional
 			var body struct {
-				BackupOptOut *bool `json:"backupOptOut"`
-				AiChatOptOut *bool `json:"aiChatOptOut"`
-				AutoExpand   *struct {
-					Reddit        *bool `json:"reddit"`
-					YouTubeShorts *bool `json:"youTubeShorts"`
-					RedGifs       *bool `json:"redGifs"`
-				} `json:"autoExpand"`
+				BackupOptOut *bool           `json:"backupOptOut"`
+				AiChatOptOut *bool           `json:"aiChatOptOut"`
+				AutoExpand   map[string]bool `json:"autoExpand"` // by extractor ID
 			}
 			dec := json.NewDecoder(r.Body)
 			if err := dec.Decode(&body); err != nil {
 				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: "bad request", Err: err})
 				return
 			}
+			if err := validateAutoExpand(body.AutoExpand); err != nil {
+				xhttp.Error(r.Context(), w, err)
+				return
+			}
 
 			// Update only the fields that were provided
+			optedOut := false
 			if _, err := database.UpsertUser(a.DB, session.UserID, func(user *database.User) error {
 				if body.BackupOptOut != nil {
+					optedOut = *body.BackupOptOut && !user.BackupOptOut
 					user.BackupOptOut = *body.BackupOptOut
 				}
 				if body.AiChatOptOut != nil {
 					user.AiChatOptOut = *body.AiChatOptOut
 				}
-				if body.AutoExpand != nil {
-					if body.AutoExpand.Reddit != nil {
-						user.AutoExpand.Reddit = *body.AutoExpand.Reddit
-					}
-					if body.AutoExpand.YouTubeShorts != nil {
-						user.AutoExpand.YouTubeShorts = *body.AutoExpand.YouTubeShorts
-					}
-					if body.AutoExpand.RedGifs != nil {
-						user.AutoExpand.RedGifs = *body.AutoExpand.RedGifs
-					}
-				}
+				setAutoExpand(&user.AutoExpand, body.AutoExpand)
 				return nil
 			}); err != nil {
 				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 500, Msg: "failed to update user", Err: err})
 				return
 			}
 
+			// remove what was already archived
+			if optedOut {
+				a.Backup.PurgeUser(session.UserID)
+			}
+
 			w.WriteHeader(http.StatusOK)
 		})
 
@@ -185,9 +376,14 @@ func settingsRoutes(a *app.App, r *chi.Mux) {
 
 			// Response struct for each guild backup
 			type GuildBackupInfo struct {
-				GuildName    string `json:"guildName"`
-				DownloadLink string `json:"downloadLink"`
-				LastRun      string `json:"lastRun"` // ISO 8601 format or empty
+				GuildName     string `json:"guildName"`
+				DownloadLink  string `json:"downloadLink"`
+				LastRun       string `json:"lastRun"` // ISO 8601 format or empty
+				Running       bool   `json:"running"` // the progress fields are of the run in progress instead of the last one
+				ChannelsDone  int    `json:"channelsDone"`
+				ChannelsTotal int    `json:"channelsTotal"`
+				Messages      int    `json:"messages"`
+				Errors        int    `json:"errors"`
 			}
 
 			var backups []GuildBackupInfo
@@ -238,9 +434,14 @@ func settingsRoutes(a *app.App, r *chi.Mux) {
 				}
 
 				backups = append(backups, GuildBackupInfo{
-					GuildName:    guild.Name,
-					DownloadLink: downloadLink,
-					LastRun:      lastRunStr,
+					GuildName:     guild.Name,
+					DownloadLink:  downloadLink,
+					LastRun:       lastRunStr,
+					Running:       guild.Backup.RunID != "",
+					ChannelsDone:  guild.Backup.Progress.ChannelsDone,
+					ChannelsTotal: guild.Backup.Progress.ChannelsTotal,
+					Messages:      guild.Backup.Progress.Messages,
+					Errors:        guild.Backup.Progress.Errors,
 				})
 			}
 
@@ -251,6 +452,124 @@ func settingsRoutes(a *app.App, r *chi.Mux) {
 			}
 		})
 
+		// Search the archive of guilds the user is a member of.
+		// Query params: q (required), guild, channel, author, after, before (YYYY-MM-DD), limit
+		s.Get("/search", func(w http.ResponseWriter, r *http.Request) {
+			defer r.Body.Close()
+
+			session, ok := auth.SessionFromContext(r.Context())
+			if !ok {
+				xhttp.Error(r.Context(), w, auth.ErrNoSessionInContext)
+				return
+			}
+			if !(session.User.IsAdmin || session.User.BackupAccess) {
+				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 403, Msg: "forbidden"})
+				return
+			}
+
+			params := r.URL.Query()
+			query := database.SearchQuery{Text: params.Get("q")}
+			parseID := func(name string) (snowflake.ID, bool) {
+				if params.Get(name) == "" {
+					return 0, true
+				}
+				id, err := snowflake.Parse(params.Get(name))
+				if err != nil {
+					xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: "invalid " + name, Err: err})
+					return 0, false
+				}
+				return id, true
+			}
+			parseDate := func(name string) (time.Time, bool) {
+				if params.Get(name) == "" {
+					return time.Time{}, true
+				}
+				t, err := time.Parse("2006-01-02", params.Get(name))
+				if err != nil {
+					xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: "invalid " + name + ", use YYYY-MM-DD", Err: err})
+					return time.Time{}, false
+				}
+				return t, true
+			}
+			guildID, ok := parseID("guild")
+			if !ok {
+				return
+			}
+			if query.ChannelID, ok = parseID("channel"); !ok {
+				return
+			}
+			if query.AuthorID, ok = parseID("author"); !ok {
+				return
+			}
+			if query.After, ok = parseDate("after"); !ok {
+				return
+			}
+			if query.Before, ok = parseDate("before"); !ok {
+				return
+			}
+			if !query.Before.IsZero() {
+				query.Before = query.Before.Add(24*time.Hour - time.Nanosecond) // inclusive
+			}
+			if l := params.Get("limit"); l != "" {
+				limit, err := strconv.Atoi(l)
+				if err != nil || limit < 1 || limit > 100 {
+					xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: "limit must be between 1 and 100", Err: err})
+					return
+				}
+				query.Limit = limit
+			}
+
+			// only guilds the user is a member of, same as the backups listing
+			guilds, err := database.ViewGuilds(a.DB)
+			if err != nil {
+				xhttp.Error(r.Context(), w, err)
+				return
+			}
+			for id, guild := range guilds {
+				if (guildID == 0 || guildID == id) && slices.Contains(guild.Members, session.UserID) {
+					query.GuildIDs = append(query.GuildIDs, id)
+				}
+			}
+
+			result, err := database.Search(a.DB, query)
+			if err != nil {
+				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: err.Error(), Err: err})
+				return
+			}
+
+			type SearchResult struct {
+				ID        snowflake.ID `json:"id"`
+				GuildID   snowflake.ID `json:"guildID"`
+				ChannelID snowflake.ID `json:"channelID"`
+				AuthorID  snowflake.ID `json:"authorID"`
+				Author    string       `json:"author"`
+				Content   string       `json:"content"`
+				Created   string       `json:"created"` // RFC3339
+				Link      string       `json:"link"`
+			}
+			resp := struct {
+				Total   int            `json:"total"`
+				Results []SearchResult `json:"results"`
+			}{Total: result.Total, Results: []SearchResult{}}
+			for _, msg := range result.Messages {
+				resp.Results = append(resp.Results, SearchResult{
+					ID:        msg.ID,
+					GuildID:   msg.GuildID,
+					ChannelID: msg.ChannelID,
+					AuthorID:  msg.AuthorID,
+					Author:    msg.Author,
+					Content:   msg.Content,
+					Created:   msg.Created.Format(time.RFC3339),
+					Link:      fmt.Sprintf("https://discord.com/channels/%s/%s/%s", msg.GuildID, msg.ChannelID, msg.ID),
+				})
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(resp); err != nil {
+				xhttp.Error(r.Context(), w, err)
+			}
+		})
+
 		// admin only routes.
 		adminSettingsRoutes(a, s)
 	})
@@ -334,26 +653,56 @@ func adminSettingsRoutes(a *app.App, r chi.Router) {
 
 			// Parse body - all fields are optional
 			var body struct {
-				LogLevel          *string `json:"logLevel"`
-				Host              *string `json:"host"`
-				Port              *int    `json:"port"`
-				ProxyPort         *int    `json:"proxyPort"`
-				BotToken          *string `json:"botToken"`
-				OllamaURL         *string `json:"ollamaURL"`
-				SystemPrompt      *string `json:"systemPrompt"`
-				DisableAutoExpand *struct {
-					Reddit        *bool `json:"reddit"`
-					RedGifs       *bool `json:"redGifs"`
-					YouTubeShorts *bool `json:"youTubeShorts"`
-				} `json:"disableAutoExpand"`
+				LogLevel          *string                     `json:"logLevel"`
+				Host              *string                     `json:"host"`
+				Port              *int                        `json:"port"`
+				ProxyPort         *int                        `json:"proxyPort"`
+				BotToken          *string                     `json:"botToken"`
+				OllamaURL         *string                     `json:"ollamaURL"`
+				XitterAPIURL      *string                     `json:"xitterAPIURL"`
+				YtDLPHosts        *string                     `json:"ytdlpHosts"` // e.g. "tiktok.com=10, vimeo.com"
+				SystemPrompt      *string                     `json:"systemPrompt"`
+				DisableAutoExpand map[string]bool             `json:"disableAutoExpand"` // by extractor ID
+				QueuePolicies     map[string]*queuePolicyBody `json:"queuePolicies"`     // by queue name, null = default
+				Outbound          *string                     `json:"outbound"`          // one domain per line, see download.ParseRoutes
 			}
 			dec := json.NewDecoder(r.Body)
 			if err := dec.Decode(&body); err != nil {
 				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: "bad request", Err: err})
 				return
 			}
+			if err := validateAutoExpand(body.DisableAutoExpand); err != nil {
+				xhttp.Error(r.Context(), w, err)
+				return
+			}
+			if err := validateQueuePolicies(body.QueuePolicies); err != nil {
+				xhttp.Error(r.Context(), w, err)
+				return
+			}
+			var outbound map[string]download.Route
+			if body.Outbound != nil {
+				// redacted proxy passwords are kept from the current routes
+				cfg, err := database.ViewConfig(a.DB)
+				if err != nil {
+					xhttp.Error(r.Context(), w, err)
+					return
+				}
+				if outbound, err = download.ParseRoutes(*body.Outbound, app.OutboundRoutes(cfg.Outbound)); err != nil {
+					xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: err.Error(), Err: err})
+					return
+				}
+			}
+			var ytdlpHosts map[string]int
+			if body.YtDLPHosts != nil {
+				var err error
+				if ytdlpHosts, err = extractors.ParseYtDLPHosts(*body.YtDLPHosts); err != nil {
+					xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: err.Error(), Err: err})
+					return
+				}
+			}
 
 			// Update only the fields that were provided
+			var queuePolicies map[string]database.QueuePolicy
 			if err := database.UpdateConfig(a.DB, func(cfg *database.Configuration) error {
 				if body.LogLevel != nil {
 					cfg.LogLevel = *body.LogLevel
@@ -373,23 +722,37 @@ func adminSettingsRoutes(a *app.App, r chi.Router) {
 				if body.OllamaURL != nil {
 					cfg.OllamaURL = *body.OllamaURL
 				}
-				if body.DisableAutoExpand != nil {
-					if body.DisableAutoExpand.Reddit != nil {
-						cfg.DisableAutoExpand.Reddit = *body.DisableAutoExpand.Reddit
-					}
-					if body.DisableAutoExpand.RedGifs != nil {
-						cfg.DisableAutoExpand.RedGifs = *body.DisableAutoExpand.RedGifs
-					}
-					if body.DisableAutoExpand.YouTubeShorts != nil {
-						cfg.DisableAutoExpand.YouTubeShorts = *body.DisableAutoExpand.YouTubeShorts
+				if body.XitterAPIURL != nil {
+					cfg.XitterAPIURL = *body.XitterAPIURL
+				}
+				if body.YtDLPHosts != nil {
+					cfg.YtDLPHosts = ytdlpHosts
+				}
+				setAutoExpand(&cfg.DisableAutoExpand, body.DisableAutoExpand)
+				setQueuePolicies(&cfg.QueuePolicies, body.QueuePolicies)
+				if body.Outbound != nil {
+					cfg.Outbound = make(map[string]database.OutboundRoute, len(outbound))
+					for domain, route := range outbound {
+						cfg.Outbound[domain] = database.OutboundRoute(route)
 					}
 				}
+				queuePolicies = cfg.QueuePolicies
 				return nil
 			}); err != nil {
 				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 500, Msg: "failed to update config", Err: err})
 				return
 			}
 
+			if body.YtDLPHosts != nil {
+				extractors.SetYtDLPHosts(ytdlpHosts)
+			}
+			if len(body.QueuePolicies) > 0 {
+				a.SetQueuePolicies(queuePolicies)
+			}
+			if body.Outbound != nil {
+				download.SetRoutes(outbound)
+			}
+
 			w.WriteHeader(http.StatusOK)
 		})
 
@@ -428,11 +791,16 @@ func adminSettingsRoutes(a *app.App, r chi.Router) {
 				SynctubeURL    *string       `json:"synctubeURL"`
 				BackupPassword *string       `json:"backupPassword"`
 				BackupEnabled  *bool         `json:"backupEnabled"`
+				BackupHour     *string       `json:"backupHour"` // from a select, "0" to "23"
 				AntiRotEnabled *bool         `json:"antiRotEnabled"`
 				AiChatEnabled  *bool         `json:"aiChatEnabled"`
 				SystemPrompt   *string       `json:"systemPrompt"`
 				BotChannelID   *snowflake.ID `json:"botChannelID"`
 				FavChannelID   *snowflake.ID `json:"favChannelID"`
+				// retention, zero means no limit
+				RetentionMaxAgeDays *int    `json:"retentionMaxAgeDays"`
+				RetentionMaxGB      *int    `json:"retentionMaxGB"`
+				RetentionDomains    *string `json:"retentionDomains"` // "domain=GB, ..."
 			}
 			dec := json.NewDecoder(r.Body)
 			if err := dec.Decode(&body); err != nil {
@@ -440,6 +808,26 @@ func adminSettingsRoutes(a *app.App, r chi.Router) {
 				return
 			}
 
+			backupHour := -1
+			if body.BackupHour != nil {
+				if backupHour, err = strconv.Atoi(*body.BackupHour); err != nil || backupHour < 0 || backupHour > 23 {
+					xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: "backup hour must be 0-23"})
+					return
+				}
+			}
+
+			if (body.RetentionMaxAgeDays != nil && *body.RetentionMaxAgeDays < 0) || (body.RetentionMaxGB != nil && *body.RetentionMaxGB < 0) {
+				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: "retention limits can't be negative"})
+				return
+			}
+			var domainLimits map[string]int64
+			if body.RetentionDomains != nil {
+				if domainLimits, err = retention.ParseDomainLimits(*body.RetentionDomains); err != nil {
+					xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: err.Error(), Err: err})
+					return
+				}
+			}
+
 			// Update only the fields that were provided
 			if _, err := database.UpsertGuild(a.DB, guildID, func(guild *database.Guild) error {
 				if body.SynctubeURL != nil {
@@ -451,6 +839,9 @@ func adminSettingsRoutes(a *app.App, r chi.Router) {
 				if body.BackupEnabled != nil {
 					guild.Backup.Enabled = *body.BackupEnabled
 				}
+				if backupHour != -1 {
+					guild.Backup.Hour = backupHour
+				}
 				if body.AntiRotEnabled != nil {
 					guild.AntiRotEnabled = *body.AntiRotEnabled
 				}
@@ -463,6 +854,15 @@ func adminSettingsRoutes(a *app.App, r chi.Router) {
 				if body.FavChannelID != nil {
 					guild.FavChannelID = *body.FavChannelID
 				}
+				if body.RetentionMaxAgeDays != nil {
+					guild.Retention.MaxAgeDays = *body.RetentionMaxAgeDays
+				}
+				if body.RetentionMaxGB != nil {
+					guild.Retention.MaxBytes = int64(*body.RetentionMaxGB) * retention.GB
+				}
+				if body.RetentionDomains != nil {
+					guild.Retention.DomainMaxBytes = domainLimits
+				}
 				return nil
 			}); err != nil {
 				xhttp.Error(r.Context(), w, &xhttp.Err{Code: 500, Msg: "failed to update guild", Err: err})
@@ -570,5 +970,139 @@ func adminSettingsRoutes(a *app.App, r chi.Router) {
 
 			w.WriteHeader(http.StatusOK)
 		})
+
+		// Dry run of the retention policies, what the enforcer would evict right now.
+		admin.Get("/retention/report", func(w http.ResponseWriter, r *http.Request) {
+			report, err := retention.Plan(a.DB, time.Now())
+			if err != nil {
+				xhttp.Error(r.Context(), w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(report); err != nil {
+				xhttp.Error(r.Context(), w, err)
+			}
+		})
+
+		// State of the sources of stored assets as last probed by the link rot monitor.
+		admin.Get("/linkrot/report", func(w http.ResponseWriter, r *http.Request) {
+			report, err := linkrot.BuildReport(a.DB, time.Now())
+			if err != nil {
+				xhttp.Error(r.Context(), w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(report); err != nil {
+				xhttp.Error(r.Context(), w, err)
+			}
+		})
+
+		// Policy and state of the extractor queues, polled by the admin tab.
+		admin.Get("/queues", func(w http.ResponseWriter, r *http.Request) {
+			cfg, err := database.ViewConfig(a.DB)
+			if err != nil {
+				xhttp.Error(r.Context(), w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(queueStatuses(a, cfg.QueuePolicies)); err != nil {
+				xhttp.Error(r.Context(), w, err)
+			}
+		})
+
+		// Revision history of edited and deleted archived messages, newest first.
+		// Query params: message (ID or message link, looks up just that message), limit
+		admin.Get("/archive/revisions", func(w http.ResponseWriter, r *http.Request) {
+			var msgs []database.ArchivedMessage
+			if ref := strings.TrimSpace(r.URL.Query().Get("message")); ref != "" {
+				// links end with the message ID
+				id, err := snowflake.Parse(ref[strings.LastIndex(ref, "/")+1:])
+				if err != nil {
+					xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: "invalid message ID or link", Err: err})
+					return
+				}
+				msg, err := database.ViewArchivedMessage(a.DB, id)
+				if err != nil {
+					if lmdb.IsNotFound(err) {
+						xhttp.Error(r.Context(), w, &xhttp.Err{Code: 404, Msg: "message is not archived"})
+						return
+					}
+					xhttp.Error(r.Context(), w, err)
+					return
+				}
+				msgs = append(msgs, *msg)
+			} else {
+				limit := 50
+				if l := r.URL.Query().Get("limit"); l != "" {
+					var err error
+					if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > 200 {
+						xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: "limit must be between 1 and 200", Err: err})
+						return
+					}
+				}
+				var err error
+				if msgs, err = database.ViewRevisedMessages(a.DB, limit); err != nil {
+					xhttp.Error(r.Context(), w, err)
+					return
+				}
+			}
+
+			type Revision struct {
+				Content     string   `json:"content"`
+				Attachments []string `json:"attachments"` // filenames
+				Edited      string   `json:"edited"`      // RFC3339, empty for the original
+			}
+			type RevisedMessage struct {
+				ID        snowflake.ID `json:"id"`
+				ChannelID snowflake.ID `json:"channelID"`
+				Channel   string       `json:"channel"`
+				Author    string       `json:"author"`
+				Created   string       `json:"created"` // RFC3339
+				Deleted   string       `json:"deleted"` // RFC3339, empty if not deleted
+				Redacted  bool         `json:"redacted"`
+				Link      string       `json:"link"`
+				Revisions []Revision   `json:"revisions"` // oldest first, the last one is the current version
+			}
+			formatTime := func(t *time.Time) string {
+				if t == nil {
+					return ""
+				}
+				return t.Format(time.RFC3339)
+			}
+			revision := func(content string, attachments []database.ArchivedAttachment, edited *time.Time) Revision {
+				rev := Revision{Content: content, Attachments: []string{}, Edited: formatTime(edited)}
+				for _, att := range attachments {
+					rev.Attachments = append(rev.Attachments, att.Filename)
+				}
+				return rev
+			}
+
+			resp := []RevisedMessage{}
+			for _, msg := range msgs {
+				rm := RevisedMessage{
+					ID:        msg.ID,
+					ChannelID: msg.ChannelID,
+					Channel:   msg.ChannelID.String(),
+					Author:    msg.Author,
+					Created:   msg.Created.Format(time.RFC3339),
+					Deleted:   formatTime(msg.Deleted),
+					Redacted:  msg.Redacted,
+					Link:      fmt.Sprintf("https://discord.com/channels/%s/%s/%s", msg.GuildID, msg.ChannelID, msg.ID),
+				}
+				if ch, err := database.ViewChannel(a.DB, msg.ChannelID); err == nil {
+					rm.Channel = ch.Name
+				}
+				for _, rev := range msg.Revisions {
+					rm.Revisions = append(rm.Revisions, revision(rev.Content, rev.Attachments, rev.Edited))
+				}
+				rm.Revisions = append(rm.Revisions, revision(msg.Content, msg.Attachments, msg.Edited))
+				resp = append(resp, rm)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(resp); err != nil {
+				xhttp.Error(r.Context(), w, err)
+			}
+		})
 	})
 }
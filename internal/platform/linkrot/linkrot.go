@@ -0,0 +1,268 @@
+// Package linkrot re-checks the sources of stored assets in the background and records which are gone,
+// so the mirror can be pointed out once it's the only copy left.
+package linkrot
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/download"
+	"sprout/internal/platform/download/extractors"
+	"sprout/pkg/workqueue"
+	"sync"
+	"time"
+
+	"github.com/Data-Corruption/lmdb-go/wrap"
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+const (
+	StepInterval = time.Minute        // how often idle queues are handed a probe
+	PlanInterval = time.Hour          // how often the assets due for a probe are looked up
+	RecheckAge   = 7 * 24 * time.Hour // how long a probe result is trusted
+	ReportLimit  = 200                // dead sources listed in a report, most recent deaths first
+
+	probePrefix = "linkrot:" // queue job id prefix, so probes never block a download of the same link
+)
+
+// probe is an asset due for a check.
+type probe struct {
+	url     string
+	ex      extractors.Extractor
+	checked time.Time
+}
+
+// Monitor probes the sources of stored assets through the extractor queues. A queue is only handed
+// a probe while it's idle, one at a time, so probing never delays downloads by more than one job.
+type Monitor struct {
+	db        *wrap.DB
+	log       *xlog.Logger
+	userAgent string
+	queue     func(ex extractors.Extractor, rawURL string) *workqueue.Queue
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeWG   *sync.WaitGroup
+
+	mu      sync.Mutex
+	due     map[string][]probe // by queue name, oldest check first
+	busy    map[string]bool    // queues with a probe queued or running
+	planned time.Time
+}
+
+// NewMonitor creates a monitor that probes through the queues returned by queue.
+func NewMonitor(db *wrap.DB, log *xlog.Logger, userAgent string, queue func(ex extractors.Extractor, rawURL string) *workqueue.Queue) *Monitor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Monitor{
+		db:        db,
+		log:       log,
+		userAgent: userAgent,
+		queue:     queue,
+		ctx:       ctx,
+		cancel:    cancel,
+		closeWG:   &sync.WaitGroup{},
+		due:       make(map[string][]probe),
+		busy:      make(map[string]bool),
+	}
+}
+
+// Start begins probing, the first step runs after a minute so startup isn't slowed down.
+func (m *Monitor) Start() {
+	m.closeWG.Add(1)
+	go func() {
+		defer m.closeWG.Done()
+		timer := time.NewTimer(time.Minute)
+		defer timer.Stop()
+		for {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-timer.C:
+				m.step(time.Now())
+				timer.Reset(StepInterval)
+			}
+		}
+	}()
+}
+
+// Close stops the monitor. A probe in progress is cancelled, its queue finishes it.
+func (m *Monitor) Close() error {
+	m.cancel()
+	m.closeWG.Wait()
+	return nil
+}
+
+// step replans when due and hands every idle queue its next probe.
+func (m *Monitor) step(now time.Time) {
+	m.mu.Lock()
+	stale := len(m.due) == 0 && now.Sub(m.planned) >= PlanInterval
+	m.mu.Unlock()
+	if stale {
+		due, err := plan(m.db, now)
+		if err != nil {
+			m.log.Errorf("linkrot: failed to plan: %v", err)
+			return
+		}
+		m.mu.Lock()
+		m.due, m.planned = due, now
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, probes := range m.due {
+		q := m.queue(probes[0].ex, probes[0].url)
+		if q == nil || m.busy[name] || q.Len() > 0 {
+			continue
+		}
+		p := probes[0]
+		if len(probes) == 1 {
+			delete(m.due, name)
+		} else {
+			m.due[name] = probes[1:]
+		}
+		m.busy[name] = true
+		if !q.Enqueue(probePrefix+p.url, false, func() error {
+			defer m.done(name)
+			return m.check(p.url, p.ex)
+		}) {
+			m.busy[name] = false
+		}
+	}
+}
+
+func (m *Monitor) done(queue string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.busy[queue] = false
+}
+
+// plan returns the assets due for a probe by queue name, never probed and oldest checks first.
+// Deleted sources don't come back and aren't probed again.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func plan(db *wrap.DB, now time.Time) (map[string][]probe, error) {
+	due := make(map[string][]probe)
+	if err := database.ViewAssets(db, func(url string, asset *database.Asset) error {
+		if asset.Source == database.SourceDeleted || now.Sub(asset.SourceChecked) < RecheckAge {
+			return nil
+		}
+		ex := extractors.Find(url)
+		if ex == nil {
+			return nil // attachments and sites that are no longer supported
+		}
+		name := ex.Info().Queue.Name
+		due[name] = append(due[name], probe{url: url, ex: ex, checked: asset.SourceChecked})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for _, probes := range due {
+		slices.SortFunc(probes, func(a, b probe) int { return a.checked.Compare(b.checked) })
+	}
+	return due, nil
+}
+
+// check probes the source of an asset and records the result, url is the canonical url the asset
+// is stored under. Only rate limiting is returned, so the queue backs off for the site without
+// other probe failures slowing down downloads.
+func (m *Monitor) check(url string, ex extractors.Extractor) error {
+	err := extractors.Probe(m.ctx, ex, url, m.userAgent)
+	if m.ctx.Err() != nil {
+		return nil
+	}
+	if err != nil && !errors.As(err, new(*extractors.RemovedError)) && !errors.Is(err, extractors.ErrNotProbed) {
+		if errors.Is(err, download.ErrTooManyRequests) {
+			return err
+		}
+		m.log.Debugf("linkrot: probe of %s failed, retrying next plan: %v", url, err)
+		return nil
+	}
+
+	// evicted assets are left alone
+	if _, err := database.UpdateAsset(m.db, url, func(asset *database.Asset) error {
+		if record(asset, err, time.Now()) {
+			m.log.Infof("linkrot: source of %s is %s (%s)", url, asset.Source, asset.SourceReason)
+		}
+		return nil
+	}); err != nil {
+		m.log.Errorf("linkrot: failed to record probe of %s: %v", url, err)
+	}
+	return nil
+}
+
+// record applies the result of a probe, nil, a *extractors.RemovedError or extractors.ErrNotProbed,
+// to an asset. Sources that can't be checked are unknown. Returns whether the source changed state.
+func record(asset *database.Asset, err error, now time.Time) bool {
+	prev := asset.Source
+	asset.SourceChecked = now
+	var removed *extractors.RemovedError
+	if errors.Is(err, extractors.ErrNotProbed) {
+		asset.Source, asset.SourceReason, asset.SourceDied = database.SourceUnknown, "", time.Time{}
+		return false
+	} else if errors.As(err, &removed) {
+		asset.Source, asset.SourceReason = database.SourceRemoved, removed.Reason
+		if removed.Deleted {
+			asset.Source = database.SourceDeleted
+		}
+		if asset.SourceDied.IsZero() {
+			asset.SourceDied = now
+		}
+	} else {
+		asset.Source, asset.SourceReason, asset.SourceDied = database.SourceAlive, "", time.Time{}
+	}
+	return prev != asset.Source && !(prev == database.SourceUnknown && asset.Source == database.SourceAlive)
+}
+
+// DeadSource is an asset whose source is gone.
+type DeadSource struct {
+	URL      string               `json:"url"`
+	State    database.SourceState `json:"state"`
+	Reason   string               `json:"reason"`
+	Died     time.Time            `json:"died"`
+	Favorite bool                 `json:"favorite"`
+}
+
+// Report is the state of the probed sources.
+type Report struct {
+	Generated time.Time    `json:"generated"`
+	Alive     int          `json:"alive"`
+	Dead      int          `json:"dead"`
+	Unchecked int          `json:"unchecked"` // not probed yet, attachments and unsupported sites excluded
+	Sources   []DeadSource `json:"sources"`   // most recent deaths first, up to ReportLimit
+}
+
+// BuildReport counts the sources by state and lists the dead ones.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (deadlock risk).
+func BuildReport(db *wrap.DB, now time.Time) (*Report, error) {
+	report := &Report{Generated: now, Sources: []DeadSource{}}
+	if err := database.ViewAssets(db, func(url string, asset *database.Asset) error {
+		switch {
+		case asset.Dead():
+			report.Dead++
+			report.Sources = append(report.Sources, DeadSource{
+				URL:      url,
+				State:    asset.Source,
+				Reason:   asset.SourceReason,
+				Died:     asset.SourceDied,
+				Favorite: asset.Favorite,
+			})
+		case asset.Source == database.SourceAlive:
+			report.Alive++
+		case extractors.Find(url) != nil:
+			report.Unchecked++
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(report.Sources, func(a, b DeadSource) int {
+		return cmp.Or(b.Died.Compare(a.Died), cmp.Compare(a.URL, b.URL))
+	})
+	if len(report.Sources) > ReportLimit {
+		report.Sources = report.Sources[:ReportLimit]
+	}
+	return report, nil
+}
@@ -0,0 +1,208 @@
+package linkrot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/download"
+	"sprout/internal/platform/download/extractors"
+	"sprout/pkg/workqueue"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/lmdb-go/wrap"
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+// fakeExtractor answers every probe with err.
+type fakeExtractor struct{ err error }
+
+func (fakeExtractor) Info() extractors.Info { return extractors.Info{ID: "fake"} }
+func (fakeExtractor) Match(string) bool     { return true }
+func (f fakeExtractor) Extract(context.Context, string, string) (extractors.Result, string, error) {
+	return extractors.Result{}, "", f.err
+}
+
+func testMonitor(t *testing.T) (*Monitor, *wrap.DB) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewMonitor(db, logger, "test-agent", func(extractors.Extractor, string) *workqueue.Queue { return nil }), db
+}
+
+func putAsset(t *testing.T, db *wrap.DB, url string, fn func(asset *database.Asset)) {
+	t.Helper()
+	if _, err := database.UpsertAsset(db, url, func(asset *database.Asset) error {
+		asset.Path = "/assets/" + filepath.Base(url) + ".mp4"
+		fn(asset)
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to put asset: %v", err)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	day1 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	var asset database.Asset
+
+	if record(&asset, nil, day1) || asset.Source != database.SourceAlive {
+		t.Errorf("First alive probe should be quiet, got %+v", asset)
+	}
+	if !record(&asset, &extractors.RemovedError{Reason: "private"}, day1) || asset.Source != database.SourceRemoved ||
+		asset.SourceReason != "private" || !asset.SourceDied.Equal(day1) || !asset.Dead() {
+		t.Errorf("Expected removed since day 1, got %+v", asset)
+	}
+	// time of death is kept when a removal turns into a deletion
+	wrapped := errors.Join(errors.New("context"), &extractors.RemovedError{Deleted: true, Reason: "not_found"})
+	if !record(&asset, wrapped, day2) || asset.Source != database.SourceDeleted || !asset.SourceDied.Equal(day1) ||
+		!asset.SourceChecked.Equal(day2) {
+		t.Errorf("Expected deleted since day 1, got %+v", asset)
+	}
+	// restored
+	if !record(&asset, nil, day2) || asset.Source != database.SourceAlive || !asset.SourceDied.IsZero() || asset.SourceReason != "" {
+		t.Errorf("Expected alive again, got %+v", asset)
+	}
+	// a source the extractor can't check isn't taken for alive
+	notProbed := fmt.Errorf("%w: forbidden", extractors.ErrNotProbed)
+	if record(&asset, notProbed, day2) || asset.Source != database.SourceUnknown || !asset.SourceChecked.Equal(day2) {
+		t.Errorf("Expected unknown source, got %+v", asset)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	_, db := testMonitor(t)
+	now := time.Now()
+	const (
+		never   = "https://www.reddit.com/r/pics/comments/never/"
+		old     = "https://www.reddit.com/r/pics/comments/old/"
+		older   = "https://www.reddit.com/r/pics/comments/older/"
+		fresh   = "https://www.reddit.com/r/pics/comments/fresh/"
+		deleted = "https://www.reddit.com/r/pics/comments/deleted/"
+	)
+	putAsset(t, db, old, func(a *database.Asset) { a.Source, a.SourceChecked = database.SourceAlive, now.Add(-8*24*time.Hour) })
+	putAsset(t, db, older, func(a *database.Asset) { a.Source, a.SourceChecked = database.SourceRemoved, now.Add(-30*24*time.Hour) })
+	putAsset(t, db, never, func(a *database.Asset) {})
+	putAsset(t, db, fresh, func(a *database.Asset) { a.Source, a.SourceChecked = database.SourceAlive, now.Add(-time.Hour) })
+	putAsset(t, db, deleted, func(a *database.Asset) { a.Source, a.SourceChecked = database.SourceDeleted, now.Add(-30*24*time.Hour) })
+	putAsset(t, db, "attachment:abc", func(a *database.Asset) {})
+
+	due, err := plan(db, now)
+	if err != nil {
+		t.Fatalf("plan() failed: %v", err)
+	}
+	if len(due) != 1 || len(due["reddit"]) != 3 {
+		t.Fatalf("Expected 3 reddit probes, got %+v", due)
+	}
+	for i, want := range []string{never, older, old} {
+		if got := due["reddit"][i].url; got != want {
+			t.Errorf("Probe %d is %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	m, db := testMonitor(t)
+	const url = "https://www.reddit.com/r/pics/comments/abc/"
+	putAsset(t, db, url, func(a *database.Asset) { a.Favorite = true })
+
+	// failures other than removals and rate limits are left for the next plan
+	if err := m.check(url, fakeExtractor{errors.New("connection reset")}); err != nil {
+		t.Errorf("Expected transient failure to be swallowed, got %v", err)
+	}
+	if asset, _ := database.ViewAsset(db, url); asset.Source != database.SourceUnknown {
+		t.Errorf("Transient failure was recorded: %+v", asset)
+	}
+	if err := m.check(url, fakeExtractor{download.ErrTooManyRequests}); !errors.Is(err, download.ErrTooManyRequests) {
+		t.Errorf("Expected rate limit to reach the queue, got %v", err)
+	}
+
+	if err := m.check(url, fakeExtractor{&extractors.RemovedError{Deleted: true, Reason: "not_found"}}); err != nil {
+		t.Fatalf("check() failed: %v", err)
+	}
+	asset, err := database.ViewAsset(db, url)
+	if err != nil || asset.Source != database.SourceDeleted || asset.SourceDied.IsZero() {
+		t.Errorf("Expected deleted source, got %+v, %v", asset, err)
+	}
+
+	// evicted in the meantime, nothing is recreated
+	const evicted = "https://www.reddit.com/r/pics/comments/gone/"
+	if err := m.check(evicted, fakeExtractor{}); err != nil {
+		t.Errorf("check() failed: %v", err)
+	}
+	if _, err := database.ViewAsset(db, evicted); err == nil {
+		t.Error("Probe recreated an evicted asset")
+	}
+
+	putAsset(t, db, "https://www.reddit.com/r/pics/comments/alive/", func(a *database.Asset) { a.Source = database.SourceAlive })
+	putAsset(t, db, "https://www.reddit.com/r/pics/comments/new/", func(a *database.Asset) {})
+	putAsset(t, db, "attachment:abc", func(a *database.Asset) {})
+	report, err := BuildReport(db, time.Now())
+	if err != nil {
+		t.Fatalf("BuildReport() failed: %v", err)
+	}
+	if report.Alive != 1 || report.Dead != 1 || report.Unchecked != 1 || len(report.Sources) != 1 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	if s := report.Sources[0]; s.URL != url || s.State != database.SourceDeleted || s.Reason != "not_found" || !s.Favorite {
+		t.Errorf("Unexpected dead source %+v", s)
+	}
+}
+
+func TestStep(t *testing.T) {
+	m, db := testMonitor(t)
+	q := workqueue.New(m.log, 0, 0, time.Millisecond)
+	defer q.Close()
+	m.queue = func(extractors.Extractor, string) *workqueue.Queue { return q }
+
+	urls := []string{"https://www.reddit.com/r/pics/comments/a/", "https://www.reddit.com/r/pics/comments/b/"}
+	removed := fakeExtractor{&extractors.RemovedError{Reason: "private"}}
+	for _, u := range urls {
+		putAsset(t, db, u, func(a *database.Asset) {})
+	}
+	now := time.Now()
+	m.due = map[string][]probe{"fake": {{url: urls[0], ex: removed}, {url: urls[1], ex: removed}}}
+	m.planned = now
+
+	// a queue with a pending job gets nothing
+	release := make(chan struct{})
+	q.Enqueue("download", false, func() error { <-release; return nil })
+	q.Enqueue("download2", false, func() error { return nil })
+	m.step(now)
+	if len(m.due["fake"]) != 2 {
+		t.Errorf("Busy queue was handed a probe")
+	}
+	close(release)
+
+	// one probe at a time once idle
+	deadline := time.Now().Add(5 * time.Second)
+	for len(m.due) > 0 && time.Now().Before(deadline) {
+		m.step(now)
+		time.Sleep(5 * time.Millisecond)
+	}
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		busy := m.busy["fake"]
+		m.mu.Unlock()
+		if !busy {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for _, u := range urls {
+		if asset, err := database.ViewAsset(db, u); err != nil || asset.Source != database.SourceRemoved {
+			t.Errorf("Expected %s to be probed, got %+v, %v", u, asset, err)
+		}
+	}
+}
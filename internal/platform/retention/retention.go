@@ -0,0 +1,414 @@
+// Package retention enforces the per-guild storage policies on the message archive and the asset store.
+package retention
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sprout/internal/platform/database"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Data-Corruption/lmdb-go/wrap"
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const (
+	EnforceInterval  = 6 * time.Hour
+	ReportSampleSize = 20   // evictions listed per guild in a report
+	deleteBatchSize  = 1000 // archived messages per transaction
+
+	GB = 1 << 30 // unit of the settings inputs
+)
+
+// Eviction is an asset or archived message a policy removes.
+type Eviction struct {
+	Asset   string       `json:"asset,omitempty"`   // url of the asset
+	Message snowflake.ID `json:"message,omitempty"` // ID of the archived message
+	Size    int64        `json:"size"`
+	Time    time.Time    `json:"time"`   // stored or created
+	Reason  string       `json:"reason"` // "age", "quota" or the domain whose limit was hit
+	path    string
+}
+
+// GuildReport is the storage used by a guild and what its policy evicts.
+type GuildReport struct {
+	GuildID       snowflake.ID             `json:"guildID"`
+	Name          string                   `json:"name"`
+	Policy        database.RetentionPolicy `json:"policy"`
+	Assets        int                      `json:"assets"`
+	AssetBytes    int64                    `json:"assetBytes"`
+	Messages      int                      `json:"messages"`
+	ArchiveBytes  int64                    `json:"archiveBytes"` // compressed
+	Protected     int                      `json:"protected"`    // favorited messages and assets
+	EvictAssets   int                      `json:"evictAssets"`
+	EvictMessages int                      `json:"evictMessages"`
+	EvictBytes    int64                    `json:"evictBytes"`
+	Sample        []Eviction               `json:"sample"` // oldest first, up to ReportSampleSize
+	evictions     []Eviction
+}
+
+// Report is the result of planning, applying it performs the evictions.
+type Report struct {
+	Generated          time.Time     `json:"generated"`
+	Guilds             []GuildReport `json:"guilds"`
+	UnattributedAssets int           `json:"unattributedAssets"` // stored before assets knew their guild, never evicted
+	UnattributedBytes  int64         `json:"unattributedBytes"`
+}
+
+// item is an asset or message considered for eviction.
+type item struct {
+	Eviction
+	domain    string
+	protected bool
+	evicted   bool
+}
+
+// Plan computes what the policies of all guilds would evict, without changing anything.
+// Within a guild, age limits go first, then domain limits, then the total. Assets are evicted
+// before archived messages since the text is what a backup is for, oldest first.
+//
+// WARNING: Starts transactions. Avoid nesting transactions (deadlock risk).
+func Plan(db *wrap.DB, now time.Time) (*Report, error) {
+	guilds, err := database.ViewGuilds(db)
+	if err != nil {
+		return nil, err
+	}
+	favorites, err := database.ViewFavorites(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// archived messages, mirrored attachments tell which guild an older asset belongs to
+	messages := make(map[snowflake.ID][]*item)
+	assetGuild := make(map[string]snowflake.ID) // asset name -> guild
+	pinned := make(map[string]bool)             // asset names used by favorited messages
+	if err := database.ViewArchivedMessageSizes(db, func(msg *database.ArchivedMessage, size int) error {
+		messages[msg.GuildID] = append(messages[msg.GuildID], &item{
+			Eviction:  Eviction{Message: msg.ID, Size: int64(size), Time: msg.ID.Time()},
+			protected: favorites[msg.ID],
+		})
+		for _, att := range msg.Attachments {
+			if att.Asset == "" {
+				continue
+			}
+			if _, ok := assetGuild[att.Asset]; !ok {
+				assetGuild[att.Asset] = msg.GuildID
+			}
+			if favorites[msg.ID] {
+				pinned[att.Asset] = true
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	report := &Report{Generated: now}
+	assets := make(map[snowflake.ID][]*item)
+	if err := database.ViewAssets(db, func(u string, asset *database.Asset) error {
+		if asset.Path == "" {
+			return nil
+		}
+		name := filepath.Base(asset.Path)
+		size, stored := asset.Size, asset.Stored
+		if size == 0 || stored.IsZero() {
+			info, err := os.Stat(asset.Path)
+			if err != nil {
+				return nil // file is gone, nothing to free
+			}
+			size, stored = info.Size(), info.ModTime()
+		}
+		guildID := asset.GuildID
+		if guildID == 0 {
+			guildID = assetGuild[name]
+		}
+		if guildID == 0 {
+			report.UnattributedAssets++
+			report.UnattributedBytes += size
+			return nil
+		}
+		assets[guildID] = append(assets[guildID], &item{
+			Eviction:  Eviction{Asset: u, Size: size, Time: stored, path: asset.Path},
+			domain:    domainOf(u),
+			protected: asset.Favorite || pinned[name],
+		})
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read assets: %w", err)
+	}
+
+	for id, guild := range guilds {
+		report.Guilds = append(report.Guilds, planGuild(id, guild, assets[id], messages[id], now))
+	}
+	slices.SortFunc(report.Guilds, func(a, b GuildReport) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return report, nil
+}
+
+// planGuild applies the policy of one guild to its assets and messages.
+func planGuild(id snowflake.ID, guild *database.Guild, assets, messages []*item, now time.Time) GuildReport {
+	policy := guild.Retention
+	gr := GuildReport{GuildID: id, Name: guild.Name, Policy: policy, Assets: len(assets), Messages: len(messages)}
+	byAge := func(a, b *item) int { return a.Time.Compare(b.Time) }
+	slices.SortFunc(assets, byAge)
+	slices.SortFunc(messages, byAge)
+
+	var total int64
+	for _, it := range assets {
+		gr.AssetBytes += it.Size
+		total += it.Size
+	}
+	for _, it := range messages {
+		gr.ArchiveBytes += it.Size
+		total += it.Size
+	}
+	evict := func(it *item, reason string) {
+		it.evicted, it.Reason = true, reason
+		total -= it.Size
+	}
+
+	all := append(slices.Clone(assets), messages...)
+	for _, it := range all {
+		if it.protected {
+			gr.Protected++
+		}
+	}
+
+	// age
+	if policy.MaxAgeDays > 0 {
+		cutoff := now.AddDate(0, 0, -policy.MaxAgeDays)
+		for _, it := range all {
+			if !it.protected && it.Time.Before(cutoff) {
+				evict(it, "age")
+			}
+		}
+	}
+
+	// domains
+	for domain, limit := range policy.DomainMaxBytes {
+		if limit <= 0 {
+			continue
+		}
+		var used int64
+		for _, it := range assets {
+			if !it.evicted && matchDomain(it.domain, domain) {
+				used += it.Size
+			}
+		}
+		for _, it := range assets {
+			if used <= limit {
+				break
+			}
+			if !it.evicted && !it.protected && matchDomain(it.domain, domain) {
+				used -= it.Size
+				evict(it, domain)
+			}
+		}
+	}
+
+	// total, assets before messages
+	if policy.MaxBytes > 0 {
+		for _, it := range all {
+			if total <= policy.MaxBytes {
+				break
+			}
+			if !it.evicted && !it.protected {
+				evict(it, "quota")
+			}
+		}
+	}
+
+	for _, it := range all {
+		if !it.evicted {
+			continue
+		}
+		if it.Asset != "" {
+			gr.EvictAssets++
+		} else {
+			gr.EvictMessages++
+		}
+		gr.EvictBytes += it.Size
+		gr.evictions = append(gr.evictions, it.Eviction)
+	}
+	slices.SortFunc(gr.evictions, func(a, b Eviction) int { return a.Time.Compare(b.Time) })
+	gr.Sample = gr.evictions[:min(len(gr.evictions), ReportSampleSize)]
+	return gr
+}
+
+// Apply performs the evictions of a report. Asset files are removed once no record uses them
+// anymore, assets are deduplicated by content. Returns the number of freed bytes.
+//
+// WARNING: Starts transactions. Avoid nesting transactions (deadlock risk).
+func Apply(db *wrap.DB, report *Report) (int64, error) {
+	var freed int64
+	paths := make(map[string]string) // url -> path
+	var ids []snowflake.ID
+	for _, gr := range report.Guilds {
+		for _, ev := range gr.evictions {
+			if ev.Asset != "" {
+				paths[ev.Asset] = ev.path
+			} else {
+				ids = append(ids, ev.Message)
+			}
+			freed += ev.Size
+		}
+	}
+
+	if len(paths) > 0 {
+		if _, err := database.DeleteAssets(db, paths); err != nil {
+			return 0, fmt.Errorf("failed to delete assets: %w", err)
+		}
+		used := make(map[string]bool)
+		if err := database.ViewAssets(db, func(_ string, asset *database.Asset) error {
+			used[asset.Path] = true
+			return nil
+		}); err != nil {
+			return 0, fmt.Errorf("failed to read assets: %w", err)
+		}
+		for _, path := range paths {
+			if !used[path] {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return 0, fmt.Errorf("failed to remove asset file: %w", err)
+				}
+			}
+		}
+	}
+
+	for start := 0; start < len(ids); start += deleteBatchSize {
+		if _, err := database.DeleteArchivedMessages(db, ids[start:min(start+deleteBatchSize, len(ids))]); err != nil {
+			return 0, fmt.Errorf("failed to delete archived messages: %w", err)
+		}
+	}
+	return freed, nil
+}
+
+// ParseDomainLimits parses "domain=GB" pairs separated by commas, e.g. "redgifs.com=5, youtube.com=20".
+func ParseDomainLimits(s string) (map[string]int64, error) {
+	limits := make(map[string]int64)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		domain, size, ok := strings.Cut(pair, "=")
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+		if !ok || domain == "" {
+			return nil, fmt.Errorf("invalid domain limit %q, use domain=GB", pair)
+		}
+		gb, err := strconv.ParseFloat(strings.TrimSpace(size), 64)
+		if err != nil || gb < 0 {
+			return nil, fmt.Errorf("invalid size in %q", pair)
+		}
+		limits[domain] = int64(gb * GB)
+	}
+	return limits, nil
+}
+
+// FormatDomainLimits is the inverse of ParseDomainLimits, sorted by domain.
+func FormatDomainLimits(limits map[string]int64) string {
+	var pairs []string
+	for domain, size := range limits {
+		pairs = append(pairs, domain+"="+strconv.FormatFloat(float64(size)/GB, 'f', -1, 64))
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+// domainOf returns the host of an asset url without "www.".
+func domainOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// matchDomain reports whether host is domain or one of its subdomains.
+func matchDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// Enforcer applies the retention policies in the background every EnforceInterval.
+type Enforcer struct {
+	db      *wrap.DB
+	log     *xlog.Logger
+	ctx     context.Context
+	cancel  context.CancelFunc
+	closeWG *sync.WaitGroup
+}
+
+func NewEnforcer(db *wrap.DB, log *xlog.Logger) *Enforcer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Enforcer{db: db, log: log, ctx: ctx, cancel: cancel, closeWG: &sync.WaitGroup{}}
+}
+
+// Start begins enforcing, the first pass runs after a minute so startup isn't slowed down.
+func (e *Enforcer) Start() {
+	e.closeWG.Add(1)
+	go func() {
+		defer e.closeWG.Done()
+		timer := time.NewTimer(time.Minute)
+		defer timer.Stop()
+		for {
+			select {
+			case <-e.ctx.Done():
+				return
+			case <-timer.C:
+				e.Enforce()
+				timer.Reset(EnforceInterval)
+			}
+		}
+	}()
+}
+
+// Close stops the enforcer, a pass in progress is finished before returning.
+func (e *Enforcer) Close() error {
+	e.cancel()
+	e.closeWG.Wait()
+	return nil
+}
+
+// Enforce plans and applies the policies once. Skipped if no guild has a policy.
+func (e *Enforcer) Enforce() {
+	guilds, err := database.ViewGuilds(e.db)
+	if err != nil {
+		e.log.Errorf("retention: failed to get guilds: %v", err)
+		return
+	}
+	if !slices.ContainsFunc(slices.Collect(maps.Values(guilds)), hasPolicy) {
+		return
+	}
+	report, err := Plan(e.db, time.Now())
+	if err != nil {
+		e.log.Errorf("retention: failed to plan: %v", err)
+		return
+	}
+	freed, err := Apply(e.db, report)
+	if err != nil {
+		e.log.Errorf("retention: failed to apply: %v", err)
+		return
+	}
+	for _, gr := range report.Guilds {
+		if gr.EvictAssets+gr.EvictMessages > 0 {
+			e.log.Infof("retention: evicted %d assets and %d messages of guild %s (%s)", gr.EvictAssets, gr.EvictMessages, gr.Name, gr.GuildID)
+		}
+	}
+	if freed > 0 {
+		e.log.Infof("retention: freed %d bytes", freed)
+	}
+}
+
+func hasPolicy(guild *database.Guild) bool {
+	p := guild.Retention
+	return p.MaxAgeDays > 0 || p.MaxBytes > 0 || len(p.DomainMaxBytes) > 0
+}
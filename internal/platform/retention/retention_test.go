@@ -0,0 +1,222 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/lmdb-go/lmdb"
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func TestRetention(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	guildID := snowflake.New(now.Add(-1000 * time.Hour))
+	if _, err := database.UpsertGuild(db, guildID, func(g *database.Guild) error {
+		g.Name = "Test Guild"
+		g.Retention = database.RetentionPolicy{
+			MaxAgeDays:     30,
+			DomainMaxBytes: map[string]int64{"redgifs.com": 150},
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to create guild: %v", err)
+	}
+
+	// assets, stored through the real store so they land in the asset tree
+	store := func(u, content string, guild snowflake.ID, age time.Duration) string {
+		t.Helper()
+		src := filepath.Join(tmpDir, "download.bin")
+		if err := os.WriteFile(src, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write asset: %v", err)
+		}
+		name, err := database.StoreAsset(db, tmpDir, guild, u, src, "")
+		if err != nil {
+			t.Fatalf("StoreAsset() failed: %v", err)
+		}
+		if _, err := database.UpsertAsset(db, u, func(a *database.Asset) error {
+			a.Stored = now.Add(-age)
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to age asset: %v", err)
+		}
+		return name
+	}
+	day := 24 * time.Hour
+	oldURL := "https://www.reddit.com/r/old"
+	favURL := "https://www.reddit.com/r/favorite"
+	sharedURL := "https://www.reddit.com/r/shared" // same content as oldURL, kept
+	store(oldURL, "old bytes", guildID, 40*day)
+	store(favURL, "favorite bytes", guildID, 40*day)
+	store(sharedURL, "old bytes", guildID, time.Hour)
+	gifs := []string{"https://redgifs.com/watch/a", "https://www.redgifs.com/watch/b", "https://redgifs.com/watch/c"}
+	for i, u := range gifs {
+		store(u, string(rune('a'+i))+" gif of 60 bytes, three of them exceed the domain limit"+strings.Repeat(".", 4), guildID, time.Duration(3-i)*day)
+	}
+	orphan := store("https://example.com/orphan", "unknown guild", 0, 400*day)
+	if _, err := database.SetAssetsFavorite(db, []string{favURL, "https://example.com/unknown"}); err != nil {
+		t.Fatalf("SetAssetsFavorite() failed: %v", err)
+	}
+
+	// archived messages, an old one, a favorited old one and a recent one
+	channelID := snowflake.New(now.Add(-999 * time.Hour))
+	if _, err := database.UpsertChannel(db, channelID, func(c *database.Channel) error { return nil }); err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+	msgs := []database.ArchivedMessage{
+		{ID: snowflake.New(now.Add(-60 * day)), Content: "ancient words"},
+		{ID: snowflake.New(now.Add(-50 * day)), Content: "beloved words"},
+		{ID: snowflake.New(now.Add(-time.Hour)), Content: "fresh words"},
+	}
+	for i := range msgs {
+		msgs[i].GuildID, msgs[i].ChannelID, msgs[i].Created = guildID, channelID, msgs[i].ID.Time()
+	}
+	if err := database.ArchiveMessages(db, channelID, msgs, func(b *database.ChannelBackup) error { return nil }); err != nil {
+		t.Fatalf("ArchiveMessages() failed: %v", err)
+	}
+	if err := db.Update(func(txn *lmdb.Txn) error {
+		return database.TxnMarshalAndPut(txn, db.GetDBis()[database.FavoritesDBIName], []byte(msgs[1].ID.String()), snowflake.ID(1))
+	}); err != nil {
+		t.Fatalf("Failed to favorite message: %v", err)
+	}
+
+	report, err := Plan(db, now)
+	if err != nil {
+		t.Fatalf("Plan() failed: %v", err)
+	}
+	if len(report.Guilds) != 1 || report.UnattributedAssets != 1 {
+		t.Fatalf("Expected one guild and one unattributed asset, got %+v", report)
+	}
+	gr := report.Guilds[0]
+	if gr.Assets != 6 || gr.Messages != 3 || gr.Protected != 2 {
+		t.Errorf("Unexpected usage: %+v", gr)
+	}
+	// the old asset by age, the oldest gif by its domain limit, the old message by age
+	if gr.EvictAssets != 2 || gr.EvictMessages != 1 {
+		t.Fatalf("Expected 2 assets and 1 message to be evicted, got %+v", gr.Sample)
+	}
+
+	// a dry run changes nothing
+	if _, err := database.ViewAsset(db, oldURL); err != nil {
+		t.Fatalf("Expected Plan() to leave assets alone: %v", err)
+	}
+
+	if _, err := Apply(db, report); err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+	for _, tt := range []struct {
+		url  string
+		kept bool
+	}{
+		{oldURL, false},
+		{gifs[0], false},
+		{favURL, true},
+		{sharedURL, true},
+		{gifs[1], true},
+		{gifs[2], true},
+	} {
+		asset, err := database.ViewAsset(db, tt.url)
+		if kept := err == nil; kept != tt.kept {
+			t.Errorf("Expected %s kept=%v, got err %v", tt.url, tt.kept, err)
+			continue
+		}
+		if tt.kept {
+			if _, err := os.Stat(asset.Path); err != nil {
+				t.Errorf("Expected the file of %s to be kept: %v", tt.url, err)
+			}
+		}
+	}
+	if _, err := os.Stat(database.ToAssetPath(filepath.Join(tmpDir, "assets"), orphan)); err != nil {
+		t.Errorf("Expected unattributed assets to be kept: %v", err)
+	}
+
+	for i, kept := range []bool{false, true, true} {
+		_, err := database.ViewArchivedMessage(db, msgs[i].ID)
+		if kept && err != nil {
+			t.Errorf("Expected message %d to be kept: %v", i, err)
+		}
+		if !kept && !lmdb.IsNotFound(err) {
+			t.Errorf("Expected message %d to be evicted, got %v", i, err)
+		}
+	}
+	result, err := database.Search(db, database.SearchQuery{Text: "ancient", GuildIDs: []snowflake.ID{guildID}})
+	if err != nil || result.Total != 0 {
+		t.Errorf("Expected the evicted message to leave the search index, got %+v %v", result, err)
+	}
+
+	// everything within the limits now
+	report, err = Plan(db, now)
+	if err != nil {
+		t.Fatalf("Plan() failed: %v", err)
+	}
+	if gr := report.Guilds[0]; gr.EvictBytes != 0 {
+		t.Errorf("Expected nothing left to evict, got %+v", gr.Sample)
+	}
+}
+
+func TestPlanQuota(t *testing.T) {
+	now := time.Now()
+	it := func(asset string, size int64, age time.Duration, protected bool) *item {
+		ev := Eviction{Asset: asset, Size: size, Time: now.Add(-age)}
+		if asset == "" {
+			ev.Message = snowflake.New(ev.Time)
+		}
+		return &item{Eviction: ev, protected: protected}
+	}
+	assets := []*item{it("new", 100, time.Hour, false), it("old", 100, 48*time.Hour, false), it("fav", 100, 72*time.Hour, true)}
+	messages := []*item{it("", 50, 96*time.Hour, false), it("", 50, time.Hour, false)}
+	guild := &database.Guild{Retention: database.RetentionPolicy{MaxBytes: 220}}
+
+	gr := planGuild(1, guild, assets, messages, now)
+	// 400 bytes, assets go first oldest first: old (300), new (200)
+	if gr.EvictAssets != 2 || gr.EvictMessages != 0 || gr.EvictBytes != 200 {
+		t.Errorf("Expected both unprotected assets to be evicted, got %+v", gr)
+	}
+
+	guild.Retention.MaxBytes = 120
+	for _, i := range append(assets, messages...) {
+		i.evicted, i.Reason = false, ""
+	}
+	gr = planGuild(1, guild, assets, messages, now)
+	// then the oldest message: 150, then the other one: 100
+	if gr.EvictAssets != 2 || gr.EvictMessages != 2 {
+		t.Errorf("Expected messages to go after assets, got %+v", gr)
+	}
+}
+
+func TestDomainLimits(t *testing.T) {
+	limits, err := ParseDomainLimits(" WWW.RedGifs.com=1.5, youtube.com = 20,")
+	if err != nil {
+		t.Fatalf("ParseDomainLimits() failed: %v", err)
+	}
+	if limits["redgifs.com"] != GB*3/2 || limits["youtube.com"] != 20*GB || len(limits) != 2 {
+		t.Errorf("Unexpected limits: %v", limits)
+	}
+	if got := FormatDomainLimits(limits); got != "redgifs.com=1.5, youtube.com=20" {
+		t.Errorf("FormatDomainLimits() = %q", got)
+	}
+	for _, bad := range []string{"redgifs.com", "=5", "redgifs.com=lots", "redgifs.com=-1"} {
+		if _, err := ParseDomainLimits(bad); err == nil {
+			t.Errorf("Expected ParseDomainLimits(%q) to fail", bad)
+		}
+	}
+	if !matchDomain("i.redd.it", "redd.it") || matchDomain("notredd.it", "redd.it") {
+		t.Errorf("Unexpected subdomain matching")
+	}
+}
@@ -0,0 +1,185 @@
+// Package aeszip writes password protected zip files using WinZip AES-256 encryption (AE-2).
+// These open in 7-Zip, WinRAR, Keka, etc. Plain archive/zip can't read them back.
+package aeszip
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	MethodAES = 99 // zip method id for WinZip AES
+
+	saltLen    = 16 // for AES-256
+	keyLen     = 32
+	pwvLen     = 2 // password verification value
+	authLen    = 10
+	iterations = 1000
+	overhead   = saltLen + pwvLen + authLen
+)
+
+// Writer wraps a zip.Writer, encrypting every entry with the same password.
+type Writer struct {
+	zw       *zip.Writer
+	password string
+}
+
+func NewWriter(w io.Writer, password string) *Writer {
+	return &Writer{zw: zip.NewWriter(w), password: password}
+}
+
+// Store adds an uncompressed entry, size must be the exact length of r.
+// Use this for already compressed data like images and videos.
+func (w *Writer) Store(name string, modified time.Time, r io.Reader, size int64) error {
+	return w.create(name, modified, zip.Store, r, size, size)
+}
+
+// Deflate compresses data and adds it as an entry.
+func (w *Writer) Deflate(name string, modified time.Time, data []byte) error {
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	return w.create(name, modified, zip.Deflate, &buf, int64(buf.Len()), int64(len(data)))
+}
+
+// Close finishes writing the zip file. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.zw.Close()
+}
+
+func (w *Writer) create(name string, modified time.Time, method uint16, r io.Reader, size, uncompressedSize int64) error {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	keys, err := pbkdf2.Key(sha1.New, w.password, salt, iterations, 2*keyLen+pwvLen)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(keys[:keyLen])
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha1.New, keys[keyLen:2*keyLen])
+
+	fh := &zip.FileHeader{
+		Name:               name,
+		Method:             MethodAES,
+		Flags:              0x1 | 0x800, // encrypted, utf-8 name
+		CreatorVersion:     51,
+		ReaderVersion:      51,
+		CRC32:              0, // not stored in AE-2, the HMAC covers integrity
+		CompressedSize64:   uint64(size + overhead),
+		UncompressedSize64: uint64(uncompressedSize),
+		Extra:              extraField(method),
+	}
+	fh.ModifiedDate, fh.ModifiedTime = msDosTime(modified)
+
+	out, err := w.zw.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(salt); err != nil {
+		return err
+	}
+	if _, err := out.Write(keys[2*keyLen:]); err != nil {
+		return err
+	}
+
+	stream := newCTR(block)
+	buf := make([]byte, 32*1024)
+	var written int64
+	for {
+		n, rErr := r.Read(buf)
+		if n > 0 {
+			stream.XORKeyStream(buf[:n], buf[:n])
+			mac.Write(buf[:n])
+			if _, err := out.Write(buf[:n]); err != nil {
+				return err
+			}
+			written += int64(n)
+		}
+		if rErr == io.EOF {
+			break
+		}
+		if rErr != nil {
+			return rErr
+		}
+	}
+	if written != size {
+		return fmt.Errorf("size mismatch for %q: expected %d, read %d", name, size, written)
+	}
+
+	_, err = out.Write(mac.Sum(nil)[:authLen])
+	return err
+}
+
+// extraField builds the AES extra data field (0x9901) holding the real compression method.
+func extraField(method uint16) []byte {
+	b := make([]byte, 11)
+	binary.LittleEndian.PutUint16(b[0:], 0x9901)
+	binary.LittleEndian.PutUint16(b[2:], 7) // data size
+	binary.LittleEndian.PutUint16(b[4:], 2) // AE-2
+	copy(b[6:], "AE")
+	b[8] = 3 // AES-256
+	binary.LittleEndian.PutUint16(b[9:], method)
+	return b
+}
+
+func msDosTime(t time.Time) (date, clock uint16) {
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return
+}
+
+// ctr is AES in counter mode as WinZip does it, a little endian counter starting at 1.
+// cipher.NewCTR increments big endian so it can't be used here.
+type ctr struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	ks      [aes.BlockSize]byte
+	pos     int
+}
+
+func newCTR(block cipher.Block) *ctr {
+	return &ctr{block: block, pos: aes.BlockSize}
+}
+
+func (c *ctr) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.pos == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.ks[:], c.counter[:])
+			c.pos = 0
+		}
+		dst[i] = src[i] ^ c.ks[c.pos]
+		c.pos++
+	}
+}
@@ -0,0 +1,108 @@
+package aeszip
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+)
+
+// decrypt reverses create for a single entry, verifying the password and authentication code.
+func decrypt(t *testing.T, f *zip.File, password string) []byte {
+	t.Helper()
+	if f.Method != MethodAES {
+		t.Fatalf("Expected method %d, got %d", MethodAES, f.Method)
+	}
+	if len(f.Extra) != 11 || binary.LittleEndian.Uint16(f.Extra) != 0x9901 {
+		t.Fatalf("Missing AES extra field: %x", f.Extra)
+	}
+	method := binary.LittleEndian.Uint16(f.Extra[9:])
+
+	r, err := f.OpenRaw()
+	if err != nil {
+		t.Fatalf("OpenRaw() failed: %v", err)
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to read raw entry: %v", err)
+	}
+	if uint64(len(raw)) != f.CompressedSize64 {
+		t.Fatalf("Expected %d raw bytes, got %d", f.CompressedSize64, len(raw))
+	}
+
+	salt, pwv := raw[:saltLen], raw[saltLen:saltLen+pwvLen]
+	data, code := raw[saltLen+pwvLen:len(raw)-authLen], raw[len(raw)-authLen:]
+	keys, err := pbkdf2.Key(sha1.New, password, salt, iterations, 2*keyLen+pwvLen)
+	if err != nil {
+		t.Fatalf("pbkdf2.Key() failed: %v", err)
+	}
+	if !bytes.Equal(pwv, keys[2*keyLen:]) {
+		t.Fatalf("Password verification value mismatch")
+	}
+	mac := hmac.New(sha1.New, keys[keyLen:2*keyLen])
+	mac.Write(data)
+	if !bytes.Equal(code, mac.Sum(nil)[:authLen]) {
+		t.Fatalf("Authentication code mismatch")
+	}
+
+	block, err := aes.NewCipher(keys[:keyLen])
+	if err != nil {
+		t.Fatalf("aes.NewCipher() failed: %v", err)
+	}
+	plain := make([]byte, len(data))
+	newCTR(block).XORKeyStream(plain, data)
+
+	if method == zip.Deflate {
+		plain, err = io.ReadAll(flate.NewReader(bytes.NewReader(plain)))
+		if err != nil {
+			t.Fatalf("Failed to inflate: %v", err)
+		}
+	}
+	return plain
+}
+
+func TestWriter(t *testing.T) {
+	const password = "hunter2"
+	stored := bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef}, 10000) // spans many blocks and read chunks
+	deflated := []byte(`[{"id":"1","content":"hello"},{"id":"2","content":"hello again"}]`)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, password)
+	if err := w.Store("assets/ab.bin", time.Now(), bytes.NewReader(stored), int64(len(stored))); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+	if err := w.Deflate("messages/1.json", time.Now(), deflated); err != nil {
+		t.Fatalf("Deflate() failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() failed: %v", err)
+	}
+	if len(zr.File) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(zr.File))
+	}
+	if got := decrypt(t, zr.File[0], password); !bytes.Equal(got, stored) {
+		t.Errorf("Stored entry does not round trip")
+	}
+	if got := decrypt(t, zr.File[1], password); !bytes.Equal(got, deflated) {
+		t.Errorf("Deflated entry does not round trip, got %q", got)
+	}
+
+	t.Run("Size Mismatch", func(t *testing.T) {
+		w := NewWriter(io.Discard, password)
+		if err := w.Store("short", time.Now(), bytes.NewReader(stored[:10]), 11); err == nil {
+			t.Errorf("Expected error for short reader")
+		}
+	})
+}
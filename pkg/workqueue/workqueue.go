@@ -26,9 +26,12 @@ type Queue struct {
 	jitter   time.Duration
 	log      *xlog.Logger
 
-	wg        sync.WaitGroup
-	runningID string
-	running   bool
+	wg         sync.WaitGroup
+	runningID  string
+	running    bool
+	wake       chan struct{} // cuts a pause short after SetPolicy or Close
+	resumeAt   time.Time     // end of the current pause between jobs
+	backingOff bool          // the current pause is a backoff
 
 	// Backoff fields
 	backoffBase    time.Duration
@@ -50,6 +53,7 @@ func New(log *xlog.Logger, interval, jitter, backoff time.Duration) *Queue {
 		backoffBase:    backoff,
 		backoffCurrent: backoff,
 		backoffMax:     time.Hour,
+		wake:           make(chan struct{}, 1),
 	}
 	q.cond = sync.NewCond(&q.mu)
 
@@ -103,6 +107,59 @@ func (q *Queue) Len() int {
 	return len(q.jobs)
 }
 
+// Stats is a snapshot of the policy and state of a queue.
+type Stats struct {
+	Interval    time.Duration
+	Jitter      time.Duration
+	Backoff     time.Duration // initial backoff
+	NextBackoff time.Duration // applied after the next failure, doubled per consecutive error
+	BackoffLeft time.Duration // of the backoff in progress, 0 if none
+	Len         int
+	Running     bool
+}
+
+// Stats returns the current policy and state of the queue.
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := Stats{
+		Interval:    q.interval,
+		Jitter:      q.jitter,
+		Backoff:     q.backoffBase,
+		NextBackoff: q.backoffCurrent,
+		Len:         len(q.jobs),
+		Running:     q.running,
+	}
+	if q.backingOff {
+		s.BackoffLeft = max(time.Until(q.resumeAt), 0)
+	}
+	return s
+}
+
+// SetPolicy replaces the interval, jitter and initial backoff of a running queue, see New.
+// The backoff starts over from the new baseline and a pause in progress is shortened
+// if it's longer than the new policy allows.
+func (q *Queue) SetPolicy(interval, jitter, backoff time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.interval = interval
+	q.jitter = jitter
+	q.backoffBase = backoff
+	q.backoffCurrent = backoff
+
+	limit := interval + jitter
+	if q.backingOff {
+		limit = backoff
+	}
+	if resumeAt := time.Now().Add(limit); q.resumeAt.After(resumeAt) {
+		q.resumeAt = resumeAt
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
 // ResetBackoff resets the backoff duration to its baseline value.
 func (q *Queue) ResetBackoff() {
 	q.mu.Lock()
@@ -140,6 +197,13 @@ func (q *Queue) Close() {
 		q.jobs = nil // or make([]job, 0)
 	}
 
+	// no point pausing anymore
+	q.resumeAt = time.Time{}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
 	q.cond.Broadcast()
 	q.mu.Unlock()
 
@@ -183,7 +247,7 @@ func (q *Queue) loop() {
 			q.mu.Unlock()
 
 			q.log.Warnf("backing off for %v due to job error", backoffDuration)
-			time.Sleep(backoffDuration)
+			q.pause(backoffDuration, true)
 		} else {
 			// Reset backoff on success
 			q.mu.Lock()
@@ -205,13 +269,45 @@ func (q *Queue) loop() {
 			return
 		}
 
+		q.mu.Lock()
 		sleep := q.interval
 		if q.jitter > 0 {
 			extra := time.Duration(rand.Int63n(int64(q.jitter)))
 			sleep += extra
 		}
-		if sleep > 0 {
-			time.Sleep(sleep)
+		q.mu.Unlock()
+		q.pause(sleep, false)
+	}
+}
+
+// pause sleeps for d, or less if SetPolicy shortens it or the queue is closed in the meantime.
+func (q *Queue) pause(d time.Duration, backoff bool) {
+	q.mu.Lock()
+	if d <= 0 || q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.resumeAt = time.Now().Add(d)
+	q.backingOff = backoff
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		q.backingOff = false
+		q.mu.Unlock()
+	}()
+
+	for {
+		q.mu.Lock()
+		left := time.Until(q.resumeAt)
+		q.mu.Unlock()
+		if left <= 0 {
+			return
+		}
+		timer := time.NewTimer(left)
+		select {
+		case <-timer.C:
+		case <-q.wake:
+			timer.Stop()
 		}
 	}
 }
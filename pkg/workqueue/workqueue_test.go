@@ -0,0 +1,48 @@
+package workqueue
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func TestSetPolicy(t *testing.T) {
+	logger, err := xlog.New(filepath.Join(t.TempDir(), "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	q := New(logger, 0, 0, time.Hour)
+	defer q.Close()
+
+	// a failure pauses the queue for the hour long backoff
+	q.Enqueue("fail", false, func() error { return errors.New("rate limited") })
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Stats().BackoffLeft == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	s := q.Stats()
+	if s.BackoffLeft <= 0 || s.BackoffLeft > time.Hour || s.NextBackoff != time.Hour {
+		t.Fatalf("Expected an hour long backoff in progress, got %+v", s)
+	}
+
+	// a shorter backoff cuts the pause short
+	done := make(chan struct{})
+	q.Enqueue("next", false, func() error { close(done); return nil })
+	if s := q.Stats(); s.Len != 1 {
+		t.Errorf("Expected 1 queued job, got %+v", s)
+	}
+	q.SetPolicy(20*time.Millisecond, 0, 10*time.Millisecond)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Job did not run after the backoff was shortened")
+	}
+	if s := q.Stats(); s.Interval != 20*time.Millisecond || s.Backoff != 10*time.Millisecond || s.NextBackoff != 10*time.Millisecond {
+		t.Errorf("Policy not applied, got %+v", s)
+	}
+}